@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/paccolamano/goshare/logger"
+)
+
+// filter selects the records to output.
+type filter struct {
+	traces   map[string]struct{}
+	minLevel *slog.Level
+	since    time.Time
+	until    time.Time
+	exprs    []expr
+}
+
+// match reports whether rec satisfies every condition of f.
+func (f *filter) match(rec *record) bool {
+	if len(f.traces) > 0 {
+		if _, ok := f.traces[rec.trace]; !ok {
+			return false
+		}
+	}
+
+	if f.minLevel != nil {
+		l, ok := parseLevel(rec.level)
+		if !ok || l < *f.minLevel {
+			return false
+		}
+	}
+
+	if !f.since.IsZero() && rec.time.Before(f.since) {
+		return false
+	}
+
+	if !f.until.IsZero() && !rec.time.Before(f.until) {
+		return false
+	}
+
+	for _, e := range f.exprs {
+		if !e.match(rec) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// parseLevel parses level names as written by TraceHandler,
+// including TRACE, FATAL and offsets such as "INFO+2".
+func parseLevel(s string) (slog.Level, bool) {
+	switch strings.ToUpper(s) {
+	case "TRACE":
+		return logger.LevelTrace, true
+	case "FATAL":
+		return logger.LevelFatal, true
+	}
+
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(s)); err != nil {
+		return 0, false
+	}
+
+	return l, true
+}
+
+// expr is an attribute condition such as "status>=500" or "path~^/api".
+type expr struct {
+	key   string
+	op    string
+	value string
+	re    *regexp.Regexp
+	num   float64
+}
+
+// operators lists the supported operators, longest first so that
+// "!=" and ">=" are recognized before "=" and ">".
+var operators = []string{"!=", ">=", "<=", "=", "~", ">", "<"}
+
+// parseExpr parses an attribute expression of the form key<op>value, where op
+// is one of =, !=, ~ (regular expression), >, >=, < or <= (numeric comparison).
+func parseExpr(s string) (expr, error) {
+	i := strings.IndexAny(s, "!=~<>")
+	if i <= 0 {
+		return expr{}, fmt.Errorf("invalid expression %q: missing operator", s)
+	}
+
+	e := expr{key: s[:i]}
+	for _, op := range operators {
+		if strings.HasPrefix(s[i:], op) {
+			e.op = op
+			e.value = s[i+len(op):]
+
+			break
+		}
+	}
+
+	switch e.op {
+	case "":
+		return expr{}, fmt.Errorf("invalid expression %q: unknown operator", s)
+	case "~":
+		re, err := regexp.Compile(e.value)
+		if err != nil {
+			return expr{}, fmt.Errorf("invalid expression %q: %w", s, err)
+		}
+
+		e.re = re
+	case ">", ">=", "<", "<=":
+		n, err := strconv.ParseFloat(e.value, 64)
+		if err != nil {
+			return expr{}, fmt.Errorf("invalid expression %q: %w", s, err)
+		}
+
+		e.num = n
+	}
+
+	return e, nil
+}
+
+// match reports whether rec satisfies e. Missing attributes only match "!=".
+func (e expr) match(rec *record) bool {
+	v, ok := rec.lookup(e.key)
+	if !ok {
+		return e.op == "!="
+	}
+
+	switch e.op {
+	case "=":
+		return v == e.value
+	case "!=":
+		return v != e.value
+	case "~":
+		return e.re.MatchString(v)
+	}
+
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return false
+	}
+
+	switch e.op {
+	case ">":
+		return n > e.num
+	case ">=":
+		return n >= e.num
+	case "<":
+		return n < e.num
+	default:
+		return n <= e.num
+	}
+}
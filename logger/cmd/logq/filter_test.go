@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilterMatch(t *testing.T) {
+	t.Parallel()
+
+	rec, err := parseRecord(`{"time":"2025-01-02T03:04:05Z","level":"ERROR","msg":"failed","status":502,"path":"/api/orders","traceUUID":"abc"}`, defaultKeys)
+	require.NoError(t, err)
+
+	cases := []struct {
+		name     string
+		traces   []string
+		wheres   []string
+		level    string
+		since    string
+		until    string
+		expected bool
+	}{
+		{name: "no conditions", expected: true},
+		{name: "trace match", traces: []string{"xyz", "abc"}, expected: true},
+		{name: "trace mismatch", traces: []string{"xyz"}, expected: false},
+		{name: "level below", level: "warn", expected: true},
+		{name: "level above", level: "fatal", expected: false},
+		{name: "since", since: "2025-01-02T03:04:05Z", expected: true},
+		{name: "until", until: "2025-01-02T03:04:05Z", expected: false},
+		{name: "numeric", wheres: []string{"status>=500", "status<600"}, expected: true},
+		{name: "regex", wheres: []string{"path~^/api/"}, expected: true},
+		{name: "not equal", wheres: []string{"path!=/api/orders"}, expected: false},
+		{name: "missing attribute", wheres: []string{"user=bob"}, expected: false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			f, err := newFilter(tc.traces, tc.wheres, tc.level, tc.since, tc.until)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, f.match(rec))
+		})
+	}
+}
+
+func TestParseExprInvalid(t *testing.T) {
+	t.Parallel()
+
+	for _, s := range []string{"status", "=500", "status>abc", "path~("} {
+		_, err := parseExpr(s)
+		require.Error(t, err, s)
+	}
+}
@@ -0,0 +1,250 @@
+// Command logq reads TraceHandler output, in JSON or text format, filters records
+// by trace ID, level, time range and attribute expressions, and writes them back
+// either unchanged or in a pretty console format, optionally grouped into
+// per-request timelines.
+//
+// Usage:
+//
+//	logq [flags] [file ...]
+//
+// Without files, records are read from standard input. Examples:
+//
+//	logq -trace 6f1c... app.log
+//	logq -level warn -where 'status>=500' -where 'path~^/api' -pretty app.log
+//	logq -since 2025-01-02T15:00:00Z -timeline -pretty app.log
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/paccolamano/goshare/logger"
+)
+
+// maxLineSize is the maximum size of a single log line.
+const maxLineSize = 1 << 20
+
+// multiFlag collects the values of a repeatable flag.
+type multiFlag []string
+
+func (m *multiFlag) String() string {
+	return strings.Join(*m, ",")
+}
+
+func (m *multiFlag) Set(v string) error {
+	*m = append(*m, v)
+	return nil
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run executes logq with the given arguments and returns the exit code.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("logq", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	var (
+		traces, wheres multiFlag
+		k              keys
+	)
+
+	fs.Var(&traces, "trace", "only output records with this trace ID (repeatable)")
+	fs.Var(&wheres, "where", "attribute expression key{=,!=,~,>,>=,<,<=}value (repeatable)")
+	level := fs.String("level", "", "minimum level (trace, debug, info, warn, error, fatal)")
+	since := fs.String("since", "", "only output records at or after this RFC3339 time")
+	until := fs.String("until", "", "only output records before this RFC3339 time")
+	timeline := fs.Bool("timeline", false, "group records by trace ID and order each group by time")
+	pretty := fs.Bool("pretty", false, "render records in the pretty console format")
+	color := fs.Bool("color", false, "colorize pretty output")
+	keyFile := fs.String("keys", "", "file of id=base64key lines used to decrypt encrypted attributes")
+	fs.StringVar(&k.time, "time-key", "time", "key of the record time")
+	fs.StringVar(&k.timeFormat, "time-format", time.RFC3339Nano, "layout of the record time")
+	fs.StringVar(&k.level, "level-key", "level", "key of the record level")
+	fs.StringVar(&k.msg, "msg-key", "msg", "key of the record message")
+	fs.StringVar(&k.trace, "trace-key", "traceUUID", "key of the record trace ID")
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	f, err := newFilter(traces, wheres, *level, *since, *until)
+	if err != nil {
+		printError(stderr, err)
+		return 2
+	}
+
+	var kp logger.KeyProvider
+	if *keyFile != "" {
+		if kp, err = loadKeys(*keyFile); err != nil {
+			printError(stderr, err)
+			return 1
+		}
+	}
+
+	r := &renderer{out: stdout, pretty: *pretty, color: *color, keys: k}
+
+	var records []*record
+
+	emit := func(rec *record) error {
+		if kp != nil {
+			rec.decrypt(kp)
+		}
+
+		if !f.match(rec) {
+			return nil
+		}
+
+		if *timeline {
+			records = append(records, rec)
+			return nil
+		}
+
+		return r.render(rec)
+	}
+
+	if err := readInputs(fs.Args(), stdin, k, emit); err != nil {
+		printError(stderr, err)
+		return 1
+	}
+
+	if *timeline {
+		if err := r.renderTimelines(records); err != nil {
+			printError(stderr, err)
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// printError reports err on w.
+func printError(w io.Writer, err error) {
+	_, _ = fmt.Fprintln(w, "logq:", err)
+}
+
+// newFilter builds a filter from the command line flags.
+func newFilter(traces, wheres []string, level, since, until string) (*filter, error) {
+	f := &filter{traces: make(map[string]struct{}, len(traces))}
+
+	for _, t := range traces {
+		f.traces[t] = struct{}{}
+	}
+
+	if level != "" {
+		l, ok := parseLevel(level)
+		if !ok {
+			return nil, fmt.Errorf("invalid level %q", level)
+		}
+
+		f.minLevel = &l
+	}
+
+	var err error
+
+	if since != "" {
+		if f.since, err = time.Parse(time.RFC3339Nano, since); err != nil {
+			return nil, fmt.Errorf("invalid since: %w", err)
+		}
+	}
+
+	if until != "" {
+		if f.until, err = time.Parse(time.RFC3339Nano, until); err != nil {
+			return nil, fmt.Errorf("invalid until: %w", err)
+		}
+	}
+
+	for _, w := range wheres {
+		e, err := parseExpr(w)
+		if err != nil {
+			return nil, err
+		}
+
+		f.exprs = append(f.exprs, e)
+	}
+
+	return f, nil
+}
+
+// readInputs parses every line of the given files, or of stdin when no file is given,
+// and passes the resulting records to emit. Lines that are not records are skipped.
+func readInputs(files []string, stdin io.Reader, k keys, emit func(*record) error) error {
+	if len(files) == 0 {
+		return readRecords(stdin, k, emit)
+	}
+
+	for _, name := range files {
+		file, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+
+		err = readRecords(file, k, emit)
+		_ = file.Close()
+
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+func readRecords(in io.Reader, k keys, emit func(*record) error) error {
+	sc := bufio.NewScanner(in)
+	sc.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+
+	for sc.Scan() {
+		rec, err := parseRecord(sc.Text(), k)
+		if err != nil {
+			continue
+		}
+
+		if err := emit(rec); err != nil {
+			return err
+		}
+	}
+
+	return sc.Err()
+}
+
+// loadKeys reads a key file made of "id=base64key" lines. The last key becomes
+// the current one, although logq only uses keys for decryption.
+func loadKeys(name string) (*logger.KeyRing, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	kr := logger.NewKeyRing()
+
+	for line := range strings.Lines(string(data)) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		id, enc, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid key line %q", line)
+		}
+
+		key, err := base64.StdEncoding.DecodeString(enc)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", id, err)
+		}
+
+		if err := kr.Rotate(id, key); err != nil {
+			return nil, err
+		}
+	}
+
+	return kr, nil
+}
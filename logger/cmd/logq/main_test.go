@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunTimeline(t *testing.T) {
+	t.Parallel()
+
+	in := strings.Join([]string{
+		`{"time":"2025-01-02T03:04:07Z","level":"INFO","msg":"request completed","traceUUID":"b"}`,
+		`{"time":"2025-01-02T03:04:05Z","level":"INFO","msg":"incoming request","traceUUID":"b"}`,
+		`not a record`,
+		`{"time":"2025-01-02T03:04:06Z","level":"DEBUG","msg":"cache miss","traceUUID":"a"}`,
+		`{"time":"2025-01-02T03:04:04Z","level":"INFO","msg":"incoming request","traceUUID":"a"}`,
+	}, "\n")
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	code := run([]string{"-timeline", "-pretty", "-level", "info"}, strings.NewReader(in), stdout, stderr)
+
+	require.Equal(t, 0, code, stderr.String())
+	require.Equal(t, strings.Join([]string{
+		"== trace a: 1 records over 0s",
+		"2025-01-02 03:04:04.000 INFO  incoming request traceUUID=a",
+		"",
+		"== trace b: 2 records over 2s",
+		"2025-01-02 03:04:05.000 INFO  incoming request traceUUID=b",
+		"2025-01-02 03:04:07.000 INFO  request completed traceUUID=b",
+		"",
+	}, "\n"), stdout.String())
+}
+
+func TestRunInvalidFlags(t *testing.T) {
+	t.Parallel()
+
+	stderr := &bytes.Buffer{}
+	code := run([]string{"-where", "status"}, strings.NewReader(""), &bytes.Buffer{}, stderr)
+
+	require.Equal(t, 2, code)
+	require.Contains(t, stderr.String(), "missing operator")
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/paccolamano/goshare/logger"
+)
+
+// errMalformed is returned when a line is neither a JSON nor a text record.
+var errMalformed = errors.New("malformed record")
+
+// keys holds the names of the built-in record keys, which can be customized
+// through the TraceHandler options.
+type keys struct {
+	time       string
+	timeFormat string
+	level      string
+	msg        string
+	trace      string
+}
+
+// field is a single record attribute. Group attributes are flattened
+// to dotted keys, as rendered by the text handler.
+type field struct {
+	key   string
+	value string
+}
+
+// record is a parsed log line.
+type record struct {
+	raw    string
+	json   bool
+	time   time.Time
+	level  string
+	msg    string
+	trace  string
+	fields []field
+}
+
+// parseRecord parses a line written by TraceHandler, either in JSON or text format.
+func parseRecord(line string, k keys) (*record, error) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return nil, errMalformed
+	}
+
+	rec := &record{raw: line}
+
+	var err error
+	if line[0] == '{' {
+		rec.json = true
+		err = parseJSONFields(json.RawMessage(line), "", &rec.fields)
+	} else {
+		rec.fields, err = parseTextFields(line)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range rec.fields {
+		switch f.key {
+		case k.time:
+			if t, err := time.Parse(k.timeFormat, f.value); err == nil {
+				rec.time = t
+			}
+		case k.level:
+			rec.level = f.value
+		case k.msg:
+			rec.msg = f.value
+		case k.trace:
+			rec.trace = f.value
+		}
+	}
+
+	return rec, nil
+}
+
+// lookup returns the value of the field with the given key.
+func (r *record) lookup(key string) (string, bool) {
+	for _, f := range r.fields {
+		if f.key == key {
+			return f.value, true
+		}
+	}
+
+	return "", false
+}
+
+// decrypt replaces values encrypted by logger.EncryptHandler with their plaintext,
+// both in the parsed fields and in the raw line.
+func (r *record) decrypt(kp logger.KeyProvider) {
+	for i, f := range r.fields {
+		if !logger.IsEncrypted(f.value) {
+			continue
+		}
+
+		plain, err := logger.DecryptValue(kp, f.value)
+		if err != nil {
+			continue
+		}
+
+		r.raw = strings.Replace(r.raw, f.value, r.quote(plain), 1)
+		r.fields[i].value = plain
+	}
+}
+
+// quote encodes v so that it can replace an unquoted encrypted value in the raw line.
+func (r *record) quote(v string) string {
+	if r.json {
+		b, _ := json.Marshal(v)
+		return string(b[1 : len(b)-1])
+	}
+
+	if v == "" || strings.ContainsAny(v, " =\"") || !strconv.CanBackquote(v) {
+		return strconv.Quote(v)
+	}
+
+	return v
+}
+
+// parseJSONFields flattens the JSON object data into fields, prefixing keys with prefix.
+func parseJSONFields(data json.RawMessage, prefix string, fields *[]field) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return errMalformed
+	}
+
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("%w: %w", errMalformed, err)
+		}
+
+		key, _ := tok.(string)
+
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return fmt.Errorf("%w: %w", errMalformed, err)
+		}
+
+		switch raw[0] {
+		case '{':
+			if err := parseJSONFields(raw, prefix+key+".", fields); err != nil {
+				return err
+			}
+		case '"':
+			var s string
+			if err := json.Unmarshal(raw, &s); err != nil {
+				return fmt.Errorf("%w: %w", errMalformed, err)
+			}
+
+			*fields = append(*fields, field{key: prefix + key, value: s})
+		default:
+			*fields = append(*fields, field{key: prefix + key, value: string(raw)})
+		}
+	}
+
+	return nil
+}
+
+// parseTextFields splits a text handler line into key=value fields,
+// unquoting quoted values.
+func parseTextFields(line string) ([]field, error) {
+	var fields []field
+
+	for line != "" {
+		eq := strings.IndexByte(line, '=')
+		if eq <= 0 {
+			return nil, errMalformed
+		}
+
+		key := line[:eq]
+		if strings.HasPrefix(key, `"`) {
+			unquoted, err := strconv.Unquote(key)
+			if err != nil {
+				return nil, errMalformed
+			}
+
+			key = unquoted
+		}
+
+		line = line[eq+1:]
+
+		var value string
+
+		if strings.HasPrefix(line, `"`) {
+			quoted, err := strconv.QuotedPrefix(line)
+			if err != nil {
+				return nil, errMalformed
+			}
+
+			value, _ = strconv.Unquote(quoted)
+			line = line[len(quoted):]
+		} else {
+			end := strings.IndexByte(line, ' ')
+			if end < 0 {
+				end = len(line)
+			}
+
+			value, line = line[:end], line[end:]
+		}
+
+		fields = append(fields, field{key: key, value: value})
+		line = strings.TrimLeft(line, " ")
+	}
+
+	return fields, nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/paccolamano/goshare/logger"
+	"github.com/stretchr/testify/require"
+)
+
+var defaultKeys = keys{
+	time:       "time",
+	timeFormat: time.RFC3339Nano,
+	level:      "level",
+	msg:        "msg",
+	trace:      "traceUUID",
+}
+
+func TestParseRecord(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+		line string
+	}{
+		{"json", `{"time":"2025-01-02T03:04:05.123Z","level":"WARN","msg":"slow request","req":{"path":"/a b","status":503},"traceUUID":"abc"}`},
+		{"text", `time=2025-01-02T03:04:05.123Z level=WARN msg="slow request" req.path="/a b" req.status=503 traceUUID=abc`},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			rec, err := parseRecord(tc.line, defaultKeys)
+			require.NoError(t, err)
+
+			require.Equal(t, time.Date(2025, 1, 2, 3, 4, 5, 123e6, time.UTC), rec.time.UTC())
+			require.Equal(t, "WARN", rec.level)
+			require.Equal(t, "slow request", rec.msg)
+			require.Equal(t, "abc", rec.trace)
+
+			v, ok := rec.lookup("req.path")
+			require.True(t, ok)
+			require.Equal(t, "/a b", v)
+
+			v, ok = rec.lookup("req.status")
+			require.True(t, ok)
+			require.Equal(t, "503", v)
+		})
+	}
+}
+
+func TestParseRecordMalformed(t *testing.T) {
+	t.Parallel()
+
+	for _, line := range []string{"", "panic: boom", `{"broken"`, `msg="unterminated`} {
+		_, err := parseRecord(line, defaultKeys)
+		require.ErrorIs(t, err, errMalformed, line)
+	}
+}
+
+func TestRecordDecrypt(t *testing.T) {
+	t.Parallel()
+
+	kr := logger.NewKeyRing()
+	require.NoError(t, kr.Rotate("k1", bytes.Repeat([]byte{1}, 32)))
+
+	for _, format := range []string{"text", "json"} {
+		buf := &bytes.Buffer{}
+		h := logger.NewEncryptHandler(logger.NewTraceHandler(buf, format, "info"), kr, "email")
+		slog.New(h).Info("signup", "email", "a b@example.com")
+
+		rec, err := parseRecord(buf.String(), defaultKeys)
+		require.NoError(t, err)
+
+		rec.decrypt(kr)
+
+		v, _ := rec.lookup("email")
+		require.Equal(t, "a b@example.com", v)
+
+		again, err := parseRecord(rec.raw, defaultKeys)
+		require.NoError(t, err)
+		require.Equal(t, rec.fields, again.fields)
+	}
+}
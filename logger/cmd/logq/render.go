@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ANSI color codes used by the pretty renderer.
+const (
+	colorReset  = "\033[0m"
+	colorGray   = "\033[90m"
+	colorBlue   = "\033[34m"
+	colorCyan   = "\033[36m"
+	colorYellow = "\033[33m"
+	colorRed    = "\033[31m"
+)
+
+// renderer writes records to an output.
+type renderer struct {
+	out    io.Writer
+	pretty bool
+	color  bool
+	keys   keys
+}
+
+// render writes rec, either as its original line or in the pretty console format.
+func (r *renderer) render(rec *record) error {
+	if !r.pretty {
+		_, err := fmt.Fprintln(r.out, rec.raw)
+		return err
+	}
+
+	var b strings.Builder
+
+	if !rec.time.IsZero() {
+		b.WriteString(r.paint(colorGray, rec.time.Format("2006-01-02 15:04:05.000")))
+		b.WriteByte(' ')
+	}
+
+	b.WriteString(r.paint(levelColor(rec.level), fmt.Sprintf("%-5s", rec.level)))
+	b.WriteByte(' ')
+	b.WriteString(rec.msg)
+
+	for _, f := range rec.fields {
+		if f.key == r.keys.time || f.key == r.keys.level || f.key == r.keys.msg {
+			continue
+		}
+
+		b.WriteByte(' ')
+		b.WriteString(r.paint(colorCyan, f.key+"="))
+		b.WriteString(quoteValue(f.value))
+	}
+
+	_, err := fmt.Fprintln(r.out, b.String())
+
+	return err
+}
+
+// renderTimelines groups records by trace ID, orders each timeline by time and
+// writes them ordered by their first record. Records without a trace ID come last.
+func (r *renderer) renderTimelines(records []*record) error {
+	byTrace := make(map[string][]*record)
+
+	var order []string
+
+	for _, rec := range records {
+		if _, ok := byTrace[rec.trace]; !ok {
+			order = append(order, rec.trace)
+		}
+
+		byTrace[rec.trace] = append(byTrace[rec.trace], rec)
+	}
+
+	for _, id := range order {
+		slices.SortStableFunc(byTrace[id], func(a, b *record) int {
+			return a.time.Compare(b.time)
+		})
+	}
+
+	slices.SortStableFunc(order, func(a, b string) int {
+		if (a == "") != (b == "") {
+			if a == "" {
+				return 1
+			}
+
+			return -1
+		}
+
+		return byTrace[a][0].time.Compare(byTrace[b][0].time)
+	})
+
+	for i, id := range order {
+		if i > 0 {
+			if _, err := fmt.Fprintln(r.out); err != nil {
+				return err
+			}
+		}
+
+		if _, err := fmt.Fprintln(r.out, r.paint(colorBlue, timelineHeader(id, byTrace[id]))); err != nil {
+			return err
+		}
+
+		for _, rec := range byTrace[id] {
+			if err := r.render(rec); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (r *renderer) paint(color, s string) string {
+	if !r.color {
+		return s
+	}
+
+	return color + s + colorReset
+}
+
+// timelineHeader describes a timeline with its trace ID, size and time span.
+func timelineHeader(id string, records []*record) string {
+	if id == "" {
+		id = "(no trace)"
+	}
+
+	first, last := records[0].time, records[len(records)-1].time
+
+	var span time.Duration
+	if !first.IsZero() && !last.IsZero() {
+		span = last.Sub(first)
+	}
+
+	return fmt.Sprintf("== trace %s: %d records over %s", id, len(records), span)
+}
+
+func levelColor(level string) string {
+	l, ok := parseLevel(level)
+
+	switch {
+	case !ok:
+		return colorReset
+	case l >= 8:
+		return colorRed
+	case l >= 4:
+		return colorYellow
+	case l >= 0:
+		return colorBlue
+	default:
+		return colorGray
+	}
+}
+
+func quoteValue(v string) string {
+	if v == "" || strings.ContainsAny(v, " =\"") || !strconv.CanBackquote(v) {
+		return strconv.Quote(v)
+	}
+
+	return v
+}
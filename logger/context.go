@@ -0,0 +1,52 @@
+package logger
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+)
+
+// loggerKey is the context key used to store a request-scoped logger.
+type loggerKey struct{}
+
+// defaultLogger holds the logger returned by FromContext when the context carries none.
+var defaultLogger atomic.Pointer[slog.Logger]
+
+// SetDefault sets the logger returned by FromContext when the context
+// does not carry a logger. Passing nil restores the slog.Default fallback.
+func SetDefault(l *slog.Logger) {
+	defaultLogger.Store(l)
+}
+
+// Default returns the logger configured with SetDefault, or slog.Default()
+// if none has been configured.
+func Default() *slog.Logger {
+	if l := defaultLogger.Load(); l != nil {
+		return l
+	}
+
+	return slog.Default()
+}
+
+// IntoContext returns a copy of ctx carrying the given logger.
+//
+// Example usage:
+//
+//	ctx = logger.IntoContext(ctx, l.With("userID", id))
+func IntoContext(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// FromContext returns the logger stored in ctx by IntoContext.
+// If ctx carries no logger, it falls back to Default().
+//
+// Example usage:
+//
+//	logger.FromContext(r.Context()).Info("order created", "orderID", id)
+func FromContext(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok && l != nil {
+		return l
+	}
+
+	return Default()
+}
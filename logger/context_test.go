@@ -0,0 +1,34 @@
+package logger_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/paccolamano/goshare/logger"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFromContext(t *testing.T) {
+	t.Parallel()
+
+	buf := &bytes.Buffer{}
+	l := slog.New(logger.NewTraceHandler(buf, "text", "info"))
+
+	ctx := logger.IntoContext(t.Context(), l.With("scope", "request"))
+	logger.FromContext(ctx).Info("hello world")
+
+	require.Contains(t, buf.String(), "scope=request")
+}
+
+func TestFromContextFallback(t *testing.T) {
+	require.Same(t, slog.Default(), logger.FromContext(context.Background()))
+
+	l := slog.New(logger.NewTraceHandler(&bytes.Buffer{}, "text", "info"))
+
+	logger.SetDefault(l)
+	t.Cleanup(func() { logger.SetDefault(nil) })
+
+	require.Same(t, l, logger.FromContext(context.Background()))
+}
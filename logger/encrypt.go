@@ -0,0 +1,316 @@
+package logger
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// encryptedPrefix marks attribute values encrypted by EncryptHandler.
+// Encrypted values have the form "enc:v1:<keyID>:<base64url(nonce|ciphertext)>".
+const encryptedPrefix = "enc:v1:"
+
+// encryptionFailed replaces attribute values that could not be encrypted,
+// so that plaintext never reaches the output.
+const encryptionFailed = "!ENCRYPTION_FAILED"
+
+var (
+	// ErrKeyNotFound is returned when a key ID is unknown to the KeyProvider.
+	ErrKeyNotFound = errors.New("logger: encryption key not found")
+	// ErrInvalidKeyID is returned when a key ID contains unsupported characters.
+	ErrInvalidKeyID = errors.New("logger: invalid encryption key id")
+	// ErrNotEncrypted is returned when decrypting a value that was not produced by EncryptValue.
+	ErrNotEncrypted = errors.New("logger: value is not encrypted")
+)
+
+var keyIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// KeyProvider supplies the AES keys used to encrypt and decrypt attribute values.
+// Implementations must be safe for concurrent use.
+type KeyProvider interface {
+	// CurrentKey returns the ID and value of the key used to encrypt new values.
+	CurrentKey() (id string, key []byte, err error)
+
+	// Key returns the key with the given ID, used to decrypt values.
+	Key(id string) ([]byte, error)
+}
+
+// KeyRing is an in-memory KeyProvider supporting key rotation.
+// Rotated keys stay available for decryption.
+type KeyRing struct {
+	mu      sync.RWMutex
+	keys    map[string][]byte
+	current string
+}
+
+// NewKeyRing creates an empty KeyRing.
+func NewKeyRing() *KeyRing {
+	return &KeyRing{keys: make(map[string][]byte)}
+}
+
+// Add registers a key under id without making it current.
+// The key must be 16, 24 or 32 bytes long to select AES-128, AES-192 or AES-256.
+func (k *KeyRing) Add(id string, key []byte) error {
+	if !keyIDPattern.MatchString(id) {
+		return fmt.Errorf("%w: %q", ErrInvalidKeyID, id)
+	}
+
+	if _, err := aes.NewCipher(key); err != nil {
+		return fmt.Errorf("logger: key %q: %w", id, err)
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.keys[id] = slices.Clone(key)
+
+	return nil
+}
+
+// Rotate registers a key under id and makes it the current encryption key.
+func (k *KeyRing) Rotate(id string, key []byte) error {
+	if err := k.Add(id, key); err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.current = id
+
+	return nil
+}
+
+// CurrentKey returns the ID and value of the current encryption key.
+func (k *KeyRing) CurrentKey() (string, []byte, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	key, ok := k.keys[k.current]
+	if !ok {
+		return "", nil, ErrKeyNotFound
+	}
+
+	return k.current, key, nil
+}
+
+// Key returns the key registered under id.
+func (k *KeyRing) Key(id string) ([]byte, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	key, ok := k.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrKeyNotFound, id)
+	}
+
+	return key, nil
+}
+
+// EncryptValue encrypts plaintext with the current key of kp using AES-GCM.
+// The returned value embeds the key ID, so it can be decrypted after rotation.
+func EncryptValue(kp KeyProvider, plaintext string) (string, error) {
+	id, key, err := kp.CurrentKey()
+	if err != nil {
+		return "", err
+	}
+
+	aead, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	header := encryptedPrefix + id + ":"
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("logger: generate nonce: %w", err)
+	}
+
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), []byte(header))
+
+	return header + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptValue recovers the plaintext of a value produced by EncryptValue,
+// looking up the key by the ID embedded in the value.
+//
+// Example usage:
+//
+//	email, err := logger.DecryptValue(keyring, record["email"].(string))
+func DecryptValue(kp KeyProvider, value string) (string, error) {
+	if !IsEncrypted(value) {
+		return "", ErrNotEncrypted
+	}
+
+	i := strings.LastIndexByte(value, ':')
+	header, payload := value[:i+1], value[i+1:]
+	id := header[len(encryptedPrefix) : len(header)-1]
+
+	key, err := kp.Key(id)
+	if err != nil {
+		return "", err
+	}
+
+	aead, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("logger: malformed encrypted value: %w", ErrNotEncrypted)
+	}
+
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(header))
+	if err != nil {
+		return "", fmt.Errorf("logger: decrypt value: %w", err)
+	}
+
+	return string(plaintext), nil
+}
+
+// IsEncrypted reports whether value looks like a value produced by EncryptValue.
+func IsEncrypted(value string) bool {
+	rest, ok := strings.CutPrefix(value, encryptedPrefix)
+	if !ok {
+		return false
+	}
+
+	id, _, ok := strings.Cut(rest, ":")
+
+	return ok && keyIDPattern.MatchString(id)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("logger: create cipher: %w", err)
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// EncryptHandler wraps slog.Handler and encrypts the values of selected
+// attributes before delegating to the wrapped handler.
+type EncryptHandler struct {
+	slog.Handler
+
+	keys   KeyProvider
+	fields map[string]struct{}
+	groups []string
+}
+
+// NewEncryptHandler creates a new EncryptHandler around h.
+//
+// Parameters:
+//   - h: the wrapped handler, typically a TraceHandler.
+//   - kp: the KeyProvider supplying encryption keys.
+//   - fields: the attributes to encrypt, matched either by key (e.g. "email")
+//     or by dotted path including groups (e.g. "customer.email").
+//
+// Values are encrypted with AES-GCM and rendered as strings. If encryption fails,
+// the value is replaced with "!ENCRYPTION_FAILED" so plaintext is never written.
+//
+// Example usage:
+//
+//	h := logger.NewEncryptHandler(logger.NewTraceHandler(os.Stdout, "json", "info"), keyring, "email", "ip")
+func NewEncryptHandler(h slog.Handler, kp KeyProvider, fields ...string) *EncryptHandler {
+	set := make(map[string]struct{}, len(fields))
+	for _, f := range fields {
+		set[f] = struct{}{}
+	}
+
+	return &EncryptHandler{Handler: h, keys: kp, fields: set}
+}
+
+// Handle encrypts the selected attributes of r and delegates
+// the log handling to the wrapped slog.Handler.
+func (h *EncryptHandler) Handle(ctx context.Context, r slog.Record) error {
+	nr := slog.NewRecord(r.Time, r.Level, r.Message, r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		nr.AddAttrs(h.encryptAttr(h.groups, a))
+		return true
+	})
+
+	return h.Handler.Handle(ctx, nr)
+}
+
+// WithAttrs returns a new EncryptHandler whose attributes consists
+// of h's attributes followed by attrs, encrypted where selected.
+func (h *EncryptHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	encrypted := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		encrypted[i] = h.encryptAttr(h.groups, a)
+	}
+
+	return &EncryptHandler{Handler: h.Handler.WithAttrs(encrypted), keys: h.keys, fields: h.fields, groups: h.groups}
+}
+
+// WithGroup returns a new EncryptHandler that nests all following attributes
+// under the given group name.
+func (h *EncryptHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
+	return &EncryptHandler{
+		Handler: h.Handler.WithGroup(name),
+		keys:    h.keys,
+		fields:  h.fields,
+		groups:  append(slices.Clip(h.groups), name),
+	}
+}
+
+func (h *EncryptHandler) encryptAttr(groups []string, a slog.Attr) slog.Attr {
+	a.Value = a.Value.Resolve()
+
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			groups = append(slices.Clip(groups), a.Key)
+		}
+
+		attrs := a.Value.Group()
+		encrypted := make([]slog.Attr, len(attrs))
+
+		for i, ga := range attrs {
+			encrypted[i] = h.encryptAttr(groups, ga)
+		}
+
+		return slog.Attr{Key: a.Key, Value: slog.GroupValue(encrypted...)}
+	}
+
+	if !h.selected(groups, a.Key) {
+		return a
+	}
+
+	v, err := EncryptValue(h.keys, a.Value.String())
+	if err != nil {
+		return slog.String(a.Key, encryptionFailed)
+	}
+
+	return slog.String(a.Key, v)
+}
+
+func (h *EncryptHandler) selected(groups []string, key string) bool {
+	if _, ok := h.fields[key]; ok {
+		return true
+	}
+
+	if len(groups) == 0 {
+		return false
+	}
+
+	_, ok := h.fields[strings.Join(groups, ".")+"."+key]
+
+	return ok
+}
@@ -0,0 +1,96 @@
+package logger_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/paccolamano/goshare/logger"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestKeyRing(t *testing.T) *logger.KeyRing {
+	t.Helper()
+
+	kr := logger.NewKeyRing()
+	require.NoError(t, kr.Rotate("k1", bytes.Repeat([]byte{1}, 32)))
+
+	return kr
+}
+
+func TestEncryptHandler(t *testing.T) {
+	t.Parallel()
+
+	kr := newTestKeyRing(t)
+
+	buf := &bytes.Buffer{}
+	h := logger.NewEncryptHandler(logger.NewTraceHandler(buf, "json", "info"), kr, "email", "customer.ip")
+	l := slog.New(h).With("email", "a@example.com").WithGroup("customer")
+
+	l.Info("hello world", "ip", "10.0.0.1", "name", "alice", slog.Group("contact", "email", "b@example.com"))
+
+	out := buf.String()
+	require.NotContains(t, out, "a@example.com")
+	require.NotContains(t, out, "b@example.com")
+	require.NotContains(t, out, "10.0.0.1")
+	require.Contains(t, out, `"name":"alice"`)
+
+	var rec struct {
+		Email    string `json:"email"`
+		Customer struct {
+			IP      string `json:"ip"`
+			Contact struct {
+				Email string `json:"email"`
+			} `json:"contact"`
+		} `json:"customer"`
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &rec))
+
+	for enc, expected := range map[string]string{
+		rec.Email:                  "a@example.com",
+		rec.Customer.IP:            "10.0.0.1",
+		rec.Customer.Contact.Email: "b@example.com",
+	} {
+		require.True(t, logger.IsEncrypted(enc))
+
+		v, err := logger.DecryptValue(kr, enc)
+		require.NoError(t, err)
+		require.Equal(t, expected, v)
+	}
+}
+
+func TestEncryptValueKeyRotation(t *testing.T) {
+	t.Parallel()
+
+	kr := newTestKeyRing(t)
+
+	old, err := logger.EncryptValue(kr, "secret")
+	require.NoError(t, err)
+
+	require.NoError(t, kr.Rotate("k2", bytes.Repeat([]byte{2}, 16)))
+
+	v, err := logger.DecryptValue(kr, old)
+	require.NoError(t, err)
+	require.Equal(t, "secret", v)
+
+	_, err = logger.DecryptValue(logger.NewKeyRing(), old)
+	require.ErrorIs(t, err, logger.ErrKeyNotFound)
+
+	_, err = logger.DecryptValue(kr, "plain")
+	require.ErrorIs(t, err, logger.ErrNotEncrypted)
+
+	require.ErrorIs(t, kr.Add("bad:id", bytes.Repeat([]byte{1}, 32)), logger.ErrInvalidKeyID)
+}
+
+func TestEncryptHandlerWithoutKey(t *testing.T) {
+	t.Parallel()
+
+	buf := &bytes.Buffer{}
+	h := logger.NewEncryptHandler(logger.NewTraceHandler(buf, "text", "info"), logger.NewKeyRing(), "email")
+
+	slog.New(h).Info("hello world", "email", "a@example.com")
+
+	require.NotContains(t, buf.String(), "a@example.com")
+	require.Contains(t, buf.String(), "email=!ENCRYPTION_FAILED")
+}
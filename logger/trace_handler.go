@@ -2,8 +2,13 @@ package logger
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // contextKey is a custom type to avoid context key collisions.
@@ -13,9 +18,180 @@ type contextKey string
 // If present, the trace ID will be included as a log attribute.
 const TraceIDKey contextKey = "traceUUID"
 
+// SubjectKey is the context key used to store and retrieve the authenticated
+// subject of a request. If present, the subject will be included as a log attribute.
+const SubjectKey contextKey = "subject"
+
+// Additional log levels recognized by TraceHandler, besides the slog ones.
+const (
+	// LevelTrace is a level more verbose than slog.LevelDebug.
+	LevelTrace slog.Level = -8
+	// LevelFatal is a level more severe than slog.LevelError.
+	LevelFatal slog.Level = 12
+)
+
+// defaultLevelNames holds the names used for levels not known to slog.
+var defaultLevelNames = map[slog.Level]string{
+	LevelTrace: "TRACE",
+	LevelFatal: "FATAL",
+}
+
+// dupGroupKey is the group key under which duplicated attributes are
+// nested when DedupNest is in use.
+const dupGroupKey = "_dup"
+
+// DedupPolicy selects how TraceHandler resolves attributes sharing the same key
+// at the same group level.
+type DedupPolicy int
+
+const (
+	// DedupNone disables deduplication: attributes are emitted as they are added.
+	DedupNone DedupPolicy = iota
+	// DedupKeepFirst keeps the first attribute for a key and drops the others.
+	DedupKeepFirst
+	// DedupKeepLast keeps the value of the last attribute for a key,
+	// emitted at the position of the first one.
+	DedupKeepLast
+	// DedupSuffix keeps every attribute, renaming duplicates to key_1, key_2, ...
+	DedupSuffix
+	// DedupNest keeps the first attribute for a key and moves the duplicates
+	// under a "_dup" group at the same level.
+	DedupNest
+)
+
+// TraceHandlerOptions holds configuration options for the TraceHandler.
+type TraceHandlerOptions struct {
+	Dedup DedupPolicy
+
+	TimeKey      string
+	TimeFormat   string
+	TimeLocation *time.Location
+
+	LevelKey   string
+	LevelNames map[slog.Level]string
+
+	MessageKey string
+
+	AddSource      bool
+	SourceKey      string
+	SourceRoot     string
+	SourceFunction bool
+
+	ReplaceAttr func(groups []string, a slog.Attr) slog.Attr
+}
+
+// TraceHandlerOption represents a functional option for configuring the TraceHandler.
+type TraceHandlerOption func(*TraceHandlerOptions)
+
+// WithDedup enables attribute deduplication with the given policy.
+// Deduplication is applied across WithAttrs, groups and per-record attributes.
+func WithDedup(p DedupPolicy) TraceHandlerOption {
+	return func(opt *TraceHandlerOptions) {
+		opt.Dedup = p
+	}
+}
+
+// WithTimeKey sets the key used for the record time instead of "time".
+func WithTimeKey(key string) TraceHandlerOption {
+	return func(opt *TraceHandlerOptions) {
+		opt.TimeKey = key
+	}
+}
+
+// WithTimeFormat sets the layout used to format the record time,
+// for instance time.RFC3339Nano.
+func WithTimeFormat(layout string) TraceHandlerOption {
+	return func(opt *TraceHandlerOptions) {
+		opt.TimeFormat = layout
+	}
+}
+
+// WithTimeLocation converts the record time to the given location,
+// for instance time.UTC, before formatting it.
+func WithTimeLocation(loc *time.Location) TraceHandlerOption {
+	return func(opt *TraceHandlerOptions) {
+		opt.TimeLocation = loc
+	}
+}
+
+// WithLevelKey sets the key used for the record level instead of "level".
+func WithLevelKey(key string) TraceHandlerOption {
+	return func(opt *TraceHandlerOptions) {
+		opt.LevelKey = key
+	}
+}
+
+// WithLevelNames sets custom names for log levels.
+// Levels missing from names keep their default name.
+func WithLevelNames(names map[slog.Level]string) TraceHandlerOption {
+	return func(opt *TraceHandlerOptions) {
+		opt.LevelNames = names
+	}
+}
+
+// WithMessageKey sets the key used for the record message instead of "msg".
+func WithMessageKey(key string) TraceHandlerOption {
+	return func(opt *TraceHandlerOptions) {
+		opt.MessageKey = key
+	}
+}
+
+// WithAddSource enables or disables source file information,
+// regardless of the configured level.
+func WithAddSource(enabled bool) TraceHandlerOption {
+	return func(opt *TraceHandlerOptions) {
+		opt.AddSource = enabled
+	}
+}
+
+// WithSourceKey sets the key used for the source file information instead of "source".
+func WithSourceKey(key string) TraceHandlerOption {
+	return func(opt *TraceHandlerOptions) {
+		opt.SourceKey = key
+	}
+}
+
+// WithSourceRoot trims the given root directory (typically the module root)
+// from source file paths, rendering the source as "path/file.go:line".
+func WithSourceRoot(root string) TraceHandlerOption {
+	return func(opt *TraceHandlerOptions) {
+		opt.SourceRoot = root
+	}
+}
+
+// WithSourceFunction appends the function name to the source,
+// rendering it as "path/file.go:line pkg.Function".
+func WithSourceFunction(enabled bool) TraceHandlerOption {
+	return func(opt *TraceHandlerOptions) {
+		opt.SourceFunction = enabled
+	}
+}
+
+// WithReplaceAttr sets a function applied to every attribute after
+// the built-in key and format customizations.
+func WithReplaceAttr(f func(groups []string, a slog.Attr) slog.Attr) TraceHandlerOption {
+	return func(opt *TraceHandlerOptions) {
+		opt.ReplaceAttr = f
+	}
+}
+
 // TraceHandler wraps slog.Handler and injects the trace ID from context into log records.
 type TraceHandler struct {
 	slog.Handler
+
+	dedup DedupPolicy
+	goas  []groupOrAttrs
+
+	// grouped reports whether a group was opened on the wrapped handler,
+	// when deduplication is disabled.
+	grouped bool
+}
+
+// groupOrAttrs holds either a group name or a list of attributes
+// collected through WithGroup and WithAttrs when deduplication is enabled.
+type groupOrAttrs struct {
+	group string
+	attrs []slog.Attr
 }
 
 // NewTraceHandler creates a new Handler with the given output writer, format, and log level.
@@ -23,54 +199,366 @@ type TraceHandler struct {
 // Parameters:
 //   - out: the io.Writer where logs will be written.
 //   - format: output format, either "text" or "json" (default is "text").
-//   - level: log level string, can be "debug", "warn", "error" or any other value (default is "info").
+//   - level: log level string, can be "trace", "debug", "warn", "error", "fatal"
+//     or any other value (default is "info").
+//   - opts: optional functional options, such as WithDedup or WithTimeKey.
 //
 // Returns:
 //   - A Handler that wraps the appropriate slog.Handler with the specified configuration.
 //
 // If the format is "json", the handler will output logs in JSON format.
 // The log level controls the minimum level of logs emitted.
-// If level is "debug", the handler will also include source file information.
-func NewTraceHandler(out io.Writer, format string, level string) *TraceHandler {
-	opts := &slog.HandlerOptions{Level: slog.LevelInfo}
+// If level is "trace" or "debug", the handler will also include source file information,
+// unless disabled with WithAddSource.
+// Key, time and source customizations apply to both text and json formats.
+func NewTraceHandler(out io.Writer, format string, level string, opts ...TraceHandlerOption) *TraceHandler {
+	options := &TraceHandlerOptions{
+		AddSource: level == "trace" || level == "debug",
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	hopts := &slog.HandlerOptions{
+		Level:       slog.LevelInfo,
+		AddSource:   options.AddSource,
+		ReplaceAttr: options.replaceAttr,
+	}
 
 	switch level {
+	case "trace":
+		hopts.Level = LevelTrace
 	case "debug":
-		opts.Level = slog.LevelDebug
-		opts.AddSource = true
+		hopts.Level = slog.LevelDebug
 	case "warn":
-		opts.Level = slog.LevelWarn
+		hopts.Level = slog.LevelWarn
 	case "error":
-		opts.Level = slog.LevelError
+		hopts.Level = slog.LevelError
+	case "fatal":
+		hopts.Level = LevelFatal
 	}
 
-	handler := &TraceHandler{Handler: slog.NewTextHandler(out, opts)}
+	handler := &TraceHandler{Handler: slog.NewTextHandler(out, hopts), dedup: options.Dedup}
 	if format == "json" {
-		handler.Handler = slog.NewJSONHandler(out, opts)
+		handler.Handler = slog.NewJSONHandler(out, hopts)
 	}
 
 	return handler
 }
 
-// Handle adds the trace ID from the context to the log record (if available)
-// and delegates the log handling to the wrapped slog.Handler.
+// Handle adds the trace ID and the subject from the context to the log record
+// (if available) and delegates the log handling to the wrapped slog.Handler.
 //
 // Parameters:
-//   - ctx: context potentially containing a trace ID under TraceIDKey.
+//   - ctx: context potentially containing a trace ID under TraceIDKey and a subject under SubjectKey.
 //   - r: the slog.Record to be handled.
 //
 // Returns:
 //   - An error if the underlying handler returns an error.
 func (h *TraceHandler) Handle(ctx context.Context, r slog.Record) error {
+	if h.dedup == DedupNone {
+		if !h.grouped {
+			r = markRecordAttrs(r)
+		}
+
+		r.AddAttrs(contextAttrs(ctx, nil)...)
+
+		return h.Handler.Handle(ctx, r)
+	}
+
+	attrs := make([]slog.Attr, 0, r.NumAttrs()+2)
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+
+	attrs = contextAttrs(ctx, attrs)
+
+	for i := len(h.goas) - 1; i >= 0; i-- {
+		if g := h.goas[i]; g.group != "" {
+			attrs = []slog.Attr{{Key: g.group, Value: slog.GroupValue(attrs...)}}
+		} else {
+			attrs = append(slices.Clip(g.attrs), attrs...)
+		}
+	}
+
+	nr := slog.NewRecord(r.Time, r.Level, r.Message, r.PC)
+	attrs, _ = markUserAttrs(dedupAttrs(attrs, h.dedup))
+	nr.AddAttrs(attrs...)
+
+	return h.Handler.Handle(ctx, nr)
+}
+
+// markRecordAttrs returns r, or a copy of r with its attributes marked by
+// markUserAttrs when one of them is named like a built-in attribute.
+func markRecordAttrs(r slog.Record) slog.Record {
+	attrs := make([]slog.Attr, 0, r.NumAttrs())
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+
+	marked, ok := markUserAttrs(attrs)
+	if !ok {
+		return r
+	}
+
+	nr := slog.NewRecord(r.Time, r.Level, r.Message, r.PC)
+	nr.AddAttrs(marked...)
+
+	return nr
+}
+
+// contextAttrs appends to attrs the trace ID and subject attributes found in ctx.
+func contextAttrs(ctx context.Context, attrs []slog.Attr) []slog.Attr {
 	if v, ok := ctx.Value(TraceIDKey).(string); ok {
-		r.AddAttrs(slog.String("traceUUID", v))
+		attrs = append(attrs, slog.String("traceUUID", v))
 	}
 
-	return h.Handler.Handle(ctx, r)
+	if v, ok := ctx.Value(SubjectKey).(string); ok {
+		attrs = append(attrs, slog.String("subject", v))
+	}
+
+	return attrs
 }
 
 // WithAttrs returns a new TraceHandler whose attributes consists
 // of h's attributes followed by attrs.
 func (h *TraceHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
-	return &TraceHandler{Handler: h.Handler.WithAttrs(attrs)}
+	if len(attrs) == 0 {
+		return h
+	}
+
+	if h.dedup == DedupNone {
+		if !h.grouped {
+			attrs, _ = markUserAttrs(attrs)
+		}
+
+		return &TraceHandler{Handler: h.Handler.WithAttrs(attrs), grouped: h.grouped}
+	}
+
+	return h.withGroupOrAttrs(groupOrAttrs{attrs: attrs})
+}
+
+// WithGroup returns a new TraceHandler that nests all following attributes
+// under the given group name, preserving trace ID injection.
+func (h *TraceHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
+	if h.dedup == DedupNone {
+		return &TraceHandler{Handler: h.Handler.WithGroup(name), grouped: true}
+	}
+
+	return h.withGroupOrAttrs(groupOrAttrs{group: name})
+}
+
+func (h *TraceHandler) withGroupOrAttrs(goa groupOrAttrs) *TraceHandler {
+	return &TraceHandler{
+		Handler: h.Handler,
+		dedup:   h.dedup,
+		goas:    append(slices.Clip(h.goas), goa),
+	}
+}
+
+// replaceAttr renames and formats the built-in attributes according to o,
+// then applies the user supplied ReplaceAttr function, if any.
+func (o *TraceHandlerOptions) replaceAttr(groups []string, a slog.Attr) slog.Attr {
+	if v, ok := a.Value.Any().(userAttrValue); ok && a.Value.Kind() == slog.KindAny {
+		// User attributes named like the built-in ones keep their key and value.
+		a.Value = v.Value
+	} else if len(groups) == 0 {
+		switch a.Key {
+		case slog.TimeKey:
+			a = o.replaceTime(a)
+		case slog.LevelKey:
+			a = o.replaceLevel(a)
+		case slog.MessageKey:
+			if o.MessageKey != "" {
+				a.Key = o.MessageKey
+			}
+		case slog.SourceKey:
+			a = o.replaceSource(a)
+		}
+	}
+
+	if o.ReplaceAttr != nil {
+		return o.ReplaceAttr(groups, a)
+	}
+
+	return a
+}
+
+// userAttrValue wraps the values of top-level user attributes named like the
+// built-in ones, so that replaceAttr does not rename nor format them.
+type userAttrValue struct {
+	slog.Value
+}
+
+// markUserAttrs returns attrs, or a copy of attrs in which the values of the
+// attributes named like the built-in ones are wrapped in a userAttrValue. Group
+// values are left as is, since they are not given to replaceAttr. The boolean
+// reports whether a copy was made.
+func markUserAttrs(attrs []slog.Attr) ([]slog.Attr, bool) {
+	marked := false
+	for i, a := range attrs {
+		switch a.Key {
+		case slog.TimeKey, slog.LevelKey, slog.MessageKey, slog.SourceKey:
+			if v := a.Value.Resolve(); v.Kind() != slog.KindGroup {
+				if !marked {
+					attrs, marked = slices.Clone(attrs), true
+				}
+
+				attrs[i].Value = slog.AnyValue(userAttrValue{v})
+			}
+		}
+	}
+
+	return attrs, marked
+}
+
+func (o *TraceHandlerOptions) replaceTime(a slog.Attr) slog.Attr {
+	if o.TimeKey != "" {
+		a.Key = o.TimeKey
+	}
+
+	if a.Value.Kind() != slog.KindTime {
+		return a
+	}
+
+	t := a.Value.Time()
+	if o.TimeLocation != nil {
+		t = t.In(o.TimeLocation)
+		a.Value = slog.TimeValue(t)
+	}
+
+	if o.TimeFormat != "" {
+		a.Value = slog.StringValue(t.Format(o.TimeFormat))
+	}
+
+	return a
+}
+
+func (o *TraceHandlerOptions) replaceLevel(a slog.Attr) slog.Attr {
+	if o.LevelKey != "" {
+		a.Key = o.LevelKey
+	}
+
+	l, ok := a.Value.Any().(slog.Level)
+	if !ok {
+		return a
+	}
+
+	if name, ok := o.LevelNames[l]; ok {
+		a.Value = slog.StringValue(name)
+	} else if name, ok := defaultLevelNames[l]; ok {
+		a.Value = slog.StringValue(name)
+	}
+
+	return a
+}
+
+func (o *TraceHandlerOptions) replaceSource(a slog.Attr) slog.Attr {
+	if o.SourceKey != "" {
+		a.Key = o.SourceKey
+	}
+
+	src, ok := a.Value.Any().(*slog.Source)
+	if !ok || (o.SourceRoot == "" && !o.SourceFunction) {
+		return a
+	}
+
+	file := src.File
+	if o.SourceRoot != "" {
+		// Only whole directories are trimmed: root /src/app leaves /src/app2/x.go untouched.
+		if rel, ok := strings.CutPrefix(file, strings.TrimSuffix(o.SourceRoot, "/")+"/"); ok {
+			file = rel
+		}
+	}
+
+	s := file + ":" + strconv.Itoa(src.Line)
+	if o.SourceFunction && src.Function != "" {
+		s += " " + src.Function[strings.LastIndex(src.Function, "/")+1:]
+	}
+
+	a.Value = slog.StringValue(s)
+
+	return a
+}
+
+// dedupAttrs resolves key collisions among attrs according to policy p.
+// Inline groups are flattened into the current level and nested groups
+// are deduplicated recursively.
+func dedupAttrs(attrs []slog.Attr, p DedupPolicy) []slog.Attr {
+	flat := flattenAttrs(attrs, p)
+
+	out := make([]slog.Attr, 0, len(flat))
+	seen := make(map[string]int, len(flat))
+
+	var dups []slog.Attr
+
+	for _, a := range flat {
+		i, dup := seen[a.Key]
+		if !dup {
+			seen[a.Key] = len(out)
+			out = append(out, a)
+
+			continue
+		}
+
+		switch p {
+		case DedupKeepLast:
+			out[i].Value = a.Value
+		case DedupSuffix:
+			key := uniqueKey(a.Key, seen)
+			seen[key] = len(out)
+			out = append(out, slog.Attr{Key: key, Value: a.Value})
+		case DedupNest:
+			dups = append(dups, a)
+		}
+	}
+
+	if len(dups) > 0 {
+		key := dupGroupKey
+		if _, ok := seen[key]; ok {
+			key = uniqueKey(key, seen)
+		}
+
+		out = append(out, slog.Attr{Key: key, Value: slog.GroupValue(dedupAttrs(dups, DedupSuffix)...)})
+	}
+
+	return out
+}
+
+// uniqueKey returns the first key of the form key_N not present in seen.
+func uniqueKey(key string, seen map[string]int) string {
+	for n := 1; ; n++ {
+		k := fmt.Sprintf("%s_%d", key, n)
+		if _, ok := seen[k]; !ok {
+			return k
+		}
+	}
+}
+
+// flattenAttrs resolves attrs values, inlines groups with an empty key
+// and deduplicates the content of named groups according to policy p.
+func flattenAttrs(attrs []slog.Attr, p DedupPolicy) []slog.Attr {
+	flat := make([]slog.Attr, 0, len(attrs))
+
+	for _, a := range attrs {
+		a.Value = a.Value.Resolve()
+
+		switch {
+		case a.Value.Kind() != slog.KindGroup:
+			flat = append(flat, a)
+		case a.Key == "":
+			flat = append(flat, flattenAttrs(a.Value.Group(), p)...)
+		default:
+			flat = append(flat, slog.Attr{Key: a.Key, Value: slog.GroupValue(dedupAttrs(a.Value.Group(), p)...)})
+		}
+	}
+
+	return flat
 }
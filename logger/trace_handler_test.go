@@ -4,7 +4,10 @@ import (
 	"bytes"
 	"context"
 	"log/slog"
+	"os"
+	"runtime"
 	"testing"
+	"time"
 
 	"github.com/paccolamano/goshare/logger"
 	"github.com/stretchr/testify/require"
@@ -40,6 +43,21 @@ func TestHandlerTraceIDInjected(t *testing.T) {
 	}
 }
 
+func TestHandlerSubjectInjected(t *testing.T) {
+	t.Parallel()
+
+	for _, dedup := range []logger.DedupPolicy{logger.DedupNone, logger.DedupKeepFirst} {
+		buf := &bytes.Buffer{}
+		l := slog.New(logger.NewTraceHandler(buf, "json", "info", logger.WithDedup(dedup)))
+
+		ctx := context.WithValue(t.Context(), logger.TraceIDKey, "abc123")
+		ctx = context.WithValue(ctx, logger.SubjectKey, "user-42")
+		l.InfoContext(ctx, "hello world")
+
+		require.Contains(t, buf.String(), `"traceUUID":"abc123","subject":"user-42"`)
+	}
+}
+
 func TestHandlerDebugSuppressedAtInfo(t *testing.T) {
 	t.Parallel()
 
@@ -66,3 +84,177 @@ func TestHandlerDebugEmittedAtDebug(t *testing.T) {
 	require.NotEmpty(t, out)
 	require.Contains(t, out, msg)
 }
+
+func TestHandlerWithGroupKeepsTraceID(t *testing.T) {
+	t.Parallel()
+
+	buf := &bytes.Buffer{}
+	l := slog.New(logger.NewTraceHandler(buf, "json", "info")).WithGroup("req")
+
+	ctx := context.WithValue(t.Context(), logger.TraceIDKey, "abc123")
+	l.InfoContext(ctx, "hello world", "method", "GET")
+
+	require.Contains(t, buf.String(), `"req":{"method":"GET","traceUUID":"abc123"}`)
+}
+
+func TestHandlerDedup(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name     string
+		policy   logger.DedupPolicy
+		expected string
+	}{
+		{"none", logger.DedupNone, `"traceUUID":"attr","a":1,"a":2,"traceUUID":"ctx"`},
+		{"keep first", logger.DedupKeepFirst, `"traceUUID":"attr","a":1}`},
+		{"keep last", logger.DedupKeepLast, `"traceUUID":"ctx","a":2}`},
+		{"suffix", logger.DedupSuffix, `"traceUUID":"attr","a":1,"a_1":2,"traceUUID_1":"ctx"}`},
+		{"nest", logger.DedupNest, `"traceUUID":"attr","a":1,"_dup":{"a":2,"traceUUID":"ctx"}}`},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			buf := &bytes.Buffer{}
+			h := logger.NewTraceHandler(buf, "json", "info", logger.WithDedup(tc.policy))
+			l := slog.New(h).With("traceUUID", "attr", "a", 1)
+
+			ctx := context.WithValue(t.Context(), logger.TraceIDKey, "ctx")
+			l.InfoContext(ctx, "hello world", "a", 2)
+
+			require.Contains(t, buf.String(), tc.expected)
+		})
+	}
+}
+
+func TestHandlerDedupGroups(t *testing.T) {
+	t.Parallel()
+
+	buf := &bytes.Buffer{}
+	h := logger.NewTraceHandler(buf, "json", "info", logger.WithDedup(logger.DedupKeepLast))
+	l := slog.New(h).With("a", 1).WithGroup("g").With("b", 1)
+
+	l.Info("hello world", "b", 2, slog.Group("", "b", 3), slog.Group("n", "c", 1, "c", 2))
+
+	require.Contains(t, buf.String(), `"a":1,"g":{"b":3,"n":{"c":2}}}`)
+}
+
+func TestHandlerKeysAndFormats(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name     string
+		format   string
+		expected []string
+	}{
+		{"text format", "text", []string{
+			"@timestamp=2025-01-02T03:04:05.000000006Z",
+			"severity=FATAL",
+			"message=boom",
+			`src="trace_handler_test.go:`,
+			` logger_test.TestHandlerKeysAndFormats.func1"`,
+		}},
+		{"json format", "json", []string{
+			`"@timestamp":"2025-01-02T03:04:05.000000006Z"`,
+			`"severity":"FATAL"`,
+			`"message":"boom"`,
+			`"src":"trace_handler_test.go:`,
+			` logger_test.TestHandlerKeysAndFormats.func1"`,
+		}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			wd, err := os.Getwd()
+			require.NoError(t, err)
+
+			buf := &bytes.Buffer{}
+			h := logger.NewTraceHandler(buf, tc.format, "info",
+				logger.WithTimeKey("@timestamp"),
+				logger.WithTimeFormat(time.RFC3339Nano),
+				logger.WithTimeLocation(time.UTC),
+				logger.WithLevelKey("severity"),
+				logger.WithMessageKey("message"),
+				logger.WithAddSource(true),
+				logger.WithSourceKey("src"),
+				logger.WithSourceRoot(wd),
+				logger.WithSourceFunction(true),
+			)
+
+			pcs := [1]uintptr{}
+			runtime.Callers(1, pcs[:])
+
+			ts := time.Date(2025, 1, 2, 4, 4, 5, 6, time.FixedZone("CET", 3600))
+			r := slog.NewRecord(ts, logger.LevelFatal, "boom", pcs[0])
+			require.NoError(t, h.Handle(t.Context(), r))
+
+			out := buf.String()
+			for _, e := range tc.expected {
+				require.Contains(t, out, e)
+			}
+		})
+	}
+}
+
+func TestHandlerSourceRootBoundary(t *testing.T) {
+	t.Parallel()
+
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+
+	buf := &bytes.Buffer{}
+	h := logger.NewTraceHandler(buf, "json", "info",
+		logger.WithAddSource(true),
+		logger.WithSourceRoot(wd[:len(wd)-1]),
+	)
+
+	pcs := [1]uintptr{}
+	runtime.Callers(1, pcs[:])
+	require.NoError(t, h.Handle(t.Context(), slog.NewRecord(time.Now(), slog.LevelInfo, "boom", pcs[0])))
+
+	require.Contains(t, buf.String(), `"source":"`+wd+`/trace_handler_test.go:`)
+}
+
+func TestHandlerUserAttrsNamedLikeBuiltins(t *testing.T) {
+	t.Parallel()
+
+	for _, dedup := range []logger.DedupPolicy{logger.DedupNone, logger.DedupKeepFirst} {
+		buf := &bytes.Buffer{}
+		h := logger.NewTraceHandler(buf, "json", "info",
+			logger.WithDedup(dedup),
+			logger.WithLevelKey("severity"),
+			logger.WithMessageKey("message"),
+		)
+		l := slog.New(h).With("msg", "user message")
+
+		l.Info("hello world", "level", "user level", slog.Group("g", "level", "nested"))
+
+		out := buf.String()
+		require.Contains(t, out, `"severity":"INFO","message":"hello world"`)
+		require.Contains(t, out, `"msg":"user message"`)
+		require.Contains(t, out, `"level":"user level"`)
+		require.Contains(t, out, `"g":{"level":"nested"}`)
+	}
+}
+
+func TestHandlerTraceLevel(t *testing.T) {
+	t.Parallel()
+
+	buf := &bytes.Buffer{}
+	h := logger.NewTraceHandler(buf, "text", "trace",
+		logger.WithAddSource(false),
+		logger.WithLevelNames(map[slog.Level]string{slog.LevelInfo: "INFORMATION"}),
+	)
+	l := slog.New(h)
+
+	l.Log(t.Context(), logger.LevelTrace, "trace message")
+	l.Info("info message")
+
+	out := buf.String()
+	require.Contains(t, out, "level=TRACE")
+	require.Contains(t, out, "level=INFORMATION")
+	require.NotContains(t, out, "source=")
+}
@@ -0,0 +1,333 @@
+package middleware
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Predefined access log formats, using nginx log_format variables.
+const (
+	// CommonLogFormat is the NCSA Common Log Format.
+	CommonLogFormat = `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent`
+	// CombinedLogFormat is the NCSA Combined Log Format, as used by Apache and nginx.
+	CombinedLogFormat = CommonLogFormat + ` "$http_referer" "$http_user_agent"`
+)
+
+// DefaultW3CFields are the fields written by NewW3CAccessLog when none are given.
+var DefaultW3CFields = []string{
+	"date", "time", "c-ip", "cs-username", "cs-method", "cs-uri-stem", "cs-uri-query",
+	"sc-status", "sc-bytes", "cs-bytes", "time-taken", "cs(User-Agent)", "cs(Referer)",
+}
+
+// ErrUnknownLogVariable is returned when an access log format references an unknown variable or field.
+var ErrUnknownLogVariable = errors.New("middleware: unknown access log variable")
+
+// accessLogVariables maps nginx style variables to their value.
+var accessLogVariables = map[string]func(e *accessEntry) string{
+	"remote_addr":     func(e *accessEntry) string { return e.ip },
+	"remote_user":     func(e *accessEntry) string { u, _, _ := e.r.BasicAuth(); return u },
+	"time_local":      func(e *accessEntry) string { return e.start.Format("02/Jan/2006:15:04:05 -0700") },
+	"time_iso8601":    func(e *accessEntry) string { return e.start.Format(time.RFC3339) },
+	"request":         func(e *accessEntry) string { return e.r.Method + " " + e.r.RequestURI + " " + e.r.Proto },
+	"request_method":  func(e *accessEntry) string { return e.r.Method },
+	"request_uri":     func(e *accessEntry) string { return e.r.RequestURI },
+	"uri":             func(e *accessEntry) string { return e.r.URL.Path },
+	"args":            func(e *accessEntry) string { return e.r.URL.RawQuery },
+	"host":            func(e *accessEntry) string { return e.r.Host },
+	"server_protocol": func(e *accessEntry) string { return e.r.Proto },
+	"status":          func(e *accessEntry) string { return strconv.Itoa(e.rec.Status()) },
+	"body_bytes_sent": func(e *accessEntry) string { return strconv.FormatInt(e.rec.BytesWritten(), 10) },
+	"request_length":  func(e *accessEntry) string { return strconv.FormatInt(e.requestBytes(), 10) },
+	"request_time":    func(e *accessEntry) string { return strconv.FormatFloat(e.duration.Seconds(), 'f', 3, 64) },
+	"route":           func(e *accessEntry) string { return e.r.Pattern },
+	"trace_id":        func(e *accessEntry) string { return e.traceID },
+}
+
+// w3cFields maps W3C extended log format fields to their value.
+var w3cFields = map[string]func(e *accessEntry) string{
+	"date":         func(e *accessEntry) string { return e.start.UTC().Format(time.DateOnly) },
+	"time":         func(e *accessEntry) string { return e.start.UTC().Format(time.TimeOnly) },
+	"c-ip":         accessLogVariables["remote_addr"],
+	"cs-username":  accessLogVariables["remote_user"],
+	"cs-method":    accessLogVariables["request_method"],
+	"cs-uri-stem":  accessLogVariables["uri"],
+	"cs-uri-query": accessLogVariables["args"],
+	"cs-uri":       accessLogVariables["request_uri"],
+	"cs-version":   accessLogVariables["server_protocol"],
+	"cs-host":      accessLogVariables["host"],
+	"sc-status":    accessLogVariables["status"],
+	"sc-bytes":     accessLogVariables["body_bytes_sent"],
+	"cs-bytes":     accessLogVariables["request_length"],
+	"time-taken":   accessLogVariables["request_time"],
+}
+
+// AccessLogOptions holds configuration options for an AccessLog.
+type AccessLogOptions struct {
+	BufferSize    int
+	FlushInterval time.Duration
+}
+
+// AccessLogOption represents a functional option for configuring an AccessLog.
+type AccessLogOption func(*AccessLogOptions)
+
+// WithBufferSize sets the size of the AccessLog write buffer.
+func WithBufferSize(n int) AccessLogOption {
+	return func(opt *AccessLogOptions) {
+		opt.BufferSize = n
+	}
+}
+
+// WithFlushInterval sets how often the AccessLog buffer is flushed.
+// A non-positive interval disables periodic flushing.
+func WithFlushInterval(d time.Duration) AccessLogOption {
+	return func(opt *AccessLogOptions) {
+		opt.FlushInterval = d
+	}
+}
+
+// AccessLog writes one line per request in a text access log format
+// to a buffered io.Writer. It is safe for concurrent use.
+//
+// Use it with the Logger middleware through WithAccessLog, and call Close
+// on shutdown to flush buffered lines.
+type AccessLog struct {
+	mu     sync.Mutex
+	w      *bufio.Writer
+	render func(b []byte, e *accessEntry) []byte
+	header string
+	stop   chan struct{}
+	done   chan struct{}
+
+	closeOnce sync.Once
+}
+
+// NewAccessLog creates an AccessLog writing to w with the given format.
+//
+// The format is a template of nginx log_format variables such as $remote_addr,
+// $time_local, $request, $status, $body_bytes_sent, $request_time or $http_<header>,
+// for instance CommonLogFormat or CombinedLogFormat. Empty values are written as "-".
+//
+// Example usage:
+//
+//	al, err := NewAccessLog(os.Stdout, CombinedLogFormat)
+//	defer al.Close()
+//	http.Handle("/", Logger(WithLogger(nil), WithAccessLog(al))(yourHandler))
+func NewAccessLog(w io.Writer, format string, opts ...AccessLogOption) (*AccessLog, error) {
+	render, err := compileAccessLogFormat(format)
+	if err != nil {
+		return nil, err
+	}
+
+	return newAccessLog(w, render, "", opts), nil
+}
+
+// NewW3CAccessLog creates an AccessLog writing to w in the W3C extended log file format.
+//
+// Fields are W3C identifiers such as date, time, c-ip, cs-method, cs-uri-stem,
+// sc-status, sc-bytes, time-taken or cs(<header>). If no field is given,
+// DefaultW3CFields is used. Directives are written before the first entry.
+func NewW3CAccessLog(w io.Writer, fields []string, opts ...AccessLogOption) (*AccessLog, error) {
+	if len(fields) == 0 {
+		fields = DefaultW3CFields
+	}
+
+	getters := make([]func(e *accessEntry) string, len(fields))
+
+	for i, f := range fields {
+		if name, ok := strings.CutPrefix(f, "cs("); ok && strings.HasSuffix(name, ")") {
+			name = strings.TrimSuffix(name, ")")
+			getters[i] = func(e *accessEntry) string { return e.r.Header.Get(name) }
+
+			continue
+		}
+
+		g, ok := w3cFields[f]
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownLogVariable, f)
+		}
+
+		getters[i] = g
+	}
+
+	render := func(b []byte, e *accessEntry) []byte {
+		for i, g := range getters {
+			if i > 0 {
+				b = append(b, ' ')
+			}
+
+			b = appendW3CValue(b, g(e))
+		}
+
+		return b
+	}
+
+	header := "#Version: 1.0\n#Date: " + time.Now().UTC().Format(time.DateTime) + "\n#Fields: " + strings.Join(fields, " ") + "\n"
+
+	return newAccessLog(w, render, header, opts), nil
+}
+
+func newAccessLog(w io.Writer, render func([]byte, *accessEntry) []byte, header string, opts []AccessLogOption) *AccessLog {
+	options := &AccessLogOptions{
+		BufferSize:    64 * 1024,
+		FlushInterval: time.Second,
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	al := &AccessLog{
+		w:      bufio.NewWriterSize(w, options.BufferSize),
+		render: render,
+		header: header,
+	}
+
+	if options.FlushInterval > 0 {
+		al.stop, al.done = make(chan struct{}), make(chan struct{})
+		go al.flushLoop(options.FlushInterval)
+	}
+
+	return al
+}
+
+// Flush writes any buffered line to the underlying writer.
+func (al *AccessLog) Flush() error {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+
+	return al.w.Flush()
+}
+
+// Close stops periodic flushing and flushes buffered lines.
+// It does not close the underlying writer.
+func (al *AccessLog) Close() error {
+	if al.stop != nil {
+		al.closeOnce.Do(func() { close(al.stop) })
+		<-al.done
+	}
+
+	return al.Flush()
+}
+
+func (al *AccessLog) flushLoop(d time.Duration) {
+	defer close(al.done)
+
+	ticker := time.NewTicker(d)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-al.stop:
+			return
+		case <-ticker.C:
+			_ = al.Flush()
+		}
+	}
+}
+
+// log writes the line of e to the buffer.
+func (al *AccessLog) log(e *accessEntry) {
+	line := al.render(make([]byte, 0, 256), e)
+	line = append(line, '\n')
+
+	al.mu.Lock()
+	defer al.mu.Unlock()
+
+	if al.header != "" {
+		_, _ = al.w.WriteString(al.header)
+		al.header = ""
+	}
+
+	_, _ = al.w.Write(line)
+}
+
+// compileAccessLogFormat parses an nginx style format into a render function.
+func compileAccessLogFormat(format string) (func([]byte, *accessEntry) []byte, error) {
+	var parts []func(b []byte, e *accessEntry) []byte
+
+	for format != "" {
+		i := strings.IndexByte(format, '$')
+		if i < 0 {
+			i = len(format)
+		}
+
+		if lit := format[:i]; lit != "" {
+			parts = append(parts, func(b []byte, _ *accessEntry) []byte { return append(b, lit...) })
+		}
+
+		format = format[i:]
+		if format == "" {
+			break
+		}
+
+		end := 1
+		for end < len(format) && isVariableChar(format[end]) {
+			end++
+		}
+
+		name := format[1:end]
+		format = format[end:]
+
+		g, err := accessLogVariable(name)
+		if err != nil {
+			return nil, err
+		}
+
+		parts = append(parts, func(b []byte, e *accessEntry) []byte { return appendLogValue(b, g(e)) })
+	}
+
+	return func(b []byte, e *accessEntry) []byte {
+		for _, p := range parts {
+			b = p(b, e)
+		}
+
+		return b
+	}, nil
+}
+
+func accessLogVariable(name string) (func(e *accessEntry) string, error) {
+	if g, ok := accessLogVariables[name]; ok {
+		return g, nil
+	}
+
+	if header, ok := strings.CutPrefix(name, "http_"); ok && header != "" {
+		header = strings.ReplaceAll(header, "_", "-")
+		return func(e *accessEntry) string { return e.r.Header.Get(header) }, nil
+	}
+
+	return nil, fmt.Errorf("%w: %q", ErrUnknownLogVariable, "$"+name)
+}
+
+func isVariableChar(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
+
+// appendLogValue appends v escaping quotes, backslashes and non printable bytes
+// as nginx does, or "-" if v is empty.
+func appendLogValue(b []byte, v string) []byte {
+	if v == "" {
+		return append(b, '-')
+	}
+
+	for i := range len(v) {
+		switch c := v[i]; {
+		case c == '"' || c == '\\' || c < 0x20 || c >= 0x7f:
+			b = fmt.Appendf(b, `\x%02X`, c)
+		default:
+			b = append(b, c)
+		}
+	}
+
+	return b
+}
+
+// appendW3CValue appends v replacing spaces with '+', or "-" if v is empty.
+func appendW3CValue(b []byte, v string) []byte {
+	return appendLogValue(b, strings.ReplaceAll(v, " ", "+"))
+}
@@ -0,0 +1,140 @@
+package middleware_test
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/paccolamano/goshare/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serveAccessLog(t *testing.T, al *middleware.AccessLog) {
+	t.Helper()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+
+		w.WriteHeader(http.StatusCreated)
+
+		_, err := w.Write([]byte("hello"))
+		require.NoError(t, err)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/items?id=1", strings.NewReader("payload"))
+	req.SetBasicAuth("alice", "secret")
+	req.Header.Set("Referer", "https://example.com/")
+	req.Header.Set("User-Agent", `test "agent"`)
+
+	middleware.Logger(middleware.WithLogger(nil), middleware.WithAccessLog(al))(handler).ServeHTTP(httptest.NewRecorder(), req)
+
+	require.NoError(t, al.Close())
+}
+
+func TestAccessLogFormats(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name     string
+		format   string
+		expected string
+	}{
+		{
+			"common",
+			middleware.CommonLogFormat,
+			`^192\.0\.2\.1 - alice \[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] "POST /items\?id=1 HTTP/1\.1" 201 5\n$`,
+		},
+		{
+			"combined",
+			middleware.CombinedLogFormat,
+			`^192\.0\.2\.1 - alice \[.+\] "POST /items\?id=1 HTTP/1\.1" 201 5 "https://example\.com/" "test \\x22agent\\x22"\n$`,
+		},
+		{
+			"template",
+			`$request_method $uri $args $request_length $http_x_missing $request_time`,
+			`^POST /items id=1 7 - \d+\.\d{3}\n$`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			buf := &bytes.Buffer{}
+			al, err := middleware.NewAccessLog(buf, tc.format)
+			require.NoError(t, err)
+
+			serveAccessLog(t, al)
+
+			require.Regexp(t, regexp.MustCompile(tc.expected), buf.String())
+		})
+	}
+}
+
+func TestAccessLogW3C(t *testing.T) {
+	t.Parallel()
+
+	buf := &bytes.Buffer{}
+	al, err := middleware.NewW3CAccessLog(buf, []string{"c-ip", "cs-method", "cs-uri-stem", "sc-status", "cs(User-Agent)"})
+	require.NoError(t, err)
+
+	serveAccessLog(t, al)
+
+	lines := strings.Split(buf.String(), "\n")
+	require.Len(t, lines, 5)
+	require.Equal(t, "#Version: 1.0", lines[0])
+	require.Equal(t, "#Fields: c-ip cs-method cs-uri-stem sc-status cs(User-Agent)", lines[2])
+	require.Equal(t, `192.0.2.1 POST /items 201 test+\x22agent\x22`, lines[3])
+}
+
+func TestAccessLogBuffered(t *testing.T) {
+	t.Parallel()
+
+	buf := &bytes.Buffer{}
+	al, err := middleware.NewAccessLog(buf, "$status", middleware.WithFlushInterval(0))
+	require.NoError(t, err)
+
+	handler := middleware.Logger(middleware.WithLogger(nil), middleware.WithAccessLog(al))(http.NotFoundHandler())
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	require.Empty(t, buf.String())
+	require.NoError(t, al.Flush())
+	require.Equal(t, "404\n", buf.String())
+}
+
+func TestAccessLogUnknownVariable(t *testing.T) {
+	t.Parallel()
+
+	_, err := middleware.NewAccessLog(&bytes.Buffer{}, "$nope")
+	require.ErrorIs(t, err, middleware.ErrUnknownLogVariable)
+
+	_, err = middleware.NewW3CAccessLog(&bytes.Buffer{}, []string{"nope"})
+	require.ErrorIs(t, err, middleware.ErrUnknownLogVariable)
+}
+
+func TestAccessLogConcurrentClose(t *testing.T) {
+	t.Parallel()
+
+	al, err := middleware.NewAccessLog(&bytes.Buffer{}, "$status", middleware.WithFlushInterval(time.Millisecond))
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+
+	for range 10 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, al.Close())
+		}()
+	}
+
+	wg.Wait()
+}
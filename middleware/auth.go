@@ -0,0 +1,426 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+
+	"github.com/paccolamano/goshare/logger"
+)
+
+var (
+	// ErrNoCredentials is returned by authenticators when the request carries
+	// no credentials of their kind.
+	ErrNoCredentials = errors.New("middleware: no credentials")
+	// ErrInvalidCredentials is returned by authenticators when the request
+	// credentials are not valid.
+	ErrInvalidCredentials = errors.New("middleware: invalid credentials")
+)
+
+// Authentication schemes set in Principal.Scheme.
+const (
+	SchemeBearer = "Bearer"
+	SchemeAPIKey = "ApiKey"
+	SchemeBasic  = "Basic"
+)
+
+// Principal is the authenticated identity of a request.
+type Principal struct {
+	// Subject identifies the principal, such as a user or a service.
+	Subject string
+	// Scheme is the authentication scheme, such as SchemeBearer.
+	Scheme string
+	// Scopes are the scopes granted to the principal.
+	Scopes []string
+	// Roles are the roles of the principal.
+	Roles []string
+	// Claims are the JWT claims, for principals authenticated by a token.
+	Claims map[string]any
+}
+
+// HasScope reports whether the principal was granted scope.
+func (p *Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope)
+}
+
+// HasRole reports whether the principal has role.
+func (p *Principal) HasRole(role string) bool {
+	return slices.Contains(p.Roles, role)
+}
+
+// principalKey is the context key under which the Principal is stored.
+type principalKey struct{}
+
+// ContextWithPrincipal returns a copy of ctx carrying p. The subject is also stored
+// under logger.SubjectKey, so that logger.TraceHandler adds it to log records.
+func ContextWithPrincipal(ctx context.Context, p *Principal) context.Context {
+	ctx = context.WithValue(ctx, principalKey{}, p)
+	return context.WithValue(ctx, logger.SubjectKey, p.Subject)
+}
+
+// PrincipalFromContext returns the Principal stored in ctx by the Auth middleware.
+//
+// Example usage:
+//
+//	if p, ok := middleware.PrincipalFromContext(r.Context()); ok {
+//		log.Println("request from", p.Subject)
+//	}
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok && p != nil
+}
+
+// Authenticator authenticates requests for the Auth middleware.
+type Authenticator interface {
+	// Authenticate returns the principal of r. It returns an error wrapping
+	// ErrNoCredentials when r carries no credentials for this authenticator.
+	Authenticate(r *http.Request) (*Principal, error)
+
+	// Challenge returns the WWW-Authenticate challenge of the authenticator.
+	Challenge() string
+}
+
+// AuthOptions holds configuration options for the Auth middleware.
+type AuthOptions struct {
+	Authenticators []Authenticator
+	Optional       bool
+	Logger         InfoLogger
+	TraceKey       any
+}
+
+// AuthOption represents a functional option for configuring Auth middleware.
+type AuthOption func(*AuthOptions)
+
+// WithAuthenticators adds authenticators, tried in order until one finds
+// credentials in the request. It can be used multiple times.
+func WithAuthenticators(a ...Authenticator) AuthOption {
+	return func(opt *AuthOptions) {
+		opt.Authenticators = append(opt.Authenticators, a...)
+	}
+}
+
+// WithOptionalAuth lets requests without credentials through, without principal.
+// Requests with invalid credentials are still rejected.
+func WithOptionalAuth() AuthOption {
+	return func(opt *AuthOptions) {
+		opt.Optional = true
+	}
+}
+
+// WithAuthLogger sets a custom InfoLogger logging authentication failures.
+func WithAuthLogger(l InfoLogger) AuthOption {
+	return func(opt *AuthOptions) {
+		opt.Logger = l
+	}
+}
+
+// WithAuthTraceKey sets the context key from which the Auth middleware reads
+// the trace ID. It should match the Tracer key.
+func WithAuthTraceKey(key any) AuthOption {
+	return func(opt *AuthOptions) {
+		opt.TraceKey = key
+	}
+}
+
+// Auth returns a middleware authenticating requests with the given authenticators.
+//
+// The principal of authenticated requests is stored in the request context,
+// available through PrincipalFromContext, and its subject is added to the records
+// of logger.TraceHandler. Requests without valid credentials are logged and answered
+// with a 401 Unauthorized problem response, challenging every authenticator.
+// Requests whose credentials cannot be verified, because the JWT keys cannot be
+// loaded (ErrKeySetUnavailable), are answered with a 503 Service Unavailable
+// problem response instead.
+//
+// Example usage:
+//
+//	jwt := NewJWTAuthenticator(WithJWTKeySet(NewJWKS(jwksURL)), WithIssuer(issuer))
+//	keys := NewAPIKeyAuthenticator(WithAPIKeys(map[string]string{key: "batch-job"}))
+//	http.Handle("/api/", Auth(WithAuthenticators(jwt, keys))(apiHandler))
+func Auth(opts ...AuthOption) func(http.Handler) http.Handler {
+	options := &AuthOptions{
+		Logger:   slog.Default(),
+		TraceKey: "traceUUID",
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, a := range options.Authenticators {
+				p, err := a.Authenticate(r)
+				if errors.Is(err, ErrNoCredentials) {
+					continue
+				}
+
+				if err != nil {
+					options.unauthorized(w, r, err)
+					return
+				}
+
+				next.ServeHTTP(w, r.WithContext(ContextWithPrincipal(r.Context(), p)))
+
+				return
+			}
+
+			if options.Optional {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			options.unauthorized(w, r, ErrNoCredentials)
+		})
+	}
+}
+
+// unauthorized logs the authentication failure and writes a 401 problem response,
+// or a 503 one when the credentials could not be verified.
+func (o *AuthOptions) unauthorized(w http.ResponseWriter, r *http.Request, err error) {
+	traceID := requestTraceID(w, r, o.TraceKey)
+
+	args := []any{
+		"error", err,
+		"method", r.Method,
+		"path", r.URL.Path,
+	}
+	o.Logger.InfoContext(r.Context(), "authentication failed", append(args, traceAttrs(r.Context(), o.Logger, traceID)...)...)
+
+	status := http.StatusUnauthorized
+	if errors.Is(err, ErrKeySetUnavailable) {
+		status = http.StatusServiceUnavailable
+	} else {
+		for _, a := range o.Authenticators {
+			w.Header().Add("WWW-Authenticate", a.Challenge())
+		}
+	}
+
+	p := NewProblem(status)
+	p.Instance = r.URL.Path
+	p.TraceID = traceID
+
+	WriteProblem(w, p)
+}
+
+// APIKeyOptions holds configuration options for the APIKeyAuthenticator.
+type APIKeyOptions struct {
+	Header string
+	Keys   map[string]string
+	Func   func(ctx context.Context, key string) (*Principal, error)
+}
+
+// APIKeyOption represents a functional option for configuring an APIKeyAuthenticator.
+type APIKeyOption func(*APIKeyOptions)
+
+// WithAPIKeyHeader sets the request header holding the API key. The default is X-Api-Key.
+func WithAPIKeyHeader(name string) APIKeyOption {
+	return func(opt *APIKeyOptions) {
+		opt.Header = name
+	}
+}
+
+// WithAPIKeys sets static API keys, mapped to the subject of their principal.
+func WithAPIKeys(keys map[string]string) APIKeyOption {
+	return func(opt *APIKeyOptions) {
+		opt.Keys = keys
+	}
+}
+
+// WithAPIKeyFunc sets a function resolving the principal of API keys not found
+// among the static ones, for instance from a database. It returns a nil
+// principal or an error for invalid keys.
+func WithAPIKeyFunc(f func(ctx context.Context, key string) (*Principal, error)) APIKeyOption {
+	return func(opt *APIKeyOptions) {
+		opt.Func = f
+	}
+}
+
+// APIKeyAuthenticator is an Authenticator verifying API keys sent in a request header.
+type APIKeyAuthenticator struct {
+	options *APIKeyOptions
+	keys    []staticCredential
+}
+
+// staticCredential is a static credential, stored as digests so that
+// comparisons run in constant time regardless of lengths.
+type staticCredential struct {
+	subject  string
+	user     [sha256.Size]byte
+	password [sha256.Size]byte
+}
+
+// NewAPIKeyAuthenticator creates an APIKeyAuthenticator.
+func NewAPIKeyAuthenticator(opts ...APIKeyOption) *APIKeyAuthenticator {
+	options := &APIKeyOptions{
+		Header: "X-Api-Key",
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	a := &APIKeyAuthenticator{options: options}
+	for key, subject := range options.Keys {
+		a.keys = append(a.keys, staticCredential{subject: subject, password: sha256.Sum256([]byte(key))})
+	}
+
+	return a
+}
+
+// Authenticate implements Authenticator.
+func (a *APIKeyAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	key := r.Header.Get(a.options.Header)
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+
+	if subject, ok := matchCredential(a.keys, false, "", key); ok {
+		return &Principal{Subject: subject, Scheme: SchemeAPIKey}, nil
+	}
+
+	return resolvePrincipal(a.options.Func != nil, func() (*Principal, error) {
+		return a.options.Func(r.Context(), key)
+	}, SchemeAPIKey)
+}
+
+// Challenge implements Authenticator.
+func (a *APIKeyAuthenticator) Challenge() string {
+	return SchemeAPIKey + ` header="` + a.options.Header + `"`
+}
+
+// BasicAuthOptions holds configuration options for the BasicAuthenticator.
+type BasicAuthOptions struct {
+	Realm       string
+	Credentials map[string]string
+	Func        func(ctx context.Context, user, password string) (*Principal, error)
+}
+
+// BasicAuthOption represents a functional option for configuring a BasicAuthenticator.
+type BasicAuthOption func(*BasicAuthOptions)
+
+// WithBasicRealm sets the realm of the Basic challenge. The default is "restricted".
+func WithBasicRealm(realm string) BasicAuthOption {
+	return func(opt *BasicAuthOptions) {
+		opt.Realm = realm
+	}
+}
+
+// WithBasicCredentials sets static credentials, mapping users to their password.
+func WithBasicCredentials(credentials map[string]string) BasicAuthOption {
+	return func(opt *BasicAuthOptions) {
+		opt.Credentials = credentials
+	}
+}
+
+// WithBasicAuthFunc sets a function resolving the principal of credentials not
+// found among the static ones. It returns a nil principal or an error for
+// invalid credentials.
+func WithBasicAuthFunc(f func(ctx context.Context, user, password string) (*Principal, error)) BasicAuthOption {
+	return func(opt *BasicAuthOptions) {
+		opt.Func = f
+	}
+}
+
+// BasicAuthenticator is an Authenticator verifying HTTP Basic credentials.
+// Static credentials are compared in constant time.
+type BasicAuthenticator struct {
+	options     *BasicAuthOptions
+	credentials []staticCredential
+}
+
+// NewBasicAuthenticator creates a BasicAuthenticator.
+func NewBasicAuthenticator(opts ...BasicAuthOption) *BasicAuthenticator {
+	options := &BasicAuthOptions{
+		Realm: "restricted",
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	a := &BasicAuthenticator{options: options}
+	for user, password := range options.Credentials {
+		a.credentials = append(a.credentials, staticCredential{
+			subject:  user,
+			user:     sha256.Sum256([]byte(user)),
+			password: sha256.Sum256([]byte(password)),
+		})
+	}
+
+	return a
+}
+
+// Authenticate implements Authenticator.
+func (a *BasicAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+
+	if subject, ok := matchCredential(a.credentials, true, user, password); ok {
+		return &Principal{Subject: subject, Scheme: SchemeBasic}, nil
+	}
+
+	return resolvePrincipal(a.options.Func != nil, func() (*Principal, error) {
+		return a.options.Func(r.Context(), user, password)
+	}, SchemeBasic)
+}
+
+// Challenge implements Authenticator.
+func (a *BasicAuthenticator) Challenge() string {
+	return SchemeBasic + ` realm="` + a.options.Realm + `", charset="UTF-8"`
+}
+
+// matchCredential returns the subject of the credential matching password and,
+// when checkUser is set, user. Every credential is compared, in constant time.
+func matchCredential(credentials []staticCredential, checkUser bool, user, password string) (string, bool) {
+	userSum := sha256.Sum256([]byte(user))
+	passwordSum := sha256.Sum256([]byte(password))
+
+	var (
+		subject string
+		found   bool
+	)
+
+	for _, c := range credentials {
+		match := subtle.ConstantTimeCompare(c.password[:], passwordSum[:])
+		if checkUser {
+			match &= subtle.ConstantTimeCompare(c.user[:], userSum[:])
+		}
+
+		if match == 1 {
+			subject, found = c.subject, true
+		}
+	}
+
+	return subject, found
+}
+
+// resolvePrincipal calls resolve when enabled, mapping missing principals to
+// ErrInvalidCredentials and setting the scheme of the returned one.
+func resolvePrincipal(enabled bool, resolve func() (*Principal, error), scheme string) (*Principal, error) {
+	if !enabled {
+		return nil, ErrInvalidCredentials
+	}
+
+	p, err := resolve()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCredentials, err)
+	}
+
+	if p == nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	if p.Scheme == "" {
+		p.Scheme = scheme
+	}
+
+	return p, nil
+}
@@ -0,0 +1,203 @@
+package middleware_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/paccolamano/goshare/logger"
+	"github.com/paccolamano/goshare/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestAPIKeyAuthenticator(t *testing.T) {
+	t.Parallel()
+
+	errRevoked := errors.New("revoked")
+
+	a := middleware.NewAPIKeyAuthenticator(
+		middleware.WithAPIKeys(map[string]string{"k-static": "batch-job"}),
+		middleware.WithAPIKeyFunc(func(_ context.Context, key string) (*middleware.Principal, error) {
+			switch key {
+			case "k-db":
+				return &middleware.Principal{Subject: "tenant-1", Roles: []string{"reader"}}, nil
+			case "k-revoked":
+				return nil, errRevoked
+			default:
+				return nil, nil
+			}
+		}),
+	)
+
+	tests := []struct {
+		key     string
+		subject string
+		err     error
+	}{
+		{key: "", err: middleware.ErrNoCredentials},
+		{key: "k-static", subject: "batch-job"},
+		{key: "k-db", subject: "tenant-1"},
+		{key: "k-revoked", err: errRevoked},
+		{key: "k-unknown", err: middleware.ErrInvalidCredentials},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Api-Key", tt.key)
+
+		p, err := a.Authenticate(req)
+		if tt.err != nil {
+			require.ErrorIs(t, err, tt.err, tt.key)
+			continue
+		}
+
+		require.NoError(t, err, tt.key)
+		assert.Equal(t, tt.subject, p.Subject)
+		assert.Equal(t, middleware.SchemeAPIKey, p.Scheme)
+	}
+
+	assert.Equal(t, `ApiKey header="X-Api-Key"`, a.Challenge())
+}
+
+func TestBasicAuthenticator(t *testing.T) {
+	t.Parallel()
+
+	a := middleware.NewBasicAuthenticator(
+		middleware.WithBasicRealm("admin"),
+		middleware.WithBasicCredentials(map[string]string{"alice": "s3cret", "bob": "hunter2"}),
+	)
+
+	tests := []struct {
+		user, password string
+		ok             bool
+	}{
+		{user: "alice", password: "s3cret", ok: true},
+		{user: "bob", password: "hunter2", ok: true},
+		{user: "alice", password: "hunter2"},
+		{user: "", password: "s3cret"},
+		{user: "carol", password: "s3cret"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.SetBasicAuth(tt.user, tt.password)
+
+		p, err := a.Authenticate(req)
+		if !tt.ok {
+			require.ErrorIs(t, err, middleware.ErrInvalidCredentials, tt.user)
+			continue
+		}
+
+		require.NoError(t, err)
+		assert.Equal(t, tt.user, p.Subject)
+		assert.Equal(t, middleware.SchemeBasic, p.Scheme)
+	}
+
+	_, err := a.Authenticate(httptest.NewRequest(http.MethodGet, "/", nil))
+	require.ErrorIs(t, err, middleware.ErrNoCredentials)
+	assert.Equal(t, `Basic realm="admin", charset="UTF-8"`, a.Challenge())
+}
+
+func TestAuth(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	l := NewMockInfoLogger(ctrl)
+	l.EXPECT().
+		InfoContext(gomock.Any(), "authentication failed",
+			"error", gomock.Any(),
+			"method", http.MethodGet,
+			"path", "/api",
+			"traceUUID", gomock.Any(),
+		).
+		Times(2)
+
+	mw := middleware.Auth(
+		middleware.WithAuthenticators(
+			middleware.NewAPIKeyAuthenticator(middleware.WithAPIKeys(map[string]string{"key": "service"})),
+			middleware.NewBasicAuthenticator(middleware.WithBasicCredentials(map[string]string{"alice": "pw"})),
+		),
+		middleware.WithAuthLogger(l),
+	)
+
+	handler := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, ok := middleware.PrincipalFromContext(r.Context())
+		require.True(t, ok)
+
+		_, _ = w.Write([]byte(p.Subject))
+	}))
+
+	serve := func(setup func(r *http.Request)) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api", nil)
+		setup(req)
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		return w
+	}
+
+	w := serve(func(r *http.Request) { r.Header.Set("X-Api-Key", "key") })
+	assert.Equal(t, "service", w.Body.String())
+
+	w = serve(func(r *http.Request) { r.SetBasicAuth("alice", "pw") })
+	assert.Equal(t, "alice", w.Body.String())
+
+	w = serve(func(*http.Request) {})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, middleware.ProblemContentType, w.Header().Get("Content-Type"))
+	assert.Equal(t, []string{`ApiKey header="X-Api-Key"`, `Basic realm="restricted", charset="UTF-8"`},
+		w.Header().Values("WWW-Authenticate"))
+
+	// Invalid credentials are rejected without trying the next authenticators.
+	w = serve(func(r *http.Request) {
+		r.Header.Set("X-Api-Key", "wrong")
+		r.SetBasicAuth("alice", "pw")
+	})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestAuthOptional(t *testing.T) {
+	t.Parallel()
+
+	handler := middleware.Auth(
+		middleware.WithAuthenticators(middleware.NewAPIKeyAuthenticator()),
+		middleware.WithOptionalAuth(),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, ok := middleware.PrincipalFromContext(r.Context())
+		assert.False(t, ok)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+}
+
+func TestAuthSubjectLogged(t *testing.T) {
+	t.Parallel()
+
+	buf := &bytes.Buffer{}
+	l := slog.New(logger.NewTraceHandler(buf, "json", "info"))
+
+	handler := middleware.Auth(
+		middleware.WithAuthenticators(middleware.NewBasicAuthenticator(
+			middleware.WithBasicCredentials(map[string]string{"alice": "pw"}))),
+	)(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		l.InfoContext(r.Context(), "order created")
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.SetBasicAuth("alice", "pw")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Contains(t, buf.String(), `"subject":"alice"`)
+}
@@ -0,0 +1,216 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"slices"
+)
+
+// Policy decides whether the principal may perform the request r.
+// The principal is nil for unauthenticated requests.
+type Policy func(p *Principal, r *http.Request) bool
+
+// RequireAuthenticated is a Policy allowing any authenticated request.
+func RequireAuthenticated() Policy {
+	return func(p *Principal, _ *http.Request) bool {
+		return p != nil
+	}
+}
+
+// RequireRole is a Policy allowing principals having at least one of roles.
+func RequireRole(roles ...string) Policy {
+	return func(p *Principal, _ *http.Request) bool {
+		return p != nil && slices.ContainsFunc(roles, p.HasRole)
+	}
+}
+
+// RequireScopes is a Policy allowing principals granted all of scopes.
+func RequireScopes(scopes ...string) Policy {
+	return func(p *Principal, _ *http.Request) bool {
+		if p == nil {
+			return false
+		}
+
+		for _, s := range scopes {
+			if !p.HasScope(s) {
+				return false
+			}
+		}
+
+		return true
+	}
+}
+
+// AllOf is a Policy allowing requests allowed by all of policies.
+func AllOf(policies ...Policy) Policy {
+	return func(p *Principal, r *http.Request) bool {
+		for _, policy := range policies {
+			if !policy(p, r) {
+				return false
+			}
+		}
+
+		return true
+	}
+}
+
+// AnyOf is a Policy allowing requests allowed by at least one of policies.
+func AnyOf(policies ...Policy) Policy {
+	return func(p *Principal, r *http.Request) bool {
+		for _, policy := range policies {
+			if policy(p, r) {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+// AuthorizeOptions holds configuration options for the Authorize middleware.
+type AuthorizeOptions struct {
+	Routes        map[string]Policy
+	DefaultPolicy Policy
+	DryRun        bool
+	Logger        InfoLogger
+	TraceKey      any
+}
+
+// AuthorizeOption represents a functional option for configuring Authorize middleware.
+type AuthorizeOption func(*AuthorizeOptions)
+
+// WithRoutePolicy sets the policies of requests matching pattern, using the
+// http.ServeMux pattern syntax, such as "DELETE /orders/{id}". Requests are
+// allowed when all of policies allow them. It can be used multiple times.
+func WithRoutePolicy(pattern string, policies ...Policy) AuthorizeOption {
+	return func(opt *AuthorizeOptions) {
+		if opt.Routes == nil {
+			opt.Routes = make(map[string]Policy)
+		}
+
+		opt.Routes[pattern] = AllOf(policies...)
+	}
+}
+
+// WithDefaultPolicy sets the policy of requests not matching any route pattern.
+// By default they are allowed.
+func WithDefaultPolicy(policy Policy) AuthorizeOption {
+	return func(opt *AuthorizeOptions) {
+		opt.DefaultPolicy = policy
+	}
+}
+
+// WithDryRun only logs the requests that would be denied, letting them through.
+// It allows rolling out new policies safely.
+func WithDryRun() AuthorizeOption {
+	return func(opt *AuthorizeOptions) {
+		opt.DryRun = true
+	}
+}
+
+// WithAuthorizeLogger sets a custom InfoLogger logging authorization decisions.
+func WithAuthorizeLogger(l InfoLogger) AuthorizeOption {
+	return func(opt *AuthorizeOptions) {
+		opt.Logger = l
+	}
+}
+
+// WithAuthorizeTraceKey sets the context key from which the Authorize middleware
+// reads the trace ID. It should match the Tracer key.
+func WithAuthorizeTraceKey(key any) AuthorizeOption {
+	return func(opt *AuthorizeOptions) {
+		opt.TraceKey = key
+	}
+}
+
+// Authorize returns a middleware enforcing the policies of the route matched by
+// each request, for the principal stored in the context by the Auth middleware.
+//
+// Denied requests are logged and answered with a 403 Forbidden problem response.
+// Granted requests are logged at debug level when the logger implements LevelLogger.
+//
+// Example usage:
+//
+//	authz := Authorize(
+//		WithRoutePolicy("GET /orders/{id}", RequireScopes("orders:read")),
+//		WithRoutePolicy("DELETE /orders/{id}", RequireRole("admin")),
+//		WithDefaultPolicy(RequireAuthenticated()),
+//	)
+//	http.ListenAndServe(":8080", NewChain(Auth(WithAuthenticators(jwt)), authz).Then(mux))
+//
+// Attribute based policies are plain functions of the principal and the request:
+//
+//	owner := func(p *Principal, r *http.Request) bool {
+//		return p != nil && p.Subject == r.PathValue("user")
+//	}
+//
+// Policies receive the request as matched by the route pattern, with its path values set.
+// Requests that a ServeMux would redirect, such as "/admin" for the "/admin/" pattern
+// or paths with ".." segments, get the policy of the route they are redirected to.
+func Authorize(opts ...AuthorizeOption) func(http.Handler) http.Handler {
+	options := &AuthorizeOptions{
+		Logger:   slog.Default(),
+		TraceKey: "traceUUID",
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	routes := newRouteTable(options.Routes)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			matched, policy, ok := routes.match(r)
+			if !ok {
+				policy = options.DefaultPolicy
+			}
+
+			if policy == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			principal, _ := PrincipalFromContext(r.Context())
+
+			var subject string
+			if principal != nil {
+				subject = principal.Subject
+			}
+
+			traceID := requestTraceID(w, r, options.TraceKey)
+			args := []any{
+				"subject", subject,
+				"method", r.Method,
+				"path", r.URL.Path,
+				"route", matched.Pattern,
+			}
+			args = append(args, traceAttrs(r.Context(), options.Logger, traceID)...)
+
+			if policy(principal, matched) {
+				if ll, ok := options.Logger.(LevelLogger); ok {
+					ll.Log(r.Context(), slog.LevelDebug, "authorization granted", args...)
+				}
+
+				next.ServeHTTP(w, r)
+
+				return
+			}
+
+			if options.DryRun {
+				options.Logger.InfoContext(r.Context(), "authorization would be denied", append(args, "dryRun", true)...)
+				next.ServeHTTP(w, r)
+
+				return
+			}
+
+			options.Logger.InfoContext(r.Context(), "authorization denied", args...)
+
+			p := NewProblem(http.StatusForbidden)
+			p.Instance = r.URL.Path
+			p.TraceID = traceID
+
+			WriteProblem(w, p)
+		})
+	}
+}
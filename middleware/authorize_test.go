@@ -0,0 +1,223 @@
+package middleware_test
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/paccolamano/goshare/middleware"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func authorizeRequest(method, path string, p *middleware.Principal) *http.Request {
+	req := httptest.NewRequest(method, path, nil)
+	if p != nil {
+		req = req.WithContext(middleware.ContextWithPrincipal(req.Context(), p))
+	}
+
+	return req
+}
+
+func TestPolicies(t *testing.T) {
+	t.Parallel()
+
+	p := &middleware.Principal{Subject: "alice", Roles: []string{"editor"}, Scopes: []string{"a", "b"}}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	assert.True(t, middleware.RequireAuthenticated()(p, req))
+	assert.False(t, middleware.RequireAuthenticated()(nil, req))
+	assert.True(t, middleware.RequireRole("admin", "editor")(p, req))
+	assert.False(t, middleware.RequireRole("admin")(p, req))
+	assert.False(t, middleware.RequireRole("admin")(nil, req))
+	assert.True(t, middleware.RequireScopes("a", "b")(p, req))
+	assert.False(t, middleware.RequireScopes("a", "c")(p, req))
+	assert.False(t, middleware.RequireScopes()(nil, req))
+	assert.True(t, middleware.AnyOf(middleware.RequireRole("admin"), middleware.RequireScopes("a"))(p, req))
+	assert.False(t, middleware.AllOf(middleware.RequireRole("admin"), middleware.RequireScopes("a"))(p, req))
+}
+
+func TestAuthorize(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	l := NewMockInfoLogger(ctrl)
+	l.EXPECT().
+		InfoContext(gomock.Any(), "authorization denied",
+			"subject", gomock.Any(),
+			"method", gomock.Any(),
+			"path", gomock.Any(),
+			"route", gomock.Any(),
+			"traceUUID", gomock.Any(),
+		).
+		AnyTimes()
+
+	owner := func(p *middleware.Principal, r *http.Request) bool {
+		return p != nil && p.Subject == r.PathValue("user")
+	}
+
+	mw := middleware.Authorize(
+		middleware.WithRoutePolicy("GET /orders/{id}", middleware.RequireScopes("orders:read")),
+		middleware.WithRoutePolicy("DELETE /orders/{id}", middleware.RequireScopes("orders:read"), middleware.RequireRole("admin")),
+		middleware.WithRoutePolicy("/users/{user}/", middleware.AnyOf(owner, middleware.RequireRole("admin"))),
+		middleware.WithRoutePolicy("GET /public/", func(*middleware.Principal, *http.Request) bool { return true }),
+		middleware.WithDefaultPolicy(middleware.RequireAuthenticated()),
+		middleware.WithAuthorizeLogger(l),
+	)
+	handler := mw(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	reader := &middleware.Principal{Subject: "alice", Scopes: []string{"orders:read"}}
+	admin := &middleware.Principal{Subject: "root", Scopes: []string{"orders:read"}, Roles: []string{"admin"}}
+
+	tests := []struct {
+		name      string
+		method    string
+		path      string
+		principal *middleware.Principal
+		status    int
+	}{
+		{name: "scope", method: http.MethodGet, path: "/orders/1", principal: reader, status: http.StatusNoContent},
+		{name: "missing role", method: http.MethodDelete, path: "/orders/1", principal: reader, status: http.StatusForbidden},
+		{name: "role", method: http.MethodDelete, path: "/orders/1", principal: admin, status: http.StatusNoContent},
+		{name: "owner", method: http.MethodPut, path: "/users/alice/profile", principal: reader, status: http.StatusNoContent},
+		{name: "not owner", method: http.MethodPut, path: "/users/bob/profile", principal: reader, status: http.StatusForbidden},
+		{name: "admin not owner", method: http.MethodPut, path: "/users/bob/profile", principal: admin, status: http.StatusNoContent},
+		{name: "public", method: http.MethodGet, path: "/public/logo.png", status: http.StatusNoContent},
+		{name: "default anonymous", method: http.MethodGet, path: "/other", status: http.StatusForbidden},
+		{name: "default authenticated", method: http.MethodGet, path: "/other", principal: reader, status: http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, authorizeRequest(tt.method, tt.path, tt.principal))
+
+			assert.Equal(t, tt.status, w.Code)
+
+			if tt.status == http.StatusForbidden {
+				assert.Equal(t, middleware.ProblemContentType, w.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
+
+func TestAuthorizeRedirectedPaths(t *testing.T) {
+	t.Parallel()
+
+	handler := middleware.Authorize(
+		middleware.WithRoutePolicy("/admin/", middleware.RequireRole("admin")),
+		middleware.WithAuthorizeLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	reader := &middleware.Principal{Subject: "alice"}
+	admin := &middleware.Principal{Subject: "root", Roles: []string{"admin"}}
+
+	// Paths redirected by a ServeMux get the policy of their target.
+	for _, path := range []string{"/admin", "/public/../admin/users", "/admin/./users", "//admin/users"} {
+		t.Run(path, func(t *testing.T) {
+			t.Parallel()
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, authorizeRequest(http.MethodGet, path, reader))
+			assert.Equal(t, http.StatusForbidden, w.Code)
+
+			w = httptest.NewRecorder()
+			handler.ServeHTTP(w, authorizeRequest(http.MethodGet, path, admin))
+			assert.Equal(t, http.StatusNoContent, w.Code)
+		})
+	}
+}
+
+func TestAuthorizeLogsDecisions(t *testing.T) {
+	t.Parallel()
+
+	buf := &bytes.Buffer{}
+	l := slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	handler := middleware.Authorize(
+		middleware.WithRoutePolicy("GET /admin/", middleware.RequireRole("admin")),
+		middleware.WithAuthorizeLogger(l),
+	)(http.NotFoundHandler())
+
+	w := httptest.NewRecorder()
+	w.Header().Set("X-Request-ID", "trace-1")
+	handler.ServeHTTP(w, authorizeRequest(http.MethodGet, "/admin/users", &middleware.Principal{Subject: "alice"}))
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, buf.String(), `"msg":"authorization denied","subject":"alice","method":"GET","path":"/admin/users","route":"GET /admin/","traceUUID":"trace-1"`)
+
+	buf.Reset()
+	handler.ServeHTTP(httptest.NewRecorder(), authorizeRequest(http.MethodGet, "/admin/users",
+		&middleware.Principal{Subject: "root", Roles: []string{"admin"}}))
+
+	assert.Contains(t, buf.String(), `"level":"DEBUG","msg":"authorization granted","subject":"root"`)
+}
+
+func TestAuthorizeDryRun(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	l := NewMockInfoLogger(ctrl)
+	l.EXPECT().
+		InfoContext(gomock.Any(), "authorization would be denied",
+			"subject", "",
+			"method", http.MethodPost,
+			"path", "/orders",
+			"route", "POST /orders",
+			"traceUUID", "",
+			"dryRun", true,
+		).
+		Times(1)
+
+	handler := middleware.Authorize(
+		middleware.WithRoutePolicy("POST /orders", middleware.RequireAuthenticated()),
+		middleware.WithDryRun(),
+		middleware.WithAuthorizeLogger(l),
+	)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, authorizeRequest(http.MethodPost, "/orders", nil))
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+}
+
+// assertPathValuesKept serves GET /items/42 through a ServeMux routing it to mw,
+// and checks that the handler wrapped by mw sees the pattern and path values of the mux.
+func assertPathValuesKept(t *testing.T, mw func(http.Handler) http.Handler) {
+	t.Helper()
+
+	var id, pattern string
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /items/{id}", mw(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		id, pattern = r.PathValue("id"), r.Pattern
+	})))
+
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/items/42", nil))
+
+	assert.Equal(t, "42", id)
+	assert.Equal(t, "GET /items/{id}", pattern)
+}
+
+func TestAuthorizeKeepsPathValues(t *testing.T) {
+	t.Parallel()
+
+	assertPathValuesKept(t, middleware.Authorize(
+		middleware.WithRoutePolicy("/other/", middleware.RequireAuthenticated()),
+	))
+}
@@ -0,0 +1,263 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"mime"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// redactedValue replaces redacted JSON and form fields in logged bodies.
+const redactedValue = "[REDACTED]"
+
+// unparsableBody replaces JSON bodies that cannot be parsed while redaction is
+// configured, typically because they were truncated to the maximum size.
+const unparsableBody = "[unparsable JSON body omitted]"
+
+// unparsableForm replaces form bodies that cannot be parsed while redaction is configured.
+const unparsableForm = "[unparsable form body omitted]"
+
+// BodyLogOptions holds configuration options for request and response body logging.
+type BodyLogOptions struct {
+	Request      bool
+	Response     bool
+	MaxSize      int
+	ContentTypes []string
+	RedactPaths  []string
+	SampleRate   float64
+}
+
+// BodyLogOption represents a functional option for configuring body logging.
+type BodyLogOption func(*BodyLogOptions)
+
+// WithBodies selects whether request and response bodies are captured.
+// Both are captured by default.
+func WithBodies(request, response bool) BodyLogOption {
+	return func(opt *BodyLogOptions) {
+		opt.Request = request
+		opt.Response = response
+	}
+}
+
+// WithMaxBodySize sets the maximum number of bytes logged per body (default is 4096).
+// Longer bodies are truncated.
+func WithMaxBodySize(n int) BodyLogOption {
+	return func(opt *BodyLogOptions) {
+		opt.MaxSize = n
+	}
+}
+
+// WithBodyContentTypes sets the media types whose bodies are logged.
+// A type ending with "/*", such as "text/*", matches every subtype.
+func WithBodyContentTypes(types ...string) BodyLogOption {
+	return func(opt *BodyLogOptions) {
+		opt.ContentTypes = types
+	}
+}
+
+// WithRedactedFields sets the JSON fields replaced with "[REDACTED]" in logged bodies.
+// Paths are dot separated, "*" matching any object key or array element,
+// for instance "password" or "items.*.card.number". In URL-encoded form bodies,
+// the fields named like a path are redacted, or every field for "*".
+func WithRedactedFields(paths ...string) BodyLogOption {
+	return func(opt *BodyLogOptions) {
+		opt.RedactPaths = paths
+	}
+}
+
+// WithBodySampleRate sets the fraction of requests, between 0 and 1,
+// whose bodies are logged (default is 1).
+func WithBodySampleRate(rate float64) BodyLogOption {
+	return func(opt *BodyLogOptions) {
+		opt.SampleRate = rate
+	}
+}
+
+// WithBodyLogging makes the Logger middleware add the request and response bodies
+// to the completion record. Bodies are copied while the handler reads and writes them,
+// so the handler still receives the full request body and responses keep streaming.
+//
+// Example usage:
+//
+//	Logger(WithBodyLogging(WithMaxBodySize(1024), WithRedactedFields("password")))
+func WithBodyLogging(opts ...BodyLogOption) LoggerOption {
+	options := &BodyLogOptions{
+		Request:  true,
+		Response: true,
+		MaxSize:  4096,
+		ContentTypes: []string{
+			"application/json", "application/*+json", "application/xml",
+			"application/x-www-form-urlencoded", "text/*",
+		},
+		SampleRate: 1,
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	return func(opt *LoggerOptions) {
+		opt.BodyLog = options
+	}
+}
+
+// sample reports whether the bodies of the current request should be logged.
+func (o *BodyLogOptions) sample() bool {
+	return o.SampleRate >= 1 || (o.SampleRate > 0 && rand.Float64() < o.SampleRate)
+}
+
+// attrs returns the attributes logging the captured body buf under key,
+// or nothing if its content type is not allowed.
+func (o *BodyLogOptions) attrs(key string, buf *limitedBuffer, contentType string) []any {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if buf == nil || buf.Len() == 0 || err != nil || !o.allowed(mediaType) {
+		return nil
+	}
+
+	body := buf.String()
+	if len(o.RedactPaths) > 0 {
+		switch {
+		case isJSONMediaType(mediaType):
+			body = redactJSON(buf.Bytes(), o.RedactPaths)
+		case mediaType == "application/x-www-form-urlencoded":
+			body = redactForm(body, o.RedactPaths)
+		}
+	}
+
+	attrs := []any{slog.String(key, body)}
+	if buf.truncated {
+		attrs = append(attrs, slog.Bool(key+"Truncated", true))
+	}
+
+	return attrs
+}
+
+func (o *BodyLogOptions) allowed(mediaType string) bool {
+	for _, t := range o.ContentTypes {
+		if t == mediaType {
+			return true
+		}
+
+		if prefix, ok := strings.CutSuffix(t, "/*"); ok && strings.HasPrefix(mediaType, prefix+"/") {
+			return true
+		}
+
+		if suffix, ok := strings.CutPrefix(t, "application/*"); ok && strings.HasPrefix(mediaType, "application/") && strings.HasSuffix(mediaType, suffix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isJSONMediaType(mediaType string) bool {
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// redactJSON replaces the values at paths in the JSON document data.
+func redactJSON(data []byte, paths []string) string {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return unparsableBody
+	}
+
+	for _, p := range paths {
+		v = redactPath(v, strings.Split(p, "."))
+	}
+
+	out, err := json.Marshal(v)
+	if err != nil {
+		return unparsableBody
+	}
+
+	return string(out)
+}
+
+// redactForm replaces the values of the fields named like one of paths in the
+// URL-encoded form body, keeping the order of the fields.
+func redactForm(body string, paths []string) string {
+	pairs := strings.Split(body, "&")
+
+	for i, pair := range pairs {
+		key, _, _ := strings.Cut(pair, "=")
+
+		name, err := url.QueryUnescape(key)
+		if err != nil {
+			return unparsableForm
+		}
+
+		if slices.Contains(paths, name) || slices.Contains(paths, "*") {
+			pairs[i] = key + "=" + url.QueryEscape(redactedValue)
+		}
+	}
+
+	return strings.Join(pairs, "&")
+}
+
+func redactPath(v any, path []string) any {
+	if len(path) == 0 {
+		return redactedValue
+	}
+
+	switch t := v.(type) {
+	case map[string]any:
+		for k, child := range t {
+			if path[0] == "*" || path[0] == k {
+				t[k] = redactPath(child, path[1:])
+			}
+		}
+	case []any:
+		for i, child := range t {
+			if path[0] == "*" || path[0] == strconv.Itoa(i) {
+				t[i] = redactPath(child, path[1:])
+			}
+		}
+	}
+
+	return v
+}
+
+// limitedBuffer is an io.Writer keeping at most max bytes and
+// recording whether more bytes were written.
+type limitedBuffer struct {
+	bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+
+	if room := b.max - b.Len(); len(p) > room {
+		b.truncated = true
+		p = p[:max(room, 0)]
+	}
+
+	b.Buffer.Write(p)
+
+	return n, nil
+}
+
+// teeReadCloser copies the bytes read from the wrapped body to w.
+type teeReadCloser struct {
+	io.ReadCloser
+	w io.Writer
+}
+
+func (t *teeReadCloser) Read(p []byte) (int, error) {
+	n, err := t.ReadCloser.Read(p)
+	if n > 0 {
+		_, _ = t.w.Write(p[:n])
+	}
+
+	return n, err
+}
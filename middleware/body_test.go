@@ -0,0 +1,110 @@
+package middleware_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/paccolamano/goshare/middleware"
+	"github.com/stretchr/testify/require"
+)
+
+func serveWithBodyLogging(t *testing.T, contentType, reqBody string, opts ...middleware.BodyLogOption) map[string]any {
+	t.Helper()
+
+	buf := &bytes.Buffer{}
+	l := slog.New(slog.NewJSONHandler(buf, nil))
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.Equal(t, reqBody, string(body))
+
+		w.Header().Set("Content-Type", contentType)
+		_, err = w.Write(body)
+		require.NoError(t, err)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(reqBody))
+	req.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+
+	middleware.Logger(
+		middleware.WithLogger(l),
+		middleware.WithSingleRecord(),
+		middleware.WithBodyLogging(opts...),
+	)(handler).ServeHTTP(w, req)
+
+	require.Equal(t, reqBody, w.Body.String())
+
+	var rec map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &rec))
+
+	return rec
+}
+
+func TestLoggerBodyLoggingRedaction(t *testing.T) {
+	t.Parallel()
+
+	body := `{"user":{"name":"alice","password":"secret"},"cards":[{"number":"4111"},{"number":"5500"}]}`
+	rec := serveWithBodyLogging(t, "application/json; charset=utf-8", body,
+		middleware.WithRedactedFields("user.password", "cards.*.number"),
+	)
+
+	expected := `{"cards":[{"number":"[REDACTED]"},{"number":"[REDACTED]"}],"user":{"name":"alice","password":"[REDACTED]"}}`
+	require.Equal(t, expected, rec["requestBody"])
+	require.Equal(t, expected, rec["responseBody"])
+}
+
+func TestLoggerBodyLoggingFormRedaction(t *testing.T) {
+	t.Parallel()
+
+	rec := serveWithBodyLogging(t, "application/x-www-form-urlencoded", "user=alice&password=s%26cret&token=abc",
+		middleware.WithRedactedFields("password", "token"),
+	)
+
+	require.Equal(t, "user=alice&password=%5BREDACTED%5D&token=%5BREDACTED%5D", rec["requestBody"])
+
+	rec = serveWithBodyLogging(t, "application/x-www-form-urlencoded", "pass%zz=secret",
+		middleware.WithRedactedFields("password"),
+	)
+
+	require.Equal(t, "[unparsable form body omitted]", rec["requestBody"])
+}
+
+func TestLoggerBodyLoggingTruncated(t *testing.T) {
+	t.Parallel()
+
+	rec := serveWithBodyLogging(t, "text/plain", "hello world",
+		middleware.WithMaxBodySize(5),
+		middleware.WithBodies(false, true),
+	)
+
+	require.NotContains(t, rec, "requestBody")
+	require.Equal(t, "hello", rec["responseBody"])
+	require.Equal(t, true, rec["responseBodyTruncated"])
+
+	rec = serveWithBodyLogging(t, "application/json", `{"password":"secret"}`,
+		middleware.WithMaxBodySize(5),
+		middleware.WithRedactedFields("password"),
+	)
+
+	require.Equal(t, "[unparsable JSON body omitted]", rec["requestBody"])
+}
+
+func TestLoggerBodyLoggingFiltered(t *testing.T) {
+	t.Parallel()
+
+	rec := serveWithBodyLogging(t, "application/octet-stream", "binary")
+	require.NotContains(t, rec, "requestBody")
+	require.NotContains(t, rec, "responseBody")
+
+	rec = serveWithBodyLogging(t, "text/plain", "sampled out", middleware.WithBodySampleRate(0))
+	require.NotContains(t, rec, "requestBody")
+	require.NotContains(t, rec, "responseBody")
+}
@@ -0,0 +1,214 @@
+package middleware
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// BodyLimitOptions holds configuration options for the BodyLimit middleware.
+type BodyLimitOptions struct {
+	Limit    int64
+	Routes   map[string]int64
+	TraceKey any
+}
+
+// BodyLimitOption represents a functional option for configuring BodyLimit middleware.
+type BodyLimitOption func(*BodyLimitOptions)
+
+// WithBodyLimit sets the maximum size, in bytes, of request bodies not matching
+// any route set with WithRouteBodyLimit. The default is 1 MiB.
+func WithBodyLimit(n int64) BodyLimitOption {
+	return func(opt *BodyLimitOptions) {
+		opt.Limit = n
+	}
+}
+
+// WithRouteBodyLimit sets the maximum size of the bodies of requests matching
+// pattern, using the http.ServeMux pattern syntax, such as "POST /uploads".
+// A non-positive limit disables the limit for the route. It can be used multiple times.
+func WithRouteBodyLimit(pattern string, n int64) BodyLimitOption {
+	return func(opt *BodyLimitOptions) {
+		if opt.Routes == nil {
+			opt.Routes = make(map[string]int64)
+		}
+
+		opt.Routes[pattern] = n
+	}
+}
+
+// WithBodyLimitTraceKey sets the context key from which the BodyLimit middleware
+// reads the trace ID. It should match the Tracer key.
+func WithBodyLimitTraceKey(key any) BodyLimitOption {
+	return func(opt *BodyLimitOptions) {
+		opt.TraceKey = key
+	}
+}
+
+// BodyLimit returns a middleware limiting the size of request bodies with
+// http.MaxBytesReader.
+//
+// Requests whose Content-Length exceeds the limit are answered with a 413 Content
+// Too Large problem response without calling the next handler. Otherwise, reading
+// past the limit fails with an *http.MaxBytesError and, unless the handler already
+// sent the response headers, its response is replaced with the 413 problem response,
+// also written when the handler returns without responding.
+//
+// Example usage:
+//
+//	http.ListenAndServe(":8080", BodyLimit(WithBodyLimit(64<<10),
+//		WithRouteBodyLimit("POST /uploads", 100<<20))(mux))
+func BodyLimit(opts ...BodyLimitOption) func(http.Handler) http.Handler {
+	options := &BodyLimitOptions{
+		Limit:    1 << 20,
+		TraceKey: "traceUUID",
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	routes := newRouteTable(options.Routes)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limit := options.Limit
+			if _, n, ok := routes.match(r); ok {
+				limit = n
+			}
+
+			if limit <= 0 || r.Body == nil || r.Body == http.NoBody {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if r.ContentLength > limit {
+				writeBodyTooLarge(w, r, bodyTooLargeDetail(limit), options.TraceKey)
+				return
+			}
+
+			bw := &bodyLimitWriter{ResponseWriter: w, r: r, limit: limit, traceKey: options.TraceKey}
+
+			// The body is replaced on a copy, leaving the request of the caller untouched.
+			r = r.WithContext(r.Context())
+			r.Body = &bodyLimitReader{ReadCloser: http.MaxBytesReader(w, r.Body, limit), w: bw}
+
+			next.ServeHTTP(bw, r)
+			bw.finish()
+		})
+	}
+}
+
+// writeBodyTooLarge writes a 413 Content Too Large problem response with detail.
+func writeBodyTooLarge(w http.ResponseWriter, r *http.Request, detail string, traceKey any) {
+	p := NewProblem(http.StatusRequestEntityTooLarge)
+	p.Detail = detail
+	p.Instance = r.URL.Path
+	p.TraceID = requestTraceID(w, r, traceKey)
+
+	WriteProblem(w, p)
+}
+
+// bodyTooLargeDetail returns the problem detail of bodies exceeding limit bytes.
+func bodyTooLargeDetail(limit int64) string {
+	return "request body exceeds " + strconv.FormatInt(limit, 10) + " bytes"
+}
+
+// bodyLimitReader records on its bodyLimitWriter the error of reads failing
+// because the body exceeds a limit.
+type bodyLimitReader struct {
+	io.ReadCloser
+	w *bodyLimitWriter
+}
+
+func (br *bodyLimitReader) Read(p []byte) (int, error) {
+	n, err := br.ReadCloser.Read(p)
+	if err != nil && br.w.err == nil && isBodyTooLarge(err) {
+		br.w.err = err
+	}
+
+	return n, err
+}
+
+// isBodyTooLarge reports whether err is caused by a request body exceeding a limit.
+func isBodyTooLarge(err error) bool {
+	var maxErr *http.MaxBytesError
+	return errors.As(err, &maxErr) || errors.Is(err, ErrDecompressedBodyTooLarge) || errors.Is(err, ErrDecompressionRatio)
+}
+
+// bodyLimitWriter replaces the response with a 413 problem response when
+// the request body exceeded its limit before the response headers were written.
+// err is the error of the read that exceeded the limit.
+type bodyLimitWriter struct {
+	http.ResponseWriter
+	r           *http.Request
+	limit       int64
+	traceKey    any
+	err         error
+	wroteHeader bool
+	discard     bool
+}
+
+func (bw *bodyLimitWriter) WriteHeader(code int) {
+	if bw.wroteHeader {
+		return
+	}
+
+	if code < http.StatusOK {
+		bw.ResponseWriter.WriteHeader(code)
+		return
+	}
+
+	bw.wroteHeader = true
+
+	if bw.err != nil {
+		detail := bodyTooLargeDetail(bw.limit)
+		if errors.Is(bw.err, ErrDecompressionRatio) {
+			detail = "request body exceeds the maximum decompression ratio"
+		}
+
+		bw.discard = true
+		writeBodyTooLarge(bw.ResponseWriter, bw.r, detail, bw.traceKey)
+
+		return
+	}
+
+	bw.ResponseWriter.WriteHeader(code)
+}
+
+func (bw *bodyLimitWriter) Write(b []byte) (int, error) {
+	if !bw.wroteHeader {
+		bw.WriteHeader(http.StatusOK)
+	}
+
+	if bw.discard {
+		return len(b), nil
+	}
+
+	return bw.ResponseWriter.Write(b)
+}
+
+// finish writes the 413 problem response when the body exceeded its limit
+// and the handler returned without writing a response.
+func (bw *bodyLimitWriter) finish() {
+	if bw.err != nil && !bw.wroteHeader {
+		bw.WriteHeader(http.StatusRequestEntityTooLarge)
+	}
+}
+
+// Flush sends the response headers and flushes the wrapped writer.
+func (bw *bodyLimitWriter) Flush() {
+	if !bw.wroteHeader {
+		bw.WriteHeader(http.StatusOK)
+	}
+
+	if !bw.discard {
+		_ = http.NewResponseController(bw.ResponseWriter).Flush()
+	}
+}
+
+// Unwrap returns the wrapped http.ResponseWriter, for http.ResponseController.
+func (bw *bodyLimitWriter) Unwrap() http.ResponseWriter {
+	return bw.ResponseWriter
+}
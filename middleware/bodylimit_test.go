@@ -0,0 +1,146 @@
+package middleware_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/paccolamano/goshare/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readAllHandler echoes the request body, answering 400 with the error on failure.
+var readAllHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, _ = w.Write(body)
+})
+
+func TestBodyLimit(t *testing.T) {
+	t.Parallel()
+
+	handler := middleware.BodyLimit(
+		middleware.WithBodyLimit(10),
+		middleware.WithRouteBodyLimit("POST /uploads", 100),
+		middleware.WithRouteBodyLimit("POST /stream", 0),
+	)(readAllHandler)
+
+	tests := []struct {
+		name    string
+		path    string
+		size    int
+		chunked bool
+		status  int
+	}{
+		{name: "within limit", path: "/", size: 10, status: http.StatusOK},
+		{name: "content length", path: "/", size: 11, status: http.StatusRequestEntityTooLarge},
+		{name: "chunked", path: "/", size: 11, chunked: true, status: http.StatusRequestEntityTooLarge},
+		{name: "route limit", path: "/uploads", size: 100, status: http.StatusOK},
+		{name: "route limit exceeded", path: "/uploads", size: 101, chunked: true, status: http.StatusRequestEntityTooLarge},
+		{name: "unlimited route", path: "/stream", size: 1000, chunked: true, status: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(strings.Repeat("a", tt.size)))
+			if tt.chunked {
+				req.ContentLength = -1
+			}
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			require.Equal(t, tt.status, w.Code)
+
+			if tt.status == http.StatusRequestEntityTooLarge {
+				assert.Equal(t, middleware.ProblemContentType, w.Header().Get("Content-Type"))
+
+				var p map[string]any
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+				assert.Contains(t, p["detail"], "request body exceeds")
+			}
+		})
+	}
+}
+
+func TestBodyLimitHandlerError(t *testing.T) {
+	t.Parallel()
+
+	var readErr error
+
+	handler := middleware.BodyLimit(middleware.WithBodyLimit(4))(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			_, readErr = io.ReadAll(r.Body)
+
+			w.Header().Set("X-Handler", "1")
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = io.WriteString(w, "handler body")
+		}))
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("too long"))
+	req.ContentLength = -1
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	var maxErr *http.MaxBytesError
+	require.ErrorAs(t, readErr, &maxErr)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.NotContains(t, w.Body.String(), "handler body")
+}
+
+func TestBodyLimitHandlerReturns(t *testing.T) {
+	t.Parallel()
+
+	handler := middleware.BodyLimit(middleware.WithBodyLimit(4))(http.HandlerFunc(
+		func(_ http.ResponseWriter, r *http.Request) {
+			_, _ = io.ReadAll(r.Body)
+		}))
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("too long"))
+	req.ContentLength = -1
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Equal(t, middleware.ProblemContentType, w.Header().Get("Content-Type"))
+}
+
+func TestBodyLimitKeepsRequest(t *testing.T) {
+	t.Parallel()
+
+	handler := middleware.BodyLimit(middleware.WithBodyLimit(4), middleware.WithBodyLimitTraceKey(traceKey{}))(readAllHandler)
+
+	body := io.NopCloser(strings.NewReader("too long"))
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.Body, req.ContentLength = body, -1
+	req = req.WithContext(context.WithValue(req.Context(), traceKey{}, "trace-1"))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.True(t, req.Body == body, "the caller's request body should not be replaced")
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	var p map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+	assert.Equal(t, "trace-1", p["traceId"])
+}
+
+func TestBodyLimitKeepsPathValues(t *testing.T) {
+	t.Parallel()
+
+	assertPathValuesKept(t, middleware.BodyLimit(middleware.WithRouteBodyLimit("/other/", 10)))
+}
@@ -0,0 +1,581 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheStatusHeader is the response header set by the Cache middleware
+// to one of CacheHit, CacheStale, CacheMiss or CacheBypass.
+const CacheStatusHeader = "X-Cache"
+
+// Values of the CacheStatusHeader.
+const (
+	// CacheHit is set on fresh responses served from the cache.
+	CacheHit = "HIT"
+	// CacheStale is set on stale responses served while they are revalidated.
+	CacheStale = "STALE"
+	// CacheMiss is set on responses served by the next handler.
+	CacheMiss = "MISS"
+	// CacheBypass is set on responses to requests forbidding the use of the cache.
+	CacheBypass = "BYPASS"
+)
+
+// cacheableStatus lists the status codes of the responses stored by the Cache
+// middleware, those heuristically cacheable according to RFC 9110.
+var cacheableStatus = []int{
+	http.StatusOK, http.StatusNonAuthoritativeInfo, http.StatusNoContent,
+	http.StatusMultipleChoices, http.StatusMovedPermanently, http.StatusPermanentRedirect,
+	http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusGone,
+	http.StatusRequestURITooLong, http.StatusNotImplemented,
+}
+
+// CacheKeyFunc returns the key a response is cached by.
+type CacheKeyFunc func(r *http.Request) string
+
+// CacheKeyByURL caches responses by method, host, path and query.
+// Query parameters are sorted, so that their order does not matter.
+func CacheKeyByURL(r *http.Request) string {
+	return r.Method + " " + r.Host + r.URL.Path + "?" + r.URL.Query().Encode()
+}
+
+// CacheKeyByPath caches responses by method, host and path, ignoring the query.
+func CacheKeyByPath(r *http.Request) string {
+	return r.Method + " " + r.Host + r.URL.Path
+}
+
+// CacheKeyByHeaders extends the key returned by base with the values of the
+// request headers names, such as a tenant header.
+func CacheKeyByHeaders(base CacheKeyFunc, names ...string) CacheKeyFunc {
+	return func(r *http.Request) string {
+		var b strings.Builder
+
+		b.WriteString(base(r))
+
+		for _, name := range names {
+			b.WriteString("\n" + name + ": " + strings.Join(r.Header.Values(name), ","))
+		}
+
+		return b.String()
+	}
+}
+
+// CacheOptions holds configuration options for the Cache middleware.
+type CacheOptions struct {
+	Store                CacheStore
+	Key                  CacheKeyFunc
+	DefaultTTL           time.Duration
+	StaleWhileRevalidate time.Duration
+	MaxBodySize          int
+	CredentialHeaders    []string
+	Logger               InfoLogger
+}
+
+// CacheOption represents a functional option for configuring Cache middleware.
+type CacheOption func(*CacheOptions)
+
+// WithCacheStore sets the store of the responses. The default is a
+// MemoryCacheStore, local to the middleware.
+func WithCacheStore(s CacheStore) CacheOption {
+	return func(opt *CacheOptions) {
+		opt.Store = s
+	}
+}
+
+// WithCacheKey sets the function returning the key responses are cached by,
+// such as CacheKeyByURL (the default), CacheKeyByPath or CacheKeyByHeaders.
+func WithCacheKey(f CacheKeyFunc) CacheOption {
+	return func(opt *CacheOptions) {
+		opt.Key = f
+	}
+}
+
+// WithCacheDefaultTTL sets the freshness lifetime of responses without
+// max-age, s-maxage or Expires. The default is 0: such responses are not stored.
+func WithCacheDefaultTTL(ttl time.Duration) CacheOption {
+	return func(opt *CacheOptions) {
+		opt.DefaultTTL = ttl
+	}
+}
+
+// WithStaleWhileRevalidate sets how long stale responses without a
+// stale-while-revalidate directive are served while they are revalidated.
+// The default is 0.
+func WithStaleWhileRevalidate(d time.Duration) CacheOption {
+	return func(opt *CacheOptions) {
+		opt.StaleWhileRevalidate = d
+	}
+}
+
+// WithCacheMaxBodySize sets the maximum size of the stored response bodies.
+// The default is 1 MiB.
+func WithCacheMaxBodySize(n int) CacheOption {
+	return func(opt *CacheOptions) {
+		opt.MaxBodySize = n
+	}
+}
+
+// WithCacheCredentialHeaders adds request headers carrying credentials, such as
+// X-Api-Key, to those preventing responses from being stored, by default
+// Authorization and Cookie. It can be used multiple times.
+func WithCacheCredentialHeaders(names ...string) CacheOption {
+	return func(opt *CacheOptions) {
+		opt.CredentialHeaders = append(opt.CredentialHeaders, names...)
+	}
+}
+
+// WithCacheLogger sets a custom InfoLogger logging store failures and revalidation panics.
+func WithCacheLogger(l InfoLogger) CacheOption {
+	return func(opt *CacheOptions) {
+		opt.Logger = l
+	}
+}
+
+// Cache returns a middleware caching the responses to GET and HEAD requests
+// according to their Cache-Control header, as a shared cache.
+//
+// Responses are stored when their status is heuristically cacheable and they
+// have a freshness lifetime, given by the s-maxage or max-age directives, the
+// Expires header or WithCacheDefaultTTL. Responses with a Set-Cookie header,
+// a no-store, no-cache or private directive or a "Vary: *" header are not
+// stored, nor responses to requests with credentials, an Authorization or Cookie
+// header or one set with WithCacheCredentialHeaders, unless they have a public,
+// s-maxage or must-revalidate directive.
+//
+// Responses with a Vary header are stored per variant. Stale responses are
+// served for the duration of their stale-while-revalidate directive, or of
+// WithStaleWhileRevalidate, while a single background request revalidates them,
+// unless they have a must-revalidate or proxy-revalidate directive. Concurrent
+// requests missing the same key wait for the first one and are served its
+// response, if stored.
+// Requests with a no-store directive bypass the cache, those with a no-cache
+// directive or a max-age smaller than the age of the stored response are
+// served by the next handler.
+//
+// Stored responses are served to any request with the same key, credentials or
+// not: place Cache after Auth, so that requests are authenticated first, and
+// vary the key on the credentials of responses specific to a principal.
+//
+// Responses carry a CacheStatusHeader, and an Age header when served from the
+// cache. FieldCache is not a default Logger field: select it with WithFields to
+// log the cache status of each request.
+//
+// Example usage:
+//
+//	http.Handle("GET /products/", Cache(WithCacheStore(NewMemoryCacheStore(WithCacheMaxBytes(256<<20))),
+//		WithStaleWhileRevalidate(time.Minute))(productsHandler))
+//
+//	http.ListenAndServe(":8080", Logger(WithSingleRecord(), WithFields(FieldMethod, FieldPath,
+//		FieldStatus, FieldDuration, FieldCache))(mux))
+func Cache(opts ...CacheOption) func(http.Handler) http.Handler {
+	options := &CacheOptions{
+		Key:               CacheKeyByURL,
+		MaxBodySize:       1 << 20,
+		CredentialHeaders: []string{"Authorization", "Cookie"},
+		Logger:            slog.Default(),
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	if options.Store == nil {
+		options.Store = NewMemoryCacheStore()
+	}
+
+	return func(next http.Handler) http.Handler {
+		c := &cache{options: options, next: next, flights: make(map[string]chan struct{})}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cc := parseCacheControl(r.Header.Values("Cache-Control"))
+			if cc.has("no-store") {
+				w.Header().Set(CacheStatusHeader, CacheBypass)
+				next.ServeHTTP(w, r)
+
+				return
+			}
+
+			c.serve(w, r, options.Key(r), cc)
+		})
+	}
+}
+
+// cache serves the requests of a Cache middleware.
+type cache struct {
+	options *CacheOptions
+	next    http.Handler
+	mu      sync.Mutex
+	flights map[string]chan struct{}
+}
+
+// serve serves r from the cache, or from the next handler on misses.
+func (c *cache) serve(w http.ResponseWriter, r *http.Request, key string, cc cacheControl) {
+	lookupKey, resp := c.lookup(r, key)
+	if c.serveStored(w, r, key, lookupKey, resp, cc) {
+		return
+	}
+
+	done, leader := c.join(lookupKey)
+	if !leader {
+		select {
+		case <-done:
+		case <-r.Context().Done():
+			return
+		}
+
+		// The response of the leader is served if it was stored and matches the variant of r.
+		lookupKey, resp = c.lookup(r, key)
+		if c.serveStored(w, r, key, lookupKey, resp, cc) {
+			return
+		}
+
+		c.fetch(w, r, key)
+
+		return
+	}
+
+	defer c.leave(lookupKey)
+
+	c.fetch(w, r, key)
+}
+
+// serveStored writes resp if it can be served to r, revalidating it in the
+// background when stale. It reports whether resp was written.
+func (c *cache) serveStored(w http.ResponseWriter, r *http.Request, key, lookupKey string, resp *CachedResponse, cc cacheControl) bool {
+	if resp == nil || cc.has("no-cache") {
+		return false
+	}
+
+	age := time.Since(resp.Stored)
+	if maxAge, ok := cc.duration("max-age"); ok && age > maxAge {
+		return false
+	}
+
+	switch {
+	case age < resp.TTL:
+		writeCached(w, r, resp, CacheHit, age)
+	case age < resp.TTL+resp.StaleWhileRevalidate:
+		c.revalidate(r, key, lookupKey)
+		writeCached(w, r, resp, CacheStale, age)
+	default:
+		return false
+	}
+
+	return true
+}
+
+// lookup returns the response stored for r under key, or nil, and the key it
+// is looked up by, which depends on the request headers for responses with variants.
+func (c *cache) lookup(r *http.Request, key string) (string, *CachedResponse) {
+	resp := c.get(r.Context(), key)
+	if resp == nil || resp.Status != 0 {
+		return key, resp
+	}
+
+	key = variantKey(key, resp.Vary, r)
+
+	return key, c.get(r.Context(), key)
+}
+
+// get returns the response stored under key, or nil.
+func (c *cache) get(ctx context.Context, key string) *CachedResponse {
+	resp, found, err := c.options.Store.Get(ctx, key)
+	if err != nil {
+		c.options.Logger.InfoContext(ctx, "cache store failed", "error", err, "key", key)
+		return nil
+	}
+
+	if !found {
+		return nil
+	}
+
+	return resp
+}
+
+// fetch serves r with the next handler and stores its response.
+func (c *cache) fetch(w http.ResponseWriter, r *http.Request, key string) {
+	w.Header().Set(CacheStatusHeader, CacheMiss)
+
+	before := w.Header().Clone()
+	body := &limitedBuffer{max: c.options.MaxBodySize}
+	rec := newResponseRecorder(w, body)
+
+	c.next.ServeHTTP(rec, r)
+
+	if rec.Hijacked() || body.truncated {
+		return
+	}
+
+	// Only the headers set by the handler are stored, leaving out those of
+	// the previous middlewares, such as trace IDs.
+	c.store(context.WithoutCancel(r.Context()), r, key, rec.Status(), changedHeader(before, w.Header()), body.Bytes())
+}
+
+// revalidate refreshes the response stored under lookupKey in the background,
+// unless a request is already refreshing it.
+func (c *cache) revalidate(r *http.Request, key, lookupKey string) {
+	if _, leader := c.join(lookupKey); !leader {
+		return
+	}
+
+	ctx := context.WithoutCancel(r.Context())
+	req := r.Clone(ctx)
+	req.Header.Del("If-None-Match")
+	req.Header.Del("If-Modified-Since")
+
+	go func() {
+		defer c.leave(lookupKey)
+
+		defer func() {
+			if v := recover(); v != nil {
+				c.options.Logger.InfoContext(ctx, "cache revalidation panicked", "panic", v, "key", key)
+			}
+		}()
+
+		w := &discardResponseWriter{header: make(http.Header)}
+		body := &limitedBuffer{max: c.options.MaxBodySize}
+		rec := newResponseRecorder(w, body)
+
+		c.next.ServeHTTP(rec, req)
+
+		if !body.truncated {
+			c.store(ctx, req, key, rec.Status(), w.header, body.Bytes())
+		}
+	}()
+}
+
+// credentials reports whether r carries one of the credential headers.
+func (c *cache) credentials(r *http.Request) bool {
+	return slices.ContainsFunc(c.options.CredentialHeaders, func(name string) bool {
+		return r.Header.Get(name) != ""
+	})
+}
+
+// store stores the response to r under key if it is cacheable.
+func (c *cache) store(ctx context.Context, r *http.Request, key string, status int, header http.Header, body []byte) {
+	cc := parseCacheControl(header.Values("Cache-Control"))
+
+	switch {
+	case !slices.Contains(cacheableStatus, status),
+		cc.has("no-store"), cc.has("no-cache"), cc.has("private"),
+		header.Get("Set-Cookie") != "",
+		c.credentials(r) && !cc.has("public") && !cc.has("s-maxage") && !cc.has("must-revalidate"):
+		return
+	}
+
+	vary, ok := parseVary(header)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+
+	ttl := c.freshness(cc, header, now)
+	if ttl <= 0 {
+		return
+	}
+
+	swr, ok := cc.duration("stale-while-revalidate")
+	switch {
+	case cc.has("must-revalidate"), cc.has("proxy-revalidate"):
+		// Such responses must not be served stale (RFC 9111, section 5.2.2.2).
+		swr = 0
+	case !ok:
+		swr = c.options.StaleWhileRevalidate
+	}
+
+	resp := &CachedResponse{
+		Status:               status,
+		Header:               header,
+		Body:                 body,
+		Vary:                 vary,
+		Stored:               now,
+		TTL:                  ttl,
+		StaleWhileRevalidate: swr,
+	}
+
+	if len(vary) > 0 {
+		index := &CachedResponse{Vary: vary, Stored: now, TTL: ttl, StaleWhileRevalidate: swr}
+		if err := c.options.Store.Set(ctx, key, index, ttl+swr); err != nil {
+			c.options.Logger.InfoContext(ctx, "cache store failed", "error", err, "key", key)
+			return
+		}
+
+		key = variantKey(key, vary, r)
+	}
+
+	if err := c.options.Store.Set(ctx, key, resp, ttl+swr); err != nil {
+		c.options.Logger.InfoContext(ctx, "cache store failed", "error", err, "key", key)
+	}
+}
+
+// freshness returns the freshness lifetime of a response.
+func (c *cache) freshness(cc cacheControl, header http.Header, now time.Time) time.Duration {
+	if d, ok := cc.duration("s-maxage"); ok {
+		return d
+	}
+
+	if d, ok := cc.duration("max-age"); ok {
+		return d
+	}
+
+	if v := header.Get("Expires"); v != "" {
+		expires, err := http.ParseTime(v)
+		if err != nil {
+			return 0
+		}
+
+		if date, err := http.ParseTime(header.Get("Date")); err == nil {
+			now = date
+		}
+
+		return expires.Sub(now)
+	}
+
+	return c.options.DefaultTTL
+}
+
+// join registers a request fetching the response stored under key. It returns
+// a channel closed when the request completes and whether the caller is that
+// request, or must wait for the channel.
+func (c *cache) join(key string) (<-chan struct{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if done, found := c.flights[key]; found {
+		return done, false
+	}
+
+	done := make(chan struct{})
+	c.flights[key] = done
+
+	return done, true
+}
+
+// leave signals the completion of the request registered by join.
+func (c *cache) leave(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	close(c.flights[key])
+	delete(c.flights, key)
+}
+
+// writeCached writes resp with the cache status and age.
+func writeCached(w http.ResponseWriter, r *http.Request, resp *CachedResponse, status string, age time.Duration) {
+	h := w.Header()
+	for k, v := range resp.Header {
+		h[k] = slices.Clone(v)
+	}
+
+	h.Set("Age", strconv.Itoa(int(age.Seconds())))
+	h.Set(CacheStatusHeader, status)
+	w.WriteHeader(resp.Status)
+
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(resp.Body)
+	}
+}
+
+// variantKey returns the key of the variant of the response stored under key
+// selected by the values of the request headers vary.
+func variantKey(key string, vary []string, r *http.Request) string {
+	var b strings.Builder
+
+	b.WriteString(key)
+
+	for _, name := range vary {
+		b.WriteString("\x00" + name + ": " + strings.Join(r.Header.Values(name), ","))
+	}
+
+	return b.String()
+}
+
+// parseVary returns the sorted header names of the Vary header of a response.
+// It returns false for "Vary: *", which prevents caching.
+func parseVary(header http.Header) ([]string, bool) {
+	var names []string
+
+	for _, v := range header.Values("Vary") {
+		for name := range strings.SplitSeq(v, ",") {
+			name = strings.TrimSpace(name)
+
+			switch name {
+			case "":
+			case "*":
+				return nil, false
+			default:
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+
+	slices.Sort(names)
+
+	return slices.Compact(names), true
+}
+
+// cacheControl holds the directives of a Cache-Control header, by lowercase name.
+type cacheControl map[string]string
+
+func parseCacheControl(values []string) cacheControl {
+	cc := make(cacheControl)
+
+	for _, v := range values {
+		for d := range strings.SplitSeq(v, ",") {
+			name, value, _ := strings.Cut(strings.TrimSpace(d), "=")
+			if name != "" {
+				cc[strings.ToLower(name)] = strings.Trim(strings.TrimSpace(value), `"`)
+			}
+		}
+	}
+
+	return cc
+}
+
+func (cc cacheControl) has(name string) bool {
+	_, ok := cc[name]
+	return ok
+}
+
+// duration returns the value of the directive name, in seconds, and whether it is valid.
+func (cc cacheControl) duration(name string) (time.Duration, bool) {
+	v, ok := cc[name]
+	if !ok {
+		return 0, false
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+
+	return time.Duration(n) * time.Second, true
+}
+
+// discardResponseWriter is an http.ResponseWriter discarding the response,
+// used to revalidate cached responses in the background.
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (w *discardResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *discardResponseWriter) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (w *discardResponseWriter) WriteHeader(int) {}
@@ -0,0 +1,417 @@
+package middleware_test
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/paccolamano/goshare/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+// countingHandler answers with the number of calls, setting the given Cache-Control header.
+func countingHandler(calls *atomic.Int32, cacheControl string) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		n := calls.Add(1)
+
+		if cacheControl != "" {
+			w.Header().Set("Cache-Control", cacheControl)
+		}
+
+		_, _ = w.Write([]byte(strconv.Itoa(int(n))))
+	}
+}
+
+func serveCache(h http.Handler, req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	return w
+}
+
+func TestCacheHit(t *testing.T) {
+	t.Parallel()
+
+	var calls atomic.Int32
+
+	h := middleware.Cache()(countingHandler(&calls, "max-age=60"))
+
+	w := serveCache(h, httptest.NewRequest(http.MethodGet, "/items?b=2&a=1", nil))
+	assert.Equal(t, middleware.CacheMiss, w.Header().Get(middleware.CacheStatusHeader))
+	assert.Equal(t, "1", w.Body.String())
+
+	// The query order does not change the key.
+	w = serveCache(h, httptest.NewRequest(http.MethodGet, "/items?a=1&b=2", nil))
+	assert.Equal(t, middleware.CacheHit, w.Header().Get(middleware.CacheStatusHeader))
+	assert.Equal(t, "max-age=60", w.Header().Get("Cache-Control"))
+	assert.Equal(t, "0", w.Header().Get("Age"))
+	assert.Equal(t, "1", w.Body.String())
+
+	w = serveCache(h, httptest.NewRequest(http.MethodGet, "/items?a=2", nil))
+	assert.Equal(t, middleware.CacheMiss, w.Header().Get(middleware.CacheStatusHeader))
+	assert.Equal(t, "2", w.Body.String())
+
+	// Other methods are not cached.
+	w = serveCache(h, httptest.NewRequest(http.MethodPost, "/items?a=1&b=2", nil))
+	assert.Empty(t, w.Header().Get(middleware.CacheStatusHeader))
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+func TestCacheNotStored(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		request func(r *http.Request)
+	}{
+		{
+			name:    "no freshness",
+			handler: func(_ http.ResponseWriter, _ *http.Request) {},
+		},
+		{
+			name: "no-store",
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("Cache-Control", "max-age=60, no-store")
+			},
+		},
+		{
+			name: "private",
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("Cache-Control", "private, max-age=60")
+			},
+		},
+		{
+			name: "set cookie",
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("Cache-Control", "max-age=60")
+				w.Header().Set("Set-Cookie", "session=1")
+			},
+		},
+		{
+			name: "vary star",
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("Cache-Control", "max-age=60")
+				w.Header().Set("Vary", "*")
+			},
+		},
+		{
+			name: "server error",
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("Cache-Control", "max-age=60")
+				w.WriteHeader(http.StatusInternalServerError)
+			},
+		},
+		{
+			name: "authorization",
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("Cache-Control", "max-age=60")
+			},
+			request: func(r *http.Request) {
+				r.Header.Set("Authorization", "Bearer token")
+			},
+		},
+		{
+			name: "cookie",
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("Cache-Control", "max-age=60")
+			},
+			request: func(r *http.Request) {
+				r.Header.Set("Cookie", "session=1")
+			},
+		},
+		{
+			name: "large body",
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("Cache-Control", "max-age=60")
+				_, _ = w.Write(make([]byte, 11))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			store := middleware.NewMemoryCacheStore()
+			h := middleware.Cache(middleware.WithCacheStore(store), middleware.WithCacheMaxBodySize(10))(tt.handler)
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.request != nil {
+				tt.request(req)
+			}
+
+			serveCache(h, req)
+			assert.Equal(t, 0, store.Len())
+		})
+	}
+}
+
+func TestCacheCredentialHeaders(t *testing.T) {
+	t.Parallel()
+
+	store := middleware.NewMemoryCacheStore()
+	mw := middleware.Cache(middleware.WithCacheStore(store), middleware.WithCacheCredentialHeaders("X-Api-Key"))
+
+	req := httptest.NewRequest(http.MethodGet, "/private", nil)
+	req.Header.Set("X-Api-Key", "key")
+
+	var calls atomic.Int32
+
+	serveCache(mw(countingHandler(&calls, "max-age=60")), req)
+	assert.Equal(t, 0, store.Len())
+
+	// Public responses are stored, credentials or not.
+	req = httptest.NewRequest(http.MethodGet, "/public", nil)
+	req.Header.Set("X-Api-Key", "key")
+
+	serveCache(mw(countingHandler(&calls, "public, max-age=60")), req)
+	assert.Equal(t, 1, store.Len())
+}
+
+func TestCacheFreshness(t *testing.T) {
+	t.Parallel()
+
+	var calls atomic.Int32
+
+	h := middleware.Cache(middleware.WithCacheDefaultTTL(time.Minute))(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+
+			switch r.URL.Path {
+			case "/expires":
+				w.Header().Set("Date", time.Now().UTC().Format(http.TimeFormat))
+				w.Header().Set("Expires", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+			case "/expired":
+				w.Header().Set("Expires", "0")
+			}
+		}))
+
+	for _, path := range []string{"/default", "/expires", "/expired"} {
+		serveCache(h, httptest.NewRequest(http.MethodGet, path, nil))
+		serveCache(h, httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	assert.Equal(t, int32(4), calls.Load(), "only /expired should be served twice")
+}
+
+func TestCacheRequestDirectives(t *testing.T) {
+	t.Parallel()
+
+	var calls atomic.Int32
+
+	h := middleware.Cache()(countingHandler(&calls, "max-age=60"))
+	serveCache(h, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	tests := []struct {
+		cacheControl string
+		status       string
+	}{
+		{cacheControl: "no-store", status: middleware.CacheBypass},
+		{cacheControl: "no-cache", status: middleware.CacheMiss},
+		{cacheControl: "max-age=10", status: middleware.CacheHit},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Cache-Control", tt.cacheControl)
+
+		w := serveCache(h, req)
+		assert.Equal(t, tt.status, w.Header().Get(middleware.CacheStatusHeader), tt.cacheControl)
+	}
+
+	// The response stored by the no-cache request replaced the first one.
+	assert.Equal(t, "3", serveCache(h, httptest.NewRequest(http.MethodGet, "/", nil)).Body.String())
+}
+
+func TestCacheVary(t *testing.T) {
+	t.Parallel()
+
+	var calls atomic.Int32
+
+	h := middleware.Cache()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "accept-language")
+		_, _ = w.Write([]byte(r.Header.Get("Accept-Language")))
+	}))
+
+	for _, lang := range []string{"en", "it", "en", "it"} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept-Language", lang)
+
+		w := serveCache(h, req)
+		assert.Equal(t, lang, w.Body.String())
+	}
+
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestCacheKeyByHeaders(t *testing.T) {
+	t.Parallel()
+
+	var calls atomic.Int32
+
+	h := middleware.Cache(middleware.WithCacheKey(
+		middleware.CacheKeyByHeaders(middleware.CacheKeyByPath, "X-Tenant")))(countingHandler(&calls, "max-age=60"))
+
+	for _, target := range []string{"/?a=1", "/?a=2"} {
+		for _, tenant := range []string{"a", "b"} {
+			req := httptest.NewRequest(http.MethodGet, target, nil)
+			req.Header.Set("X-Tenant", tenant)
+			serveCache(h, req)
+		}
+	}
+
+	assert.Equal(t, int32(2), calls.Load(), "responses should be cached per tenant, ignoring the query")
+}
+
+func TestCacheStaleWhileRevalidate(t *testing.T) {
+	t.Parallel()
+
+	var calls atomic.Int32
+
+	revalidated := make(chan struct{}, 1)
+
+	h := middleware.Cache()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		countingHandler(&calls, "max-age=1, stale-while-revalidate=60")(w, r)
+
+		if calls.Load() > 1 {
+			revalidated <- struct{}{}
+		}
+	}))
+
+	assert.Equal(t, "1", serveCache(h, httptest.NewRequest(http.MethodGet, "/", nil)).Body.String())
+
+	time.Sleep(1100 * time.Millisecond)
+
+	w := serveCache(h, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, middleware.CacheStale, w.Header().Get(middleware.CacheStatusHeader))
+	assert.Equal(t, "1", w.Body.String())
+
+	select {
+	case <-revalidated:
+	case <-time.After(time.Second):
+		t.Fatal("stale response not revalidated")
+	}
+
+	require.Eventually(t, func() bool {
+		w := serveCache(h, httptest.NewRequest(http.MethodGet, "/", nil))
+		return w.Header().Get(middleware.CacheStatusHeader) == middleware.CacheHit && w.Body.String() == "2"
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestCacheCoalescing(t *testing.T) {
+	t.Parallel()
+
+	var calls atomic.Int32
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+
+	h := middleware.Cache()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Load() == 0 {
+			close(started)
+			<-release
+		}
+
+		countingHandler(&calls, "max-age=60")(w, r)
+	}))
+
+	var wg sync.WaitGroup
+
+	results := make([]*httptest.ResponseRecorder, 10)
+	for i := range results {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			if i > 0 {
+				<-started
+			}
+
+			results[i] = serveCache(h, httptest.NewRequest(http.MethodGet, "/", nil))
+		}()
+	}
+
+	<-started
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), calls.Load())
+
+	for _, w := range results {
+		assert.Equal(t, "1", w.Body.String())
+	}
+}
+
+func TestCacheStoreFailure(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	errStore := errors.New("store unavailable")
+
+	store := NewMockCacheStore(ctrl)
+	store.EXPECT().Get(gomock.Any(), gomock.Any()).Return(nil, false, errStore)
+	store.EXPECT().Set(gomock.Any(), gomock.Any(), gomock.Any(), time.Minute).Return(errStore)
+
+	l := NewMockInfoLogger(ctrl)
+	l.EXPECT().InfoContext(gomock.Any(), "cache store failed", "error", errStore, "key", gomock.Any()).Times(2)
+
+	var calls atomic.Int32
+
+	h := middleware.Cache(middleware.WithCacheStore(store), middleware.WithCacheLogger(l))(countingHandler(&calls, "max-age=60"))
+
+	w := serveCache(h, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1", w.Body.String())
+}
+
+func TestCacheLoggerField(t *testing.T) {
+	t.Parallel()
+
+	buf := &bytes.Buffer{}
+	l := slog.New(slog.NewJSONHandler(buf, nil))
+
+	var calls atomic.Int32
+
+	h := middleware.Logger(
+		middleware.WithLogger(l),
+		middleware.WithSingleRecord(),
+		middleware.WithFields(middleware.FieldPath, middleware.FieldCache),
+	)(middleware.Cache()(countingHandler(&calls, "max-age=60")))
+
+	serveCache(h, httptest.NewRequest(http.MethodGet, "/", nil))
+	serveCache(h, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Contains(t, buf.String(), `"cache":"MISS"`)
+	assert.Contains(t, buf.String(), `"cache":"HIT"`)
+}
+
+func TestCacheMustRevalidate(t *testing.T) {
+	t.Parallel()
+
+	var calls atomic.Int32
+
+	h := middleware.Cache(middleware.WithStaleWhileRevalidate(time.Minute))(countingHandler(&calls, "max-age=1, must-revalidate"))
+
+	serveCache(h, httptest.NewRequest(http.MethodGet, "/", nil))
+	time.Sleep(1100 * time.Millisecond)
+
+	w := serveCache(h, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, middleware.CacheMiss, w.Header().Get(middleware.CacheStatusHeader))
+	assert.Equal(t, "2", w.Body.String())
+}
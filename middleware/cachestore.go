@@ -0,0 +1,204 @@
+package middleware
+
+import (
+	"container/list"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+//go:generate mockgen -source=cachestore.go -destination=cachestore_mock_test.go -package=middleware_test
+
+// CachedResponse is a response stored by the Cache middleware in a CacheStore.
+type CachedResponse struct {
+	Status int
+	Header http.Header
+	Body   []byte
+	// Vary lists the request headers selecting the variant of the response.
+	// Responses with a Vary header are stored under a key derived from the values
+	// of these headers, and a CachedResponse with only Vary set, called a variant
+	// index, is stored under the request key.
+	Vary []string
+	// Stored is when the response was generated.
+	Stored time.Time
+	// TTL is the freshness lifetime of the response.
+	TTL time.Duration
+	// StaleWhileRevalidate is how long after TTL the response can be served
+	// while it is revalidated in the background.
+	StaleWhileRevalidate time.Duration
+}
+
+// size returns the approximate memory size of c, in bytes.
+func (c *CachedResponse) size() int {
+	n := len(c.Body)
+
+	for k, v := range c.Header {
+		n += len(k)
+		for _, s := range v {
+			n += len(s)
+		}
+	}
+
+	for _, v := range c.Vary {
+		n += len(v)
+	}
+
+	return n
+}
+
+// CacheStore stores the responses of the Cache middleware. Implementations backed
+// by external services, such as Redis, allow sharing responses between server instances.
+type CacheStore interface {
+	// Get returns the response stored under key and whether it was found.
+	Get(ctx context.Context, key string) (*CachedResponse, bool, error)
+	// Set stores resp under key. It can be discarded after ttl.
+	Set(ctx context.Context, key string, resp *CachedResponse, ttl time.Duration) error
+	// Delete removes the response stored under key.
+	Delete(ctx context.Context, key string) error
+}
+
+// MemoryCacheStore is an in-memory CacheStore evicting the least recently used
+// responses when it exceeds its maximum number of entries or size.
+type MemoryCacheStore struct {
+	mu         sync.Mutex
+	maxEntries int
+	maxBytes   int
+	bytes      int
+	lru        *list.List
+	entries    map[string]*list.Element
+}
+
+type cacheEntry struct {
+	key     string
+	resp    *CachedResponse
+	size    int
+	expires time.Time
+}
+
+// MemoryCacheStoreOptions holds configuration options for the MemoryCacheStore.
+type MemoryCacheStoreOptions struct {
+	MaxEntries int
+	MaxBytes   int
+}
+
+// MemoryCacheStoreOption represents a functional option for configuring a MemoryCacheStore.
+type MemoryCacheStoreOption func(*MemoryCacheStoreOptions)
+
+// WithCacheMaxEntries sets the maximum number of responses of the store.
+// A non-positive value removes the limit. The default is 10000.
+func WithCacheMaxEntries(n int) MemoryCacheStoreOption {
+	return func(opt *MemoryCacheStoreOptions) {
+		opt.MaxEntries = n
+	}
+}
+
+// WithCacheMaxBytes sets the maximum size of the store, as the sum of the sizes
+// of the stored keys, headers and bodies. A non-positive value removes the limit.
+// The default is 64 MiB.
+func WithCacheMaxBytes(n int) MemoryCacheStoreOption {
+	return func(opt *MemoryCacheStoreOptions) {
+		opt.MaxBytes = n
+	}
+}
+
+// NewMemoryCacheStore creates a MemoryCacheStore.
+func NewMemoryCacheStore(opts ...MemoryCacheStoreOption) *MemoryCacheStore {
+	options := &MemoryCacheStoreOptions{
+		MaxEntries: 10000,
+		MaxBytes:   64 << 20,
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	return &MemoryCacheStore{
+		maxEntries: options.MaxEntries,
+		maxBytes:   options.MaxBytes,
+		lru:        list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+// Get implements CacheStore.
+func (s *MemoryCacheStore) Get(_ context.Context, key string) (*CachedResponse, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, found := s.entries[key]
+	if !found {
+		return nil, false, nil
+	}
+
+	e := el.Value.(*cacheEntry)
+	if !time.Now().Before(e.expires) {
+		s.remove(el)
+		return nil, false, nil
+	}
+
+	s.lru.MoveToFront(el)
+
+	return e.resp, true, nil
+}
+
+// Set implements CacheStore. Responses larger than the maximum size are not stored.
+func (s *MemoryCacheStore) Set(_ context.Context, key string, resp *CachedResponse, ttl time.Duration) error {
+	e := &cacheEntry{key: key, resp: resp, size: len(key) + resp.size(), expires: time.Now().Add(ttl)}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, found := s.entries[key]; found {
+		s.remove(el)
+	}
+
+	if s.maxBytes > 0 && e.size > s.maxBytes {
+		return nil
+	}
+
+	s.entries[key] = s.lru.PushFront(e)
+	s.bytes += e.size
+
+	for (s.maxEntries > 0 && s.lru.Len() > s.maxEntries) || (s.maxBytes > 0 && s.bytes > s.maxBytes) {
+		s.remove(s.lru.Back())
+	}
+
+	return nil
+}
+
+// Delete implements CacheStore.
+func (s *MemoryCacheStore) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, found := s.entries[key]; found {
+		s.remove(el)
+	}
+
+	return nil
+}
+
+// Len returns the number of responses held by the store, expired ones included.
+func (s *MemoryCacheStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.lru.Len()
+}
+
+// Size returns the size of the store, in bytes.
+func (s *MemoryCacheStore) Size() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.bytes
+}
+
+// remove removes el from the store. The caller must hold s.mu.
+func (s *MemoryCacheStore) remove(el *list.Element) {
+	e := el.Value.(*cacheEntry)
+	s.lru.Remove(el)
+	delete(s.entries, e.key)
+	s.bytes -= e.size
+}
@@ -0,0 +1,87 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: cachestore.go
+//
+// Generated by this command:
+//
+//	mockgen -source=cachestore.go -destination=cachestore_mock_test.go -package=middleware_test
+//
+
+// Package middleware_test is a generated GoMock package.
+package middleware_test
+
+import (
+	context "context"
+	reflect "reflect"
+	time "time"
+
+	middleware "github.com/paccolamano/goshare/middleware"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockCacheStore is a mock of CacheStore interface.
+type MockCacheStore struct {
+	ctrl     *gomock.Controller
+	recorder *MockCacheStoreMockRecorder
+	isgomock struct{}
+}
+
+// MockCacheStoreMockRecorder is the mock recorder for MockCacheStore.
+type MockCacheStoreMockRecorder struct {
+	mock *MockCacheStore
+}
+
+// NewMockCacheStore creates a new mock instance.
+func NewMockCacheStore(ctrl *gomock.Controller) *MockCacheStore {
+	mock := &MockCacheStore{ctrl: ctrl}
+	mock.recorder = &MockCacheStoreMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockCacheStore) EXPECT() *MockCacheStoreMockRecorder {
+	return m.recorder
+}
+
+// Delete mocks base method.
+func (m *MockCacheStore) Delete(ctx context.Context, key string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", ctx, key)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockCacheStoreMockRecorder) Delete(ctx, key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockCacheStore)(nil).Delete), ctx, key)
+}
+
+// Get mocks base method.
+func (m *MockCacheStore) Get(ctx context.Context, key string) (*middleware.CachedResponse, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", ctx, key)
+	ret0, _ := ret[0].(*middleware.CachedResponse)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// Get indicates an expected call of Get.
+func (mr *MockCacheStoreMockRecorder) Get(ctx, key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockCacheStore)(nil).Get), ctx, key)
+}
+
+// Set mocks base method.
+func (m *MockCacheStore) Set(ctx context.Context, key string, resp *middleware.CachedResponse, ttl time.Duration) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Set", ctx, key, resp, ttl)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Set indicates an expected call of Set.
+func (mr *MockCacheStoreMockRecorder) Set(ctx, key, resp, ttl any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Set", reflect.TypeOf((*MockCacheStore)(nil).Set), ctx, key, resp, ttl)
+}
@@ -0,0 +1,77 @@
+package middleware_test
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/paccolamano/goshare/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryCacheStoreLRU(t *testing.T) {
+	t.Parallel()
+
+	s := middleware.NewMemoryCacheStore(middleware.WithCacheMaxEntries(2))
+	ctx := context.Background()
+
+	for i := range 2 {
+		require.NoError(t, s.Set(ctx, "k"+strconv.Itoa(i), &middleware.CachedResponse{Status: 200}, time.Minute))
+	}
+
+	// k0 becomes the most recently used entry, k1 is evicted.
+	_, found, err := s.Get(ctx, "k0")
+	require.NoError(t, err)
+	assert.True(t, found)
+
+	require.NoError(t, s.Set(ctx, "k2", &middleware.CachedResponse{Status: 200}, time.Minute))
+
+	for key, want := range map[string]bool{"k0": true, "k1": false, "k2": true} {
+		_, found, err := s.Get(ctx, key)
+		require.NoError(t, err)
+		assert.Equal(t, want, found, key)
+	}
+
+	require.NoError(t, s.Delete(ctx, "k0"))
+	assert.Equal(t, 1, s.Len())
+}
+
+func TestMemoryCacheStoreMaxBytes(t *testing.T) {
+	t.Parallel()
+
+	s := middleware.NewMemoryCacheStore(middleware.WithCacheMaxBytes(100))
+	ctx := context.Background()
+
+	body := []byte(strings.Repeat("a", 40))
+	for _, key := range []string{"k0", "k1", "k2"} {
+		require.NoError(t, s.Set(ctx, key, &middleware.CachedResponse{Status: 200, Body: body}, time.Minute))
+	}
+
+	assert.Equal(t, 2, s.Len())
+	assert.LessOrEqual(t, s.Size(), 100)
+
+	// Responses larger than the store are not stored.
+	require.NoError(t, s.Set(ctx, "large", &middleware.CachedResponse{Status: 200, Body: make([]byte, 200)}, time.Minute))
+
+	_, found, err := s.Get(ctx, "large")
+	require.NoError(t, err)
+	assert.False(t, found)
+}
+
+func TestMemoryCacheStoreExpiry(t *testing.T) {
+	t.Parallel()
+
+	s := middleware.NewMemoryCacheStore()
+	ctx := context.Background()
+
+	require.NoError(t, s.Set(ctx, "key", &middleware.CachedResponse{Status: 200}, time.Millisecond))
+	time.Sleep(5 * time.Millisecond)
+
+	_, found, err := s.Get(ctx, "key")
+	require.NoError(t, err)
+	assert.False(t, found)
+	assert.Equal(t, 0, s.Len())
+}
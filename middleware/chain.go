@@ -0,0 +1,189 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Middleware is a function wrapping an http.Handler, such as the ones
+// returned by Tracer, Logger or Recover.
+type Middleware = func(http.Handler) http.Handler
+
+// Chain is an immutable list of middlewares. The first middleware is the outermost:
+// it sees the request first and the response last.
+type Chain struct {
+	middlewares []Middleware
+}
+
+// NewChain creates a Chain of the given middlewares.
+//
+// Example usage:
+//
+//	chain := NewChain(Tracer(), Logger(), Recover())
+//	http.Handle("/api", chain.Then(yourHandler))
+func NewChain(middlewares ...Middleware) Chain {
+	return Chain{middlewares: slices.Clone(middlewares)}
+}
+
+// Append returns a new Chain with middlewares added after the ones of c.
+func (c Chain) Append(middlewares ...Middleware) Chain {
+	return Chain{middlewares: append(slices.Clip(c.middlewares), middlewares...)}
+}
+
+// Extend returns a new Chain with the middlewares of other added after the ones of c.
+func (c Chain) Extend(other Chain) Chain {
+	return c.Append(other.middlewares...)
+}
+
+// Then wraps h with the middlewares of c and returns the resulting handler.
+// A nil h is replaced with http.DefaultServeMux.
+func (c Chain) Then(h http.Handler) http.Handler {
+	if h == nil {
+		h = http.DefaultServeMux
+	}
+
+	for _, m := range slices.Backward(c.middlewares) {
+		h = m(h)
+	}
+
+	return h
+}
+
+// ThenFunc wraps f with the middlewares of c and returns the resulting handler.
+func (c Chain) ThenFunc(f http.HandlerFunc) http.Handler {
+	if f == nil {
+		return c.Then(nil)
+	}
+
+	return c.Then(f)
+}
+
+// DefaultOptions holds configuration options for the Default chain.
+type DefaultOptions struct {
+	Logger         *slog.Logger
+	TraceKey       any
+	RealIP         []RealIPOption
+	RealIPEnabled  bool
+	TracerOptions  []TracerOption
+	LoggerOptions  []LoggerOption
+	RecoverOptions []RecoverOption
+}
+
+// DefaultOption represents a functional option for configuring the Default chain.
+type DefaultOption func(*DefaultOptions)
+
+// WithDefaultLogger sets the logger shared by the Logger and Recover middlewares.
+func WithDefaultLogger(l *slog.Logger) DefaultOption {
+	return func(opt *DefaultOptions) {
+		opt.Logger = l
+	}
+}
+
+// WithDefaultTraceKey sets the trace key shared by the Tracer, Logger and Recover middlewares.
+func WithDefaultTraceKey(key any) DefaultOption {
+	return func(opt *DefaultOptions) {
+		opt.TraceKey = key
+	}
+}
+
+// WithDefaultRealIP adds the RealIP middleware, configured with opts,
+// in front of the Default chain.
+func WithDefaultRealIP(opts ...RealIPOption) DefaultOption {
+	return func(opt *DefaultOptions) {
+		opt.RealIPEnabled = true
+		opt.RealIP = opts
+	}
+}
+
+// WithTracerOptions sets additional options of the Tracer middleware.
+func WithTracerOptions(opts ...TracerOption) DefaultOption {
+	return func(opt *DefaultOptions) {
+		opt.TracerOptions = opts
+	}
+}
+
+// WithLoggerOptions sets additional options of the Logger middleware.
+func WithLoggerOptions(opts ...LoggerOption) DefaultOption {
+	return func(opt *DefaultOptions) {
+		opt.LoggerOptions = opts
+	}
+}
+
+// WithRecoverOptions sets additional options of the Recover middleware.
+func WithRecoverOptions(opts ...RecoverOption) DefaultOption {
+	return func(opt *DefaultOptions) {
+		opt.RecoverOptions = opts
+	}
+}
+
+// Default returns the recommended Chain: Tracer, then Logger, then Recover.
+//
+// Tracer comes first so that the trace ID is available to the other middlewares,
+// and Recover comes last so that Logger records the status of recovered panics.
+// The logger and trace key are shared by the three middlewares; middleware
+// specific options are applied after them and take precedence.
+//
+// Example usage:
+//
+//	http.ListenAndServe(":8080", Default(WithDefaultLogger(l)).Then(mux))
+func Default(opts ...DefaultOption) Chain {
+	options := &DefaultOptions{
+		Logger:   slog.Default(),
+		TraceKey: "traceUUID",
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	tracerOpts := append([]TracerOption{WithTraceKey(options.TraceKey)}, options.TracerOptions...)
+	loggerOpts := append([]LoggerOption{WithLogger(options.Logger), WithLoggerTraceKey(options.TraceKey)}, options.LoggerOptions...)
+	recoverOpts := append([]RecoverOption{WithRecoverLogger(options.Logger), WithRecoverTraceKey(options.TraceKey)}, options.RecoverOptions...)
+
+	var c Chain
+	if options.RealIPEnabled {
+		c = c.Append(RealIP(options.RealIP...))
+	}
+
+	return c.Append(Tracer(tracerOpts...), Logger(loggerOpts...), Recover(recoverOpts...))
+}
+
+// When returns a middleware applying m only to requests matching pred.
+// Other requests are passed directly to the next handler.
+func When(pred func(r *http.Request) bool, m Middleware) Middleware {
+	return func(next http.Handler) http.Handler {
+		wrapped := m(next)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if pred(r) {
+				wrapped.ServeHTTP(w, r)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ForPathPrefixes returns a middleware applying m only to requests whose path
+// is one of prefixes or below it, matching whole path segments: "/api" and
+// "/api/" match "/api" and "/api/items", but not "/apix".
+func ForPathPrefixes(m Middleware, prefixes ...string) Middleware {
+	return When(func(r *http.Request) bool {
+		path := r.URL.Path
+
+		return slices.ContainsFunc(prefixes, func(p string) bool {
+			return path == p || strings.HasPrefix(path, strings.TrimSuffix(p, "/")+"/")
+		})
+	}, m)
+}
+
+// ForMethods returns a middleware applying m only to requests
+// whose method is one of methods.
+func ForMethods(m Middleware, methods ...string) Middleware {
+	return When(func(r *http.Request) bool {
+		return slices.Contains(methods, r.Method)
+	}, m)
+}
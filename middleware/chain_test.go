@@ -0,0 +1,121 @@
+package middleware_test
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/paccolamano/goshare/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func tagMiddleware(tag string) middleware.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("X-Order", tag)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestChain(t *testing.T) {
+	t.Parallel()
+
+	base := middleware.NewChain(tagMiddleware("a"))
+	chain := base.Append(tagMiddleware("b")).Extend(middleware.NewChain(tagMiddleware("c")))
+
+	w := httptest.NewRecorder()
+	chain.ThenFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Add("X-Order", "handler")
+	}).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Equal(t, []string{"a", "b", "c", "handler"}, w.Header().Values("X-Order"))
+
+	w = httptest.NewRecorder()
+	base.Then(http.NotFoundHandler()).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Equal(t, []string{"a"}, w.Header().Values("X-Order"))
+}
+
+func TestDefaultChain(t *testing.T) {
+	t.Parallel()
+
+	buf := &bytes.Buffer{}
+	l := slog.New(slog.NewJSONHandler(buf, nil))
+
+	handler := middleware.Default(
+		middleware.WithDefaultLogger(l),
+		middleware.WithLoggerOptions(middleware.WithSingleRecord(), middleware.WithFields(middleware.FieldStatus, middleware.FieldTraceID)),
+	).ThenFunc(func(_ http.ResponseWriter, _ *http.Request) {
+		panic("something went wrong")
+	})
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	traceID := w.Header().Get("X-Request-ID")
+	require.NotEmpty(t, traceID)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+	assert.Contains(t, lines[0], `"msg":"recovered from panic"`)
+	assert.Contains(t, lines[0], `"traceUUID":"`+traceID+`"`)
+	assert.Contains(t, lines[1], `"msg":"request completed","status":500,"traceUUID":"`+traceID+`"`)
+}
+
+func TestConditionalMiddlewares(t *testing.T) {
+	t.Parallel()
+
+	handler := middleware.NewChain(
+		middleware.ForPathPrefixes(tagMiddleware("api"), "/api/"),
+		middleware.ForMethods(tagMiddleware("write"), http.MethodPost, http.MethodPut),
+		middleware.When(func(r *http.Request) bool { return r.URL.Query().Has("debug") }, tagMiddleware("debug")),
+	).Then(http.NotFoundHandler())
+
+	cases := []struct {
+		method   string
+		target   string
+		expected []string
+	}{
+		{http.MethodGet, "/", nil},
+		{http.MethodGet, "/api/items", []string{"api"}},
+		{http.MethodPost, "/api/items?debug", []string{"api", "write", "debug"}},
+		{http.MethodPut, "/static", []string{"write"}},
+	}
+
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(tc.method, tc.target, nil))
+
+		assert.Equal(t, tc.expected, w.Header().Values("X-Order"), tc.method+" "+tc.target)
+	}
+}
+
+func TestForPathPrefixes(t *testing.T) {
+	t.Parallel()
+
+	handler := middleware.ForPathPrefixes(tagMiddleware("v1"), "/v1")(http.NotFoundHandler())
+
+	cases := []struct {
+		target   string
+		expected []string
+	}{
+		{"/v1", []string{"v1"}},
+		{"/v1/items", []string{"v1"}},
+		{"/v1x", nil},
+		{"/v1-internal/items", nil},
+		{"/", nil},
+	}
+
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.target, nil))
+
+		assert.Equal(t, tc.expected, w.Header().Values("X-Order"), tc.target)
+	}
+}
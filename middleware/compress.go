@@ -0,0 +1,350 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/flate"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Content codings supported by the Compress middleware.
+const (
+	EncodingZstd    = "zstd"
+	EncodingGzip    = "gzip"
+	EncodingDeflate = "deflate"
+)
+
+// DefaultCompressContentTypes are the media types compressed by default.
+// Entries ending with "/*" match any subtype.
+var DefaultCompressContentTypes = []string{
+	"text/*",
+	"application/json",
+	"application/problem+json",
+	"application/javascript",
+	"application/xml",
+	"application/xhtml+xml",
+	"application/wasm",
+	"image/svg+xml",
+}
+
+// encoder is implemented by the gzip, flate and zstd writers.
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// encoderPools holds the pools of encoders by content coding.
+var encoderPools = map[string]*sync.Pool{
+	EncodingZstd: {New: func() any {
+		e, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		return e
+	}},
+	EncodingGzip: {New: func() any {
+		return gzip.NewWriter(nil)
+	}},
+	EncodingDeflate: {New: func() any {
+		e, _ := flate.NewWriter(nil, flate.DefaultCompression)
+		return e
+	}},
+}
+
+// CompressOptions holds configuration options for the Compress middleware.
+type CompressOptions struct {
+	Encodings    []string
+	MinSize      int
+	ContentTypes []string
+}
+
+// CompressOption represents a functional option for configuring Compress middleware.
+type CompressOption func(*CompressOptions)
+
+// WithEncodings sets the supported content codings, in order of preference
+// among the ones accepted by the client with the same q-value.
+// The default is zstd, gzip and deflate; unknown codings are ignored.
+func WithEncodings(encodings ...string) CompressOption {
+	return func(opt *CompressOptions) {
+		opt.Encodings = encodings
+	}
+}
+
+// WithMinSize sets the minimum size, in bytes, of compressed responses.
+// Smaller responses are sent uncompressed. The default is 1024.
+func WithMinSize(n int) CompressOption {
+	return func(opt *CompressOptions) {
+		opt.MinSize = n
+	}
+}
+
+// WithCompressContentTypes sets the media types of compressed responses.
+// Entries ending with "/*" match any subtype. The default is DefaultCompressContentTypes.
+func WithCompressContentTypes(types ...string) CompressOption {
+	return func(opt *CompressOptions) {
+		opt.ContentTypes = types
+	}
+}
+
+// Compress returns a middleware compressing responses with the content coding
+// negotiated through the Accept-Encoding request header, q-values included.
+//
+// Responses are compressed when their media type is allowed, they are at least
+// MinSize bytes long and they are not already encoded or partial. The Content-Type
+// is sniffed when not set by the handler. Compressed responses lose their
+// Content-Length, their ETag is weakened and Vary: Accept-Encoding is set.
+// Flushing a response sends the data compressed so far, so that streaming works.
+//
+// Example usage:
+//
+//	http.ListenAndServe(":8080", Default().Append(Compress(WithMinSize(512))).Then(mux))
+//
+// Place Compress after Logger and Metrics, so that they record the bytes
+// sent on the wire. Upgrade requests, such as websockets, are not compressed.
+func Compress(opts ...CompressOption) func(http.Handler) http.Handler {
+	options := &CompressOptions{
+		Encodings:    []string{EncodingZstd, EncodingGzip, EncodingDeflate},
+		MinSize:      1024,
+		ContentTypes: DefaultCompressContentTypes,
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	encodings := slices.DeleteFunc(slices.Clone(options.Encodings), func(e string) bool {
+		return encoderPools[e] == nil
+	})
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+
+			encoding := negotiateEncoding(r.Header.Values("Accept-Encoding"), encodings)
+			if encoding == "" || r.Method == http.MethodHead || r.Header.Get("Upgrade") != "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// The response is not closed on panic, so that the buffered
+			// part is discarded and Recover can write its own response.
+			cw := &compressWriter{w: w, options: options, encoding: encoding, status: http.StatusOK}
+			next.ServeHTTP(cw, r)
+			cw.close()
+		})
+	}
+}
+
+// negotiateEncoding returns the supported encoding with the highest q-value in the
+// Accept-Encoding header values, or "" if none is acceptable. Ties are broken by
+// the order of supported.
+func negotiateEncoding(values []string, supported []string) string {
+	accepted := make(map[string]float64)
+
+	for _, v := range values {
+		for part := range strings.SplitSeq(v, ",") {
+			name, params, _ := strings.Cut(part, ";")
+			name = strings.ToLower(strings.TrimSpace(name))
+
+			q := 1.0
+
+			if k, v, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(k) == "q" {
+				parsed, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+				if err != nil {
+					continue
+				}
+
+				q = parsed
+			}
+
+			if name != "" {
+				accepted[name] = q
+			}
+		}
+	}
+
+	var (
+		best  string
+		bestQ float64
+	)
+
+	for _, enc := range supported {
+		q, ok := accepted[enc]
+		if !ok {
+			q = accepted["*"]
+		}
+
+		if q > bestQ {
+			best, bestQ = enc, q
+		}
+	}
+
+	return best
+}
+
+// compressWriter buffers the beginning of a response until it can decide
+// whether to compress it, then writes through an encoder or directly.
+type compressWriter struct {
+	w        http.ResponseWriter
+	options  *CompressOptions
+	encoding string
+	status   int
+	buf      bytes.Buffer
+	decided  bool
+	enc      encoder
+}
+
+func (cw *compressWriter) Header() http.Header {
+	return cw.w.Header()
+}
+
+// WriteHeader records the status code, sent once the response is decided.
+// Informational 1xx headers are sent immediately.
+func (cw *compressWriter) WriteHeader(code int) {
+	if code < http.StatusOK && code != http.StatusSwitchingProtocols {
+		cw.w.WriteHeader(code)
+		return
+	}
+
+	if cw.decided {
+		return
+	}
+
+	cw.status = code
+
+	if !bodyAllowed(code) {
+		cw.decide(false)
+	}
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if !cw.decided {
+		if cw.buf.Len()+len(b) < cw.options.MinSize {
+			return cw.buf.Write(b)
+		}
+
+		cw.buf.Write(b)
+
+		if err := cw.decide(false); err != nil {
+			return 0, err
+		}
+
+		return len(b), nil
+	}
+
+	if cw.enc != nil {
+		return cw.enc.Write(b)
+	}
+
+	return cw.w.Write(b)
+}
+
+// Flush sends the response written so far. An undecided response is compressed
+// regardless of its size, since it is being streamed.
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		_ = cw.decide(true)
+	}
+
+	if cw.enc != nil {
+		_ = cw.enc.Flush()
+	}
+
+	_ = http.NewResponseController(cw.w).Flush()
+}
+
+// Unwrap returns the wrapped http.ResponseWriter, for http.ResponseController.
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.w
+}
+
+// decide selects whether the response is compressed, sends the headers and the
+// buffered body. Responses below MinSize are compressed only when streaming.
+func (cw *compressWriter) decide(streaming bool) error {
+	cw.decided = true
+
+	if cw.compressible(streaming) {
+		h := cw.w.Header()
+		h.Set("Content-Encoding", cw.encoding)
+		h.Del("Content-Length")
+
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+
+		cw.enc = encoderPools[cw.encoding].Get().(encoder)
+		cw.enc.Reset(cw.w)
+	}
+
+	cw.w.WriteHeader(cw.status)
+
+	if cw.buf.Len() == 0 {
+		return nil
+	}
+
+	var err error
+	if cw.enc != nil {
+		_, err = cw.enc.Write(cw.buf.Bytes())
+	} else {
+		_, err = cw.w.Write(cw.buf.Bytes())
+	}
+
+	cw.buf.Reset()
+
+	return err
+}
+
+func (cw *compressWriter) compressible(streaming bool) bool {
+	h := cw.w.Header()
+
+	if !bodyAllowed(cw.status) || h.Get("Content-Encoding") != "" || h.Get("Content-Range") != "" {
+		return false
+	}
+
+	if !streaming && cw.buf.Len() < cw.options.MinSize {
+		return false
+	}
+
+	if n, err := strconv.Atoi(h.Get("Content-Length")); err == nil && n < cw.options.MinSize {
+		return false
+	}
+
+	if _, ok := h["Content-Type"]; !ok && cw.buf.Len() > 0 {
+		h.Set("Content-Type", http.DetectContentType(cw.buf.Bytes()))
+	}
+
+	mediaType, _, _ := strings.Cut(h.Get("Content-Type"), ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+
+	return slices.ContainsFunc(cw.options.ContentTypes, func(t string) bool {
+		if prefix, ok := strings.CutSuffix(t, "/*"); ok {
+			return strings.HasPrefix(mediaType, prefix+"/")
+		}
+
+		return mediaType == t
+	})
+}
+
+// close sends an undecided response and releases the encoder.
+func (cw *compressWriter) close() {
+	if !cw.decided {
+		_ = cw.decide(false)
+	}
+
+	if cw.enc != nil {
+		_ = cw.enc.Close()
+		cw.enc.Reset(nil)
+		encoderPools[cw.encoding].Put(cw.enc)
+		cw.enc = nil
+	}
+}
+
+// bodyAllowed reports whether a response with the given status can have a body.
+func bodyAllowed(status int) bool {
+	return status != http.StatusNoContent && status != http.StatusNotModified && status != http.StatusSwitchingProtocols
+}
@@ -0,0 +1,258 @@
+package middleware_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/flate"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/paccolamano/goshare/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var compressBody = strings.Repeat("compress me please, ", 200)
+
+func decode(t *testing.T, encoding string, body []byte) string {
+	t.Helper()
+
+	var (
+		r   io.Reader
+		err error
+	)
+
+	switch encoding {
+	case middleware.EncodingGzip:
+		r, err = gzip.NewReader(bytes.NewReader(body))
+	case middleware.EncodingDeflate:
+		r = flate.NewReader(bytes.NewReader(body))
+	case middleware.EncodingZstd:
+		r, err = zstd.NewReader(bytes.NewReader(body))
+	default:
+		return string(body)
+	}
+
+	require.NoError(t, err)
+
+	out, err := io.ReadAll(r)
+	require.NoError(t, err)
+
+	return string(out)
+}
+
+func textHandler(body string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = io.WriteString(w, body)
+	})
+}
+
+func TestCompressNegotiation(t *testing.T) {
+	t.Parallel()
+
+	handler := middleware.Compress()(textHandler(compressBody))
+
+	tests := []struct {
+		accept   string
+		encoding string
+	}{
+		{accept: "", encoding: ""},
+		{accept: "gzip", encoding: "gzip"},
+		{accept: "deflate, gzip", encoding: "gzip"},
+		{accept: "gzip, deflate, br, zstd", encoding: "zstd"},
+		{accept: "gzip;q=1.0, zstd;q=0.5", encoding: "gzip"},
+		{accept: "deflate;q=0.9, gzip;q=0.1", encoding: "deflate"},
+		{accept: "*", encoding: "zstd"},
+		{accept: "*;q=0.5, zstd;q=0", encoding: "gzip"},
+		{accept: "gzip;q=0", encoding: ""},
+		{accept: "br, identity", encoding: ""},
+		{accept: "GZIP ; q=0.8", encoding: "gzip"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept-Encoding", tt.accept)
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.encoding, w.Header().Get("Content-Encoding"))
+			assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+			assert.Equal(t, compressBody, decode(t, tt.encoding, w.Body.Bytes()))
+		})
+	}
+}
+
+func TestCompressSkipped(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{name: "below min size", handler: func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = io.WriteString(w, "short")
+		}},
+		{name: "content type", handler: func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = io.WriteString(w, compressBody)
+		}},
+		{name: "already encoded", handler: func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Encoding", "br")
+			_, _ = io.WriteString(w, compressBody)
+		}},
+		{name: "partial content", handler: func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Range", "bytes 0-3999/8000")
+			w.WriteHeader(http.StatusPartialContent)
+			_, _ = io.WriteString(w, compressBody)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept-Encoding", "gzip")
+
+			w := httptest.NewRecorder()
+			middleware.Compress()(tt.handler).ServeHTTP(w, req)
+
+			assert.NotEqual(t, "gzip", w.Header().Get("Content-Encoding"))
+			assert.NotEmpty(t, w.Body.String())
+			assert.NotContains(t, w.Body.String(), "\x1f\x8b")
+		})
+	}
+}
+
+func TestCompressHeaders(t *testing.T) {
+	t.Parallel()
+
+	handler := middleware.Compress(middleware.WithEncodings("gzip"), middleware.WithMinSize(10))(
+		http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("ETag", `"v1"`)
+			w.Header().Set("Content-Length", "4000")
+			w.WriteHeader(http.StatusCreated)
+			_, _ = io.WriteString(w, "<html><body>"+compressBody+"</body></html>")
+		}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "zstd, gzip")
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, `W/"v1"`, w.Header().Get("ETag"))
+	assert.Empty(t, w.Header().Get("Content-Length"))
+	assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"), "content type should be sniffed")
+	assert.Contains(t, decode(t, "gzip", w.Body.Bytes()), compressBody)
+
+	w = httptest.NewRecorder()
+	middleware.Compress()(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+}
+
+func TestCompressFlush(t *testing.T) {
+	t.Parallel()
+
+	flushed := make(chan []byte, 1)
+
+	handler := middleware.Compress()(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = io.WriteString(w, "data: first\n\n")
+
+		require.NoError(t, http.NewResponseController(w).Flush())
+
+		flushed <- nil
+
+		_, _ = io.WriteString(w, "data: second\n\n")
+	}))
+
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+	require.NoError(t, err)
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	resp, err := srv.Client().Do(req)
+	require.NoError(t, err)
+
+	defer resp.Body.Close()
+
+	assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+
+	zr, err := gzip.NewReader(resp.Body)
+	require.NoError(t, err)
+
+	first := make([]byte, len("data: first\n\n"))
+	_, err = io.ReadFull(zr, first)
+	require.NoError(t, err)
+	assert.Equal(t, "data: first\n\n", string(first))
+
+	<-flushed
+
+	rest, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	assert.Equal(t, "data: second\n\n", string(rest))
+}
+
+func TestCompressWithLogger(t *testing.T) {
+	t.Parallel()
+
+	buf := &bytes.Buffer{}
+	l := slog.New(slog.NewJSONHandler(buf, nil))
+
+	handler := middleware.NewChain(
+		middleware.Logger(middleware.WithLogger(l), middleware.WithSingleRecord(),
+			middleware.WithFields(middleware.FieldStatus, middleware.FieldResponseBytes)),
+		middleware.Compress(),
+	).Then(textHandler(compressBody))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	var record map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+
+	assert.InDelta(t, w.Body.Len(), record["responseBytes"], 0)
+	assert.Less(t, w.Body.Len(), len(compressBody))
+}
+
+func TestCompressPanicDiscardsBuffer(t *testing.T) {
+	t.Parallel()
+
+	handler := middleware.NewChain(middleware.Recover(), middleware.Compress()).ThenFunc(
+		func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = io.WriteString(w, "partial")
+			panic("boom")
+		})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.NotContains(t, w.Body.String(), "partial")
+}
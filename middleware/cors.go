@@ -0,0 +1,332 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSOptions holds configuration options for the CORS middleware.
+type CORSOptions struct {
+	Origins        []string
+	OriginPatterns []*regexp.Regexp
+	OriginFunc     func(r *http.Request, origin string) bool
+	Methods        []string
+	Headers        []string
+	ExposedHeaders []string
+	Credentials    bool
+	MaxAge         time.Duration
+	Strict         bool
+	Logger         InfoLogger
+}
+
+// CORSOption represents a functional option for configuring CORS middleware.
+type CORSOption func(*CORSOptions)
+
+// WithAllowedOrigins sets the allowed origins. An origin is either exact, such as
+// "https://example.com", a wildcard subdomain, such as "https://*.example.com",
+// or "*" to allow any origin. It can be used multiple times.
+func WithAllowedOrigins(origins ...string) CORSOption {
+	return func(opt *CORSOptions) {
+		opt.Origins = append(opt.Origins, origins...)
+	}
+}
+
+// WithAllowedOriginPatterns allows the origins matching one of patterns.
+// Patterns should be anchored, for instance `^https://[a-z]+\.example\.com$`.
+func WithAllowedOriginPatterns(patterns ...*regexp.Regexp) CORSOption {
+	return func(opt *CORSOptions) {
+		opt.OriginPatterns = append(opt.OriginPatterns, patterns...)
+	}
+}
+
+// WithAllowedOriginFunc allows the origins for which f returns true.
+func WithAllowedOriginFunc(f func(r *http.Request, origin string) bool) CORSOption {
+	return func(opt *CORSOptions) {
+		opt.OriginFunc = f
+	}
+}
+
+// WithAllowedMethods sets the methods allowed in preflight requests.
+// The default is GET, HEAD and POST.
+func WithAllowedMethods(methods ...string) CORSOption {
+	return func(opt *CORSOptions) {
+		opt.Methods = methods
+	}
+}
+
+// WithAllowedHeaders sets the request headers allowed in preflight requests,
+// or "*" to allow any header. By default no header beyond the CORS-safelisted
+// ones is allowed.
+func WithAllowedHeaders(headers ...string) CORSOption {
+	return func(opt *CORSOptions) {
+		opt.Headers = headers
+	}
+}
+
+// WithExposedHeaders sets the response headers readable by clients,
+// beyond the CORS-safelisted ones.
+func WithExposedHeaders(headers ...string) CORSOption {
+	return func(opt *CORSOptions) {
+		opt.ExposedHeaders = headers
+	}
+}
+
+// WithCredentials allows requests with credentials, such as cookies.
+// It cannot be combined with the "*" origin, which would let any site read
+// responses on behalf of users: allowed origins must be listed, or matched by
+// patterns or a function. Header wildcards are answered with the request
+// headers, since browsers reject them for credentialed requests.
+func WithCredentials() CORSOption {
+	return func(opt *CORSOptions) {
+		opt.Credentials = true
+	}
+}
+
+// WithMaxAge sets how long browsers can cache preflight responses.
+func WithMaxAge(d time.Duration) CORSOption {
+	return func(opt *CORSOptions) {
+		opt.MaxAge = d
+	}
+}
+
+// WithStrictCORS rejects cross-origin requests from disallowed origins with
+// a 403 Forbidden problem response, instead of only omitting the CORS headers,
+// and logs them with the given logger. Browsers also send Origin on same-origin
+// POST requests: the server own origin must then be allowed.
+func WithStrictCORS(l InfoLogger) CORSOption {
+	return func(opt *CORSOptions) {
+		opt.Strict = true
+		opt.Logger = l
+	}
+}
+
+// CORS returns a middleware implementing cross-origin resource sharing.
+//
+// Preflight requests, OPTIONS requests carrying Access-Control-Request-Method,
+// are answered with 204 No Content without calling the next handler. Other
+// requests from allowed origins get the Access-Control-Allow-Origin header.
+// Vary headers are set so that caches key responses by origin.
+//
+// Example usage:
+//
+//	http.Handle("/api/", CORS(WithAllowedOrigins("https://*.example.com"),
+//		WithAllowedMethods(http.MethodGet, http.MethodPut), WithCredentials())(apiHandler))
+//
+// Requests from disallowed origins are passed through without CORS headers,
+// letting browsers block them, unless WithStrictCORS is used.
+// CORS panics if WithCredentials is combined with the "*" origin.
+func CORS(opts ...CORSOption) func(http.Handler) http.Handler {
+	options := &CORSOptions{
+		Methods: []string{http.MethodGet, http.MethodHead, http.MethodPost},
+		Logger:  slog.Default(),
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	if options.Credentials && slices.Contains(options.Origins, "*") {
+		panic(`middleware: CORS credentials cannot be allowed for the "*" origin`)
+	}
+
+	c := newCORS(options)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+			h := w.Header()
+			if preflight {
+				h.Add("Vary", "Origin, Access-Control-Request-Method, Access-Control-Request-Headers")
+			} else {
+				h.Add("Vary", "Origin")
+			}
+
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if !c.allowOrigin(r, origin) {
+				if options.Strict {
+					options.Logger.InfoContext(r.Context(), "cors origin rejected",
+						"origin", origin,
+						"method", r.Method,
+						"path", r.URL.Path,
+					)
+
+					p := NewProblem(http.StatusForbidden)
+					p.Detail = "origin not allowed"
+					p.Instance = r.URL.Path
+
+					WriteProblem(w, p)
+
+					return
+				}
+
+				if preflight {
+					w.WriteHeader(http.StatusNoContent)
+					return
+				}
+
+				next.ServeHTTP(w, r)
+
+				return
+			}
+
+			if c.anyOrigin {
+				h.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				h.Set("Access-Control-Allow-Origin", origin)
+			}
+
+			if options.Credentials {
+				h.Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			if !preflight {
+				if len(options.ExposedHeaders) > 0 {
+					h.Set("Access-Control-Expose-Headers", strings.Join(options.ExposedHeaders, ", "))
+				}
+
+				next.ServeHTTP(w, r)
+
+				return
+			}
+
+			c.preflight(w, r)
+		})
+	}
+}
+
+// cors holds the parsed CORS options.
+type cors struct {
+	*CORSOptions
+	anyOrigin  bool
+	origins    []string
+	wildcards  [][2]string
+	anyHeader  bool
+	headers    []string
+	methods    string
+	allHeaders string
+	maxAge     string
+}
+
+func newCORS(o *CORSOptions) *cors {
+	c := &cors{CORSOptions: o, methods: strings.Join(o.Methods, ", ")}
+
+	for _, origin := range o.Origins {
+		origin = strings.ToLower(origin)
+
+		switch {
+		case origin == "*":
+			c.anyOrigin = true
+		case strings.Contains(origin, "://*."):
+			scheme, host, _ := strings.Cut(origin, "*")
+			c.wildcards = append(c.wildcards, [2]string{scheme, host})
+		default:
+			c.origins = append(c.origins, origin)
+		}
+	}
+
+	for _, h := range o.Headers {
+		if h == "*" {
+			c.anyHeader = true
+			continue
+		}
+
+		c.headers = append(c.headers, strings.ToLower(h))
+	}
+
+	c.allHeaders = strings.Join(o.Headers, ", ")
+
+	if o.MaxAge > 0 {
+		c.maxAge = strconv.Itoa(int(o.MaxAge.Seconds()))
+	}
+
+	return c
+}
+
+func (c *cors) allowOrigin(r *http.Request, origin string) bool {
+	if c.anyOrigin {
+		return true
+	}
+
+	lower := strings.ToLower(origin)
+	if slices.Contains(c.origins, lower) {
+		return true
+	}
+
+	for _, w := range c.wildcards {
+		if strings.HasPrefix(lower, w[0]) && strings.HasSuffix(lower, w[1]) && len(lower) > len(w[0])+len(w[1]) {
+			return true
+		}
+	}
+
+	for _, re := range c.OriginPatterns {
+		if re.MatchString(origin) {
+			return true
+		}
+	}
+
+	return c.OriginFunc != nil && c.OriginFunc(r, origin)
+}
+
+// preflight answers a preflight request from an allowed origin. Disallowed methods
+// or headers are answered without the corresponding headers, so that browsers
+// reject the actual request.
+func (c *cors) preflight(w http.ResponseWriter, r *http.Request) {
+	h := w.Header()
+	method := r.Header.Get("Access-Control-Request-Method")
+
+	if !slices.Contains(c.Methods, method) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	requested := r.Header.Values("Access-Control-Request-Headers")
+
+	if !c.allowHeaders(requested) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	h.Set("Access-Control-Allow-Methods", c.methods)
+
+	switch {
+	case len(requested) == 0:
+	case c.anyHeader && c.Credentials:
+		h.Set("Access-Control-Allow-Headers", strings.Join(requested, ", "))
+	default:
+		h.Set("Access-Control-Allow-Headers", c.allHeaders)
+	}
+
+	if c.maxAge != "" {
+		h.Set("Access-Control-Max-Age", c.maxAge)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *cors) allowHeaders(values []string) bool {
+	if c.anyHeader {
+		return true
+	}
+
+	for _, v := range values {
+		for name := range strings.SplitSeq(v, ",") {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name != "" && !slices.Contains(c.headers, name) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,202 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/paccolamano/goshare/middleware"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func corsRequest(method, origin string, headers ...string) *http.Request {
+	req := httptest.NewRequest(method, "/api", nil)
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+
+	return req
+}
+
+func TestCORSOrigins(t *testing.T) {
+	t.Parallel()
+
+	mw := middleware.CORS(
+		middleware.WithAllowedOrigins("https://example.com", "https://*.example.org"),
+		middleware.WithAllowedOriginPatterns(regexp.MustCompile(`^https://[a-z]+\.example\.net$`)),
+		middleware.WithAllowedOriginFunc(func(_ *http.Request, origin string) bool {
+			return strings.HasSuffix(origin, ".internal")
+		}),
+	)
+	handler := mw(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		origin  string
+		allowed bool
+	}{
+		{origin: "https://example.com", allowed: true},
+		{origin: "https://EXAMPLE.com", allowed: true},
+		{origin: "http://example.com", allowed: false},
+		{origin: "https://api.example.org", allowed: true},
+		{origin: "https://a.b.example.org", allowed: true},
+		{origin: "https://example.org", allowed: false},
+		{origin: "https://evilexample.org", allowed: false},
+		{origin: "https://api.example.net", allowed: true},
+		{origin: "https://api.example.net.evil.com", allowed: false},
+		{origin: "http://service.internal", allowed: true},
+		{origin: "https://other.com", allowed: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.origin, func(t *testing.T) {
+			t.Parallel()
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, corsRequest(http.MethodGet, tt.origin))
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, "Origin", w.Header().Get("Vary"))
+
+			if tt.allowed {
+				assert.Equal(t, tt.origin, w.Header().Get("Access-Control-Allow-Origin"))
+			} else {
+				assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+			}
+		})
+	}
+}
+
+func TestCORSActualRequest(t *testing.T) {
+	t.Parallel()
+
+	called := false
+	handler := middleware.CORS(
+		middleware.WithAllowedOrigins("*"),
+		middleware.WithExposedHeaders("X-Request-ID", "RateLimit-Remaining"),
+	)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		called = true
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, corsRequest(http.MethodGet, "https://any.com"))
+
+	assert.True(t, called)
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "X-Request-ID, RateLimit-Remaining", w.Header().Get("Access-Control-Expose-Headers"))
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Credentials"))
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, corsRequest(http.MethodGet, ""))
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "Origin", w.Header().Get("Vary"))
+}
+
+func TestCORSPreflight(t *testing.T) {
+	t.Parallel()
+
+	handler := middleware.CORS(
+		middleware.WithAllowedOrigins("https://example.com"),
+		middleware.WithAllowedMethods(http.MethodGet, http.MethodPut),
+		middleware.WithAllowedHeaders("Content-Type", "X-Api-Key"),
+		middleware.WithCredentials(),
+		middleware.WithMaxAge(10*time.Minute),
+	)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		t.Error("preflight requests must not reach the handler")
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, corsRequest(http.MethodOptions, "https://example.com",
+		"Access-Control-Request-Method", http.MethodPut,
+		"Access-Control-Request-Headers", "content-type, x-api-key"))
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "https://example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "GET, PUT", w.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "Content-Type, X-Api-Key", w.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "600", w.Header().Get("Access-Control-Max-Age"))
+	assert.Equal(t, "Origin, Access-Control-Request-Method, Access-Control-Request-Headers", w.Header().Get("Vary"))
+
+	for name, headers := range map[string][]string{
+		"method": {"Access-Control-Request-Method", http.MethodDelete},
+		"header": {"Access-Control-Request-Method", http.MethodGet, "Access-Control-Request-Headers", "X-Other"},
+	} {
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, corsRequest(http.MethodOptions, "https://example.com", headers...))
+
+		assert.Equal(t, http.StatusNoContent, w.Code, name)
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Methods"), name)
+	}
+}
+
+func TestCORSPreflightWildcardWithCredentials(t *testing.T) {
+	t.Parallel()
+
+	assert.Panics(t, func() { middleware.CORS(middleware.WithAllowedOrigins("*"), middleware.WithCredentials()) })
+
+	handler := middleware.CORS(
+		middleware.WithAllowedOrigins("https://*.com"),
+		middleware.WithAllowedHeaders("*"),
+		middleware.WithCredentials(),
+	)(http.NotFoundHandler())
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, corsRequest(http.MethodOptions, "https://any.com",
+		"Access-Control-Request-Method", http.MethodPost,
+		"Access-Control-Request-Headers", "X-Custom"))
+
+	assert.Equal(t, "https://any.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "X-Custom", w.Header().Get("Access-Control-Allow-Headers"))
+}
+
+func TestCORSNonPreflightOptions(t *testing.T) {
+	t.Parallel()
+
+	called := false
+	handler := middleware.CORS(middleware.WithAllowedOrigins("*"))(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		called = true
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), corsRequest(http.MethodOptions, "https://any.com"))
+	assert.True(t, called)
+}
+
+func TestCORSStrict(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	l := NewMockInfoLogger(ctrl)
+	l.EXPECT().
+		InfoContext(gomock.Any(), "cors origin rejected",
+			"origin", "https://evil.com",
+			"method", http.MethodPost,
+			"path", "/api",
+		).
+		Times(1)
+
+	handler := middleware.CORS(
+		middleware.WithAllowedOrigins("https://example.com"),
+		middleware.WithStrictCORS(l),
+	)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		t.Error("rejected requests must not reach the handler")
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, corsRequest(http.MethodPost, "https://evil.com"))
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, middleware.ProblemContentType, w.Header().Get("Content-Type"))
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+}
@@ -0,0 +1,200 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zlib"
+	"github.com/klauspost/compress/zstd"
+)
+
+var (
+	// ErrDecompressedBodyTooLarge is returned when reading a decompressed request
+	// body past the maximum size of the Decompress middleware.
+	ErrDecompressedBodyTooLarge = errors.New("middleware: decompressed body too large")
+	// ErrDecompressionRatio is returned when a request body decompresses with a
+	// ratio above the maximum of the Decompress middleware, a sign of a decompression bomb.
+	ErrDecompressionRatio = errors.New("middleware: decompression ratio exceeded")
+)
+
+// DecompressOptions holds configuration options for the Decompress middleware.
+type DecompressOptions struct {
+	MaxSize       int64
+	MaxRatio      float64
+	RatioMinBytes int64
+}
+
+// DecompressOption represents a functional option for configuring Decompress middleware.
+type DecompressOption func(*DecompressOptions)
+
+// WithDecompressedMaxSize sets the maximum size, in bytes, of decompressed
+// request bodies. It must be positive. The default is 10 MiB.
+func WithDecompressedMaxSize(n int64) DecompressOption {
+	return func(opt *DecompressOptions) {
+		opt.MaxSize = n
+	}
+}
+
+// WithMaxRatio sets the maximum ratio between decompressed and compressed sizes,
+// checked once minBytes were decompressed, so that small bodies compressing well
+// are not rejected. A zero ratio disables the check; negative values are invalid.
+// The default is a ratio of 100 after 64 KiB.
+func WithMaxRatio(ratio float64, minBytes int64) DecompressOption {
+	return func(opt *DecompressOptions) {
+		opt.MaxRatio = ratio
+		opt.RatioMinBytes = minBytes
+	}
+}
+
+// Decompress returns a middleware transparently decoding request bodies encoded
+// with gzip, deflate or zstd, as announced by their Content-Encoding header.
+//
+// Decoded requests lose their Content-Encoding and Content-Length headers. Bodies
+// with another or multiple encodings are answered with a 415 Unsupported Media Type
+// problem response, and malformed ones with 400 Bad Request.
+//
+// To protect against decompression bombs, reading fails with ErrDecompressedBodyTooLarge
+// past the maximum size, or with ErrDecompressionRatio when the body decompresses
+// with a suspicious ratio. As with BodyLimit, the handler response is then replaced
+// with a 413 Content Too Large problem response, unless headers were already sent.
+//
+// Example usage:
+//
+//	http.ListenAndServe(":8080", NewChain(BodyLimit(), Decompress()).Then(mux))
+//
+// Place BodyLimit before Decompress, so that it limits the compressed size.
+// Decompress panics if the maximum size is not positive or the ratio settings are negative.
+func Decompress(opts ...DecompressOption) func(http.Handler) http.Handler {
+	options := &DecompressOptions{
+		MaxSize:       10 << 20,
+		MaxRatio:      100,
+		RatioMinBytes: 64 << 10,
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	if options.MaxSize <= 0 || options.MaxRatio < 0 || options.RatioMinBytes < 0 {
+		panic("middleware: Decompress requires a positive max size and non-negative ratio settings")
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+			if encoding == "" || encoding == "identity" || r.Body == nil || r.Body == http.NoBody {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			compressed := &countingReader{ReadCloser: r.Body}
+
+			dec, err := options.decoder(encoding, compressed)
+			switch {
+			case errors.Is(err, errUnsupportedEncoding):
+				p := NewProblem(http.StatusUnsupportedMediaType)
+				p.Detail = fmt.Sprintf("unsupported content encoding %q", encoding)
+				p.Instance = r.URL.Path
+
+				w.Header().Set("Accept-Encoding", "gzip, deflate, zstd")
+				WriteProblem(w, p)
+
+				return
+			case err != nil:
+				p := NewProblem(http.StatusBadRequest)
+				p.Detail = "malformed " + encoding + " request body"
+				p.Instance = r.URL.Path
+
+				WriteProblem(w, p)
+
+				return
+			}
+
+			defer func() { _ = dec.Close() }()
+
+			bw := &bodyLimitWriter{ResponseWriter: w, r: r, limit: options.MaxSize}
+
+			r = r.Clone(r.Context())
+			r.Header.Del("Content-Encoding")
+			r.Header.Del("Content-Length")
+			r.ContentLength = -1
+			r.Body = &bodyLimitReader{
+				ReadCloser: &bombGuard{dec: dec, compressed: compressed, options: options},
+				w:          bw,
+			}
+
+			next.ServeHTTP(bw, r)
+			bw.finish()
+		})
+	}
+}
+
+var errUnsupportedEncoding = errors.New("unsupported encoding")
+
+// decoder returns a decoder of encoding reading from src.
+func (o *DecompressOptions) decoder(encoding string, src io.Reader) (io.ReadCloser, error) {
+	switch encoding {
+	case EncodingGzip, "x-gzip":
+		return gzip.NewReader(src)
+	case EncodingDeflate:
+		return zlib.NewReader(src)
+	case EncodingZstd:
+		d, err := zstd.NewReader(src, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(uint64(max(o.MaxSize, 1))))
+		if err != nil {
+			return nil, err
+		}
+
+		return d.IOReadCloser(), nil
+	default:
+		return nil, errUnsupportedEncoding
+	}
+}
+
+// bombGuard reads a decompressed body, failing when it exceeds the maximum size or ratio.
+type bombGuard struct {
+	dec        io.ReadCloser
+	compressed *countingReader
+	options    *DecompressOptions
+	n          int64
+	err        error
+}
+
+func (g *bombGuard) Read(p []byte) (int, error) {
+	if g.err != nil {
+		return 0, g.err
+	}
+
+	// Read at most one byte past the limit, enough to detect the overflow.
+	if remaining := g.options.MaxSize - g.n + 1; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+
+	n, err := g.dec.Read(p)
+	g.n += int64(n)
+
+	switch {
+	case errors.Is(err, zstd.ErrWindowSizeExceeded), errors.Is(err, zstd.ErrDecoderSizeExceeded):
+		// zstd frames declaring a window larger than the maximum size are refused upfront.
+		g.err = ErrDecompressedBodyTooLarge
+	case g.n > g.options.MaxSize:
+		n, g.err = n-int(g.n-g.options.MaxSize), ErrDecompressedBodyTooLarge
+	case g.options.MaxRatio > 0 && g.n >= g.options.RatioMinBytes &&
+		float64(g.n) > g.options.MaxRatio*float64(max(g.compressed.n, 1)):
+		g.err = ErrDecompressionRatio
+	}
+
+	if g.err != nil {
+		return n, g.err
+	}
+
+	return n, err
+}
+
+// Close closes the original body. The decoder is closed by the middleware.
+func (g *bombGuard) Close() error {
+	return g.compressed.Close()
+}
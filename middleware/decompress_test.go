@@ -0,0 +1,177 @@
+package middleware_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zlib"
+	"github.com/klauspost/compress/zstd"
+	"github.com/paccolamano/goshare/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func encode(t *testing.T, encoding string, data []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	var w interface {
+		Write(p []byte) (int, error)
+		Close() error
+	}
+
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	case "zstd":
+		zw, err := zstd.NewWriter(&buf)
+		require.NoError(t, err)
+
+		w = zw
+	}
+
+	_, err := w.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	return buf.Bytes()
+}
+
+func decompressRequest(encoding string, body []byte) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	req.Header.Set("Content-Encoding", encoding)
+
+	return req
+}
+
+func TestDecompress(t *testing.T) {
+	t.Parallel()
+
+	payload := []byte(`{"items":["` + strings.Repeat("abc", 100) + `"]}`)
+
+	var seen *http.Request
+
+	handler := middleware.Decompress()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r
+		readAllHandler(w, r)
+	}))
+
+	for _, encoding := range []string{"gzip", "deflate", "zstd"} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, decompressRequest(encoding, encode(t, encoding, payload)))
+
+		require.Equal(t, http.StatusOK, w.Code, encoding)
+		assert.Equal(t, string(payload), w.Body.String(), encoding)
+		assert.Empty(t, seen.Header.Get("Content-Encoding"))
+		assert.Equal(t, int64(-1), seen.ContentLength)
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(payload)))
+	assert.Equal(t, string(payload), w.Body.String(), "identity bodies should be left untouched")
+}
+
+func TestDecompressRejects(t *testing.T) {
+	t.Parallel()
+
+	handler := middleware.Decompress()(readAllHandler)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, decompressRequest("br", []byte("data")))
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+	assert.Equal(t, "gzip, deflate, zstd", w.Header().Get("Accept-Encoding"))
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, decompressRequest("gzip, gzip", []byte("data")))
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, decompressRequest("gzip", []byte("not gzip")))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, middleware.ProblemContentType, w.Header().Get("Content-Type"))
+}
+
+func TestDecompressBombProtection(t *testing.T) {
+	t.Parallel()
+
+	zeros := make([]byte, 1<<20)
+
+	tests := []struct {
+		name   string
+		opts   []middleware.DecompressOption
+		err    error
+		detail string
+	}{
+		{
+			name:   "max size",
+			opts:   []middleware.DecompressOption{middleware.WithDecompressedMaxSize(512 << 10), middleware.WithMaxRatio(0, 0)},
+			err:    middleware.ErrDecompressedBodyTooLarge,
+			detail: "request body exceeds 524288 bytes",
+		},
+		{
+			name:   "ratio",
+			opts:   nil,
+			err:    middleware.ErrDecompressionRatio,
+			detail: "request body exceeds the maximum decompression ratio",
+		},
+	}
+
+	for _, tt := range tests {
+		for _, encoding := range []string{"gzip", "zstd"} {
+			t.Run(tt.name+"/"+encoding, func(t *testing.T) {
+				t.Parallel()
+
+				var (
+					readErr error
+					n       int
+				)
+
+				handler := middleware.Decompress(tt.opts...)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					buf := &bytes.Buffer{}
+					n64, err := buf.ReadFrom(r.Body)
+					n, readErr = int(n64), err
+
+					w.WriteHeader(http.StatusBadRequest)
+				}))
+
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, decompressRequest(encoding, encode(t, encoding, zeros)))
+
+				require.ErrorIs(t, readErr, tt.err)
+				assert.Less(t, n, len(zeros))
+				assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+				var p map[string]any
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+				assert.Equal(t, tt.detail, p["detail"])
+			})
+		}
+	}
+
+	// Well compressing bodies below the ratio threshold are accepted.
+	w := httptest.NewRecorder()
+	middleware.Decompress()(readAllHandler).ServeHTTP(w, decompressRequest("gzip", encode(t, "gzip", zeros[:32<<10])))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 32<<10, w.Body.Len())
+}
+
+func TestDecompressInvalidOptions(t *testing.T) {
+	t.Parallel()
+
+	for _, opt := range []middleware.DecompressOption{
+		middleware.WithDecompressedMaxSize(0),
+		middleware.WithDecompressedMaxSize(-2),
+		middleware.WithMaxRatio(-1, 0),
+		middleware.WithMaxRatio(10, -1),
+	} {
+		assert.Panics(t, func() { middleware.Decompress(opt) })
+	}
+}
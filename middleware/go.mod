@@ -4,6 +4,8 @@ go 1.24.2
 
 require (
 	github.com/google/uuid v1.6.0
+	github.com/klauspost/compress v1.18.0
+	github.com/paccolamano/goshare/logger v0.0.0
 	github.com/stretchr/testify v1.10.0
 	go.uber.org/mock v0.5.2
 )
@@ -13,3 +15,5 @@ require (
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
+
+replace github.com/paccolamano/goshare/logger => ../logger
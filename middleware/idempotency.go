@@ -0,0 +1,305 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// IdempotencyOptions holds configuration options for the Idempotency middleware.
+type IdempotencyOptions struct {
+	Header      string
+	Methods     []string
+	Store       IdempotencyStore
+	TTL         time.Duration
+	LockTTL     time.Duration
+	MaxBodySize int
+	Scope       func(r *http.Request) string
+	Logger      InfoLogger
+	TraceKey    any
+}
+
+// IdempotencyOption represents a functional option for configuring Idempotency middleware.
+type IdempotencyOption func(*IdempotencyOptions)
+
+// WithIdempotencyHeader sets the header holding the idempotency key.
+// The default is "Idempotency-Key".
+func WithIdempotencyHeader(name string) IdempotencyOption {
+	return func(opt *IdempotencyOptions) {
+		opt.Header = name
+	}
+}
+
+// WithIdempotencyMethods sets the methods of the requests handled by the middleware.
+// The default is POST and PATCH.
+func WithIdempotencyMethods(methods ...string) IdempotencyOption {
+	return func(opt *IdempotencyOptions) {
+		opt.Methods = methods
+	}
+}
+
+// WithIdempotencyStore sets the store of the keys. The default is a
+// MemoryIdempotencyStore, local to the middleware.
+func WithIdempotencyStore(s IdempotencyStore) IdempotencyOption {
+	return func(opt *IdempotencyOptions) {
+		opt.Store = s
+	}
+}
+
+// WithIdempotencyTTL sets how long responses are replayed. The default is 24 hours.
+func WithIdempotencyTTL(ttl time.Duration) IdempotencyOption {
+	return func(opt *IdempotencyOptions) {
+		opt.TTL = ttl
+	}
+}
+
+// WithIdempotencyLockTTL sets how long a key stays locked by an in-flight request,
+// bounding the wait for keys locked by a server that stopped. It should exceed
+// the longest request duration. The default is one minute.
+func WithIdempotencyLockTTL(ttl time.Duration) IdempotencyOption {
+	return func(opt *IdempotencyOptions) {
+		opt.LockTTL = ttl
+	}
+}
+
+// WithIdempotencyMaxBodySize sets the maximum size of the stored response bodies.
+// Larger responses are not stored and their key can be used again. The default is 1 MiB.
+func WithIdempotencyMaxBodySize(n int) IdempotencyOption {
+	return func(opt *IdempotencyOptions) {
+		opt.MaxBodySize = n
+	}
+}
+
+// WithIdempotencyScope sets the function returning the scope of the keys of a
+// request, so that clients cannot replay the responses of each other.
+// The default is the subject of the request Principal, if any.
+func WithIdempotencyScope(f func(r *http.Request) string) IdempotencyOption {
+	return func(opt *IdempotencyOptions) {
+		opt.Scope = f
+	}
+}
+
+// WithIdempotencyLogger sets a custom InfoLogger logging rejected requests and store failures.
+func WithIdempotencyLogger(l InfoLogger) IdempotencyOption {
+	return func(opt *IdempotencyOptions) {
+		opt.Logger = l
+	}
+}
+
+// WithIdempotencyTraceKey sets the context key from which the Idempotency middleware
+// reads the trace ID. It should match the Tracer key.
+func WithIdempotencyTraceKey(key any) IdempotencyOption {
+	return func(opt *IdempotencyOptions) {
+		opt.TraceKey = key
+	}
+}
+
+// principalScope returns the subject of the request Principal, if any.
+func principalScope(r *http.Request) string {
+	if p, ok := PrincipalFromContext(r.Context()); ok {
+		return p.Subject
+	}
+
+	return ""
+}
+
+// Idempotency returns a middleware making requests carrying an idempotency key
+// safe to retry.
+//
+// The response to the first request with a key is stored, and replayed with an
+// Idempotent-Replayed header to the following requests with the same key.
+// Requests are answered with a problem response:
+//   - 400 Bad Request, when the key is longer than 255 characters;
+//   - 409 Conflict, while the first request with the key is in flight;
+//   - 422 Unprocessable Content, when the key was used by a request with a
+//     different method, URL or body;
+//   - 503 Service Unavailable, when the store fails.
+//
+// Server errors, panics and responses larger than the maximum body size are
+// not stored, so that the request can be retried with the same key.
+//
+// Example usage:
+//
+//	http.Handle("POST /orders", Auth(WithAuthenticators(jwtAuth))(
+//		Idempotency(WithIdempotencyStore(redisStore))(ordersHandler)))
+//
+// Place Idempotency after Auth, so that keys are scoped by subject, and after
+// BodyLimit, since request bodies are read in memory to compute fingerprints.
+func Idempotency(opts ...IdempotencyOption) func(http.Handler) http.Handler {
+	options := &IdempotencyOptions{
+		Header:      "Idempotency-Key",
+		Methods:     []string{http.MethodPost, http.MethodPatch},
+		TTL:         24 * time.Hour,
+		LockTTL:     time.Minute,
+		MaxBodySize: 1 << 20,
+		Scope:       principalScope,
+		Logger:      slog.Default(),
+		TraceKey:    "traceUUID",
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	if options.Store == nil {
+		options.Store = NewMemoryIdempotencyStore()
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(options.Header)
+			if key == "" || !slices.Contains(options.Methods, r.Method) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if len(key) > 255 {
+				writeIdempotencyProblem(w, r, options, http.StatusBadRequest, "idempotency key exceeds 255 characters")
+				return
+			}
+
+			// The body read in memory is set on a shallow copy, passed down the chain.
+			r = r.WithContext(r.Context())
+
+			fingerprint, err := requestFingerprint(r)
+			if err != nil {
+				status := http.StatusBadRequest
+				if isBodyTooLarge(err) {
+					status = http.StatusRequestEntityTooLarge
+				}
+
+				writeIdempotencyProblem(w, r, options, status, "")
+
+				return
+			}
+
+			ctx := r.Context()
+			storeKey := options.Scope(r) + ":" + key
+
+			rec, created, err := options.Store.Create(ctx, storeKey, IdempotencyRecord{Fingerprint: fingerprint}, options.LockTTL)
+			if err != nil {
+				logStoreFailure(ctx, w, r, options, err)
+				writeIdempotencyProblem(w, r, options, http.StatusServiceUnavailable, "")
+
+				return
+			}
+
+			switch {
+			case rec.Fingerprint != fingerprint:
+				writeIdempotencyProblem(w, r, options, http.StatusUnprocessableEntity, "idempotency key was used by a different request")
+			case !created && !rec.Completed:
+				writeIdempotencyProblem(w, r, options, http.StatusConflict, "a request with the same idempotency key is in progress")
+			case !created:
+				replayResponse(w, rec)
+			default:
+				serveIdempotent(w, r, next, options, storeKey, fingerprint)
+			}
+		})
+	}
+}
+
+// serveIdempotent serves the first request with a key, storing its response.
+func serveIdempotent(w http.ResponseWriter, r *http.Request, next http.Handler, options *IdempotencyOptions, key, fingerprint string) {
+	// The record outlives the request, even when the client goes away.
+	ctx := context.WithoutCancel(r.Context())
+	header := w.Header().Clone()
+	body := &limitedBuffer{max: options.MaxBodySize}
+	rec := newResponseRecorder(w, body)
+	stored := false
+
+	defer func() {
+		if !stored {
+			if err := options.Store.Delete(ctx, key); err != nil {
+				logStoreFailure(ctx, w, r, options, err)
+			}
+		}
+	}()
+
+	next.ServeHTTP(rec, r)
+
+	if rec.Hijacked() || rec.Status() >= http.StatusInternalServerError || body.truncated {
+		return
+	}
+
+	// Only the headers set by the handler are stored, leaving out those of
+	// the previous middlewares, such as trace IDs.
+	stored = true
+	resp := IdempotencyRecord{
+		Fingerprint: fingerprint,
+		Completed:   true,
+		Status:      rec.Status(),
+		Header:      changedHeader(header, w.Header()),
+		Body:        body.Bytes(),
+	}
+
+	if err := options.Store.Save(ctx, key, resp, options.TTL); err != nil {
+		stored = false
+		logStoreFailure(ctx, w, r, options, err)
+	}
+}
+
+// requestFingerprint returns a hash of the method, URL and body of r.
+// The body is read in memory and replaced so that handlers can read it.
+func requestFingerprint(r *http.Request) (string, error) {
+	h := sha256.New()
+	_, _ = io.WriteString(h, r.Method+" "+r.URL.RequestURI()+"\n")
+
+	if r.Body != nil && r.Body != http.NoBody {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			return "", err
+		}
+
+		_ = r.Body.Close()
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		_, _ = h.Write(body)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// replayResponse writes the response stored in rec.
+func replayResponse(w http.ResponseWriter, rec IdempotencyRecord) {
+	h := w.Header()
+	for k, v := range rec.Header {
+		h[k] = slices.Clone(v)
+	}
+
+	h.Set("Idempotent-Replayed", "true")
+	w.WriteHeader(rec.Status)
+	_, _ = w.Write(rec.Body)
+}
+
+// logStoreFailure logs an error returned by the idempotency store.
+func logStoreFailure(ctx context.Context, w http.ResponseWriter, r *http.Request, options *IdempotencyOptions, err error) {
+	traceID := requestTraceID(w, r, options.TraceKey)
+	options.Logger.InfoContext(ctx, "idempotency store failed", append([]any{"error", err}, traceAttrs(ctx, options.Logger, traceID)...)...)
+}
+
+// writeIdempotencyProblem logs a rejected request, except for store failures
+// logged by the caller, and writes a problem response with status and detail.
+func writeIdempotencyProblem(w http.ResponseWriter, r *http.Request, options *IdempotencyOptions, status int, detail string) {
+	traceID := requestTraceID(w, r, options.TraceKey)
+
+	if status != http.StatusServiceUnavailable {
+		args := []any{
+			"status", status,
+			"method", r.Method,
+			"path", r.URL.Path,
+		}
+		options.Logger.InfoContext(r.Context(), "idempotent request rejected", append(args, traceAttrs(r.Context(), options.Logger, traceID)...)...)
+	}
+
+	p := NewProblem(status)
+	p.Detail = detail
+	p.Instance = r.URL.Path
+	p.TraceID = traceID
+
+	WriteProblem(w, p)
+}
@@ -0,0 +1,233 @@
+package middleware_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/paccolamano/goshare/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func idempotentRequest(method, target, key, body string) *http.Request {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
+
+	return req
+}
+
+func TestIdempotencyReplay(t *testing.T) {
+	t.Parallel()
+
+	var calls atomic.Int32
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		body, _ := io.ReadAll(r.Body)
+
+		w.Header().Set("Location", "/orders/"+strconv.Itoa(int(n)))
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write(body)
+	}
+
+	// chain sets a header before the middleware, as tracers do.
+	idem := middleware.Idempotency()(http.HandlerFunc(handler))
+	chain := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-Id", r.Header.Get("X-Request-Id"))
+		idem.ServeHTTP(w, r)
+	})
+
+	first := httptest.NewRecorder()
+	req := idempotentRequest(http.MethodPost, "/orders", "k1", `{"item":1}`)
+	req.Header.Set("X-Request-Id", "first")
+	chain.ServeHTTP(first, req)
+
+	require.Equal(t, http.StatusCreated, first.Code)
+	assert.Empty(t, first.Header().Get("Idempotent-Replayed"))
+
+	second := httptest.NewRecorder()
+	req = idempotentRequest(http.MethodPost, "/orders", "k1", `{"item":1}`)
+	req.Header.Set("X-Request-Id", "second")
+	chain.ServeHTTP(second, req)
+
+	assert.Equal(t, int32(1), calls.Load())
+	assert.Equal(t, http.StatusCreated, second.Code)
+	assert.Equal(t, "true", second.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, "/orders/1", second.Header().Get("Location"))
+	assert.Equal(t, "second", second.Header().Get("X-Request-Id"), "headers of previous middlewares should not be replayed")
+	assert.JSONEq(t, `{"item":1}`, second.Body.String())
+
+	// Requests without key, or with an ignored method, are always served.
+	for _, req := range []*http.Request{
+		idempotentRequest(http.MethodPost, "/orders", "", `{"item":1}`),
+		idempotentRequest(http.MethodPut, "/orders", "k1", `{"item":1}`),
+	} {
+		chain.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+func TestIdempotencyRejects(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	l := NewMockInfoLogger(ctrl)
+	l.EXPECT().InfoContext(gomock.Any(), "idempotent request rejected", gomock.Any()).Times(3)
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+
+	idem := middleware.Idempotency(middleware.WithIdempotencyLogger(l))(http.HandlerFunc(
+		func(w http.ResponseWriter, _ *http.Request) {
+			close(started)
+			<-release
+			w.WriteHeader(http.StatusCreated)
+		}))
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		idem.ServeHTTP(httptest.NewRecorder(), idempotentRequest(http.MethodPost, "/orders", "k1", "a"))
+	}()
+
+	<-started
+
+	w := httptest.NewRecorder()
+	idem.ServeHTTP(w, idempotentRequest(http.MethodPost, "/orders", "k1", "a"))
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	close(release)
+	<-done
+
+	w = httptest.NewRecorder()
+	idem.ServeHTTP(w, idempotentRequest(http.MethodPost, "/orders", "k1", "b"))
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, middleware.ProblemContentType, w.Header().Get("Content-Type"))
+
+	w = httptest.NewRecorder()
+	idem.ServeHTTP(w, idempotentRequest(http.MethodPost, "/orders", strings.Repeat("k", 256), "a"))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestIdempotencyNotStored(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{
+			name: "server error",
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+			},
+		},
+		{
+			name: "large body",
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				_, _ = io.WriteString(w, strings.Repeat("a", 11))
+			},
+		},
+		{
+			name: "panic",
+			handler: func(_ http.ResponseWriter, _ *http.Request) {
+				panic("boom")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			store := middleware.NewMemoryIdempotencyStore()
+			idem := middleware.Idempotency(
+				middleware.WithIdempotencyStore(store),
+				middleware.WithIdempotencyMaxBodySize(10),
+			)(tt.handler)
+
+			func() {
+				defer func() { _ = recover() }()
+
+				idem.ServeHTTP(httptest.NewRecorder(), idempotentRequest(http.MethodPost, "/", "k1", "a"))
+			}()
+
+			assert.Equal(t, 0, store.Len())
+		})
+	}
+}
+
+func TestIdempotencyScope(t *testing.T) {
+	t.Parallel()
+
+	store := middleware.NewMemoryIdempotencyStore()
+	idem := middleware.Idempotency(middleware.WithIdempotencyStore(store))(http.HandlerFunc(
+		func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusCreated)
+		}))
+
+	for _, subject := range []string{"alice", "bob"} {
+		req := idempotentRequest(http.MethodPost, "/orders", "k1", "a")
+		req = req.WithContext(middleware.ContextWithPrincipal(req.Context(), &middleware.Principal{Subject: subject}))
+
+		w := httptest.NewRecorder()
+		idem.ServeHTTP(w, req)
+		assert.Empty(t, w.Header().Get("Idempotent-Replayed"), subject)
+	}
+
+	assert.Equal(t, 2, store.Len())
+}
+
+func TestIdempotencyStoreFailure(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	errStore := errors.New("store unavailable")
+
+	store := NewMockIdempotencyStore(ctrl)
+	store.EXPECT().Create(gomock.Any(), ":k1", gomock.Any(), gomock.Any()).Return(middleware.IdempotencyRecord{}, false, errStore)
+
+	l := NewMockInfoLogger(ctrl)
+	l.EXPECT().InfoContext(gomock.Any(), "idempotency store failed", "error", errStore, "traceUUID", gomock.Any()).Times(1)
+
+	idem := middleware.Idempotency(middleware.WithIdempotencyStore(store), middleware.WithIdempotencyLogger(l))(
+		http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+			t.Error("handler should not be called")
+		}))
+
+	w := httptest.NewRecorder()
+	idem.ServeHTTP(w, idempotentRequest(http.MethodPost, "/", "k1", "a"))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
+
+func TestIdempotencyKeepsCallerRequest(t *testing.T) {
+	t.Parallel()
+
+	req := idempotentRequest(http.MethodPost, "/", "k1", "payload")
+	body := req.Body
+
+	var seen string
+
+	middleware.Idempotency()(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		seen = string(b)
+	})).ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, "payload", seen)
+	assert.True(t, req.Body == body, "the caller request should keep its body")
+}
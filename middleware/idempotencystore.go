@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+//go:generate mockgen -source=idempotencystore.go -destination=idempotencystore_mock_test.go -package=middleware_test
+
+// IdempotencyRecord is the state of an idempotency key, stored in an IdempotencyStore.
+type IdempotencyRecord struct {
+	// Fingerprint identifies the request first sent with the key.
+	Fingerprint string
+	// Completed reports whether the response is stored. It is false while
+	// the first request is in flight.
+	Completed bool
+	// Status, Header and Body are the stored response.
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// IdempotencyStore stores the records of the keys handled by the Idempotency
+// middleware. Implementations backed by external services, such as Redis,
+// allow sharing keys between server instances.
+type IdempotencyStore interface {
+	// Create stores rec under key, for ttl, unless key is already stored. It returns
+	// the stored record and false in that case, and rec and true otherwise.
+	Create(ctx context.Context, key string, rec IdempotencyRecord, ttl time.Duration) (IdempotencyRecord, bool, error)
+	// Save replaces the record of key, for ttl.
+	Save(ctx context.Context, key string, rec IdempotencyRecord, ttl time.Duration) error
+	// Delete removes key, allowing it to be used again.
+	Delete(ctx context.Context, key string) error
+}
+
+// MemoryIdempotencyStore is an in-memory IdempotencyStore.
+// Expired records are removed periodically.
+type MemoryIdempotencyStore struct {
+	mu        sync.Mutex
+	entries   map[string]idempotencyEntry
+	sweep     time.Duration
+	nextSweep time.Time
+}
+
+type idempotencyEntry struct {
+	rec     IdempotencyRecord
+	expires time.Time
+}
+
+// NewMemoryIdempotencyStore creates a MemoryIdempotencyStore removing
+// its expired records every minute.
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{
+		entries:   make(map[string]idempotencyEntry),
+		sweep:     time.Minute,
+		nextSweep: time.Now().Add(time.Minute),
+	}
+}
+
+// Create implements IdempotencyStore.
+func (s *MemoryIdempotencyStore) Create(_ context.Context, key string, rec IdempotencyRecord, ttl time.Duration) (IdempotencyRecord, bool, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.After(s.nextSweep) {
+		for k, e := range s.entries {
+			if !now.Before(e.expires) {
+				delete(s.entries, k)
+			}
+		}
+
+		s.nextSweep = now.Add(s.sweep)
+	}
+
+	if e, found := s.entries[key]; found && now.Before(e.expires) {
+		return e.rec, false, nil
+	}
+
+	s.entries[key] = idempotencyEntry{rec: rec, expires: now.Add(ttl)}
+
+	return rec, true, nil
+}
+
+// Save implements IdempotencyStore.
+func (s *MemoryIdempotencyStore) Save(_ context.Context, key string, rec IdempotencyRecord, ttl time.Duration) error {
+	s.mu.Lock()
+	s.entries[key] = idempotencyEntry{rec: rec, expires: time.Now().Add(ttl)}
+	s.mu.Unlock()
+
+	return nil
+}
+
+// Delete implements IdempotencyStore.
+func (s *MemoryIdempotencyStore) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	delete(s.entries, key)
+	s.mu.Unlock()
+
+	return nil
+}
+
+// Len returns the number of records held by the store, expired ones included.
+func (s *MemoryIdempotencyStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.entries)
+}
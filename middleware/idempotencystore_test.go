@@ -0,0 +1,55 @@
+package middleware_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/paccolamano/goshare/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryIdempotencyStore(t *testing.T) {
+	t.Parallel()
+
+	s := middleware.NewMemoryIdempotencyStore()
+	ctx := context.Background()
+
+	rec, created, err := s.Create(ctx, "key", middleware.IdempotencyRecord{Fingerprint: "a"}, time.Minute)
+	require.NoError(t, err)
+	assert.True(t, created)
+	assert.Equal(t, "a", rec.Fingerprint)
+
+	rec, created, err = s.Create(ctx, "key", middleware.IdempotencyRecord{Fingerprint: "b"}, time.Minute)
+	require.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, "a", rec.Fingerprint)
+
+	require.NoError(t, s.Save(ctx, "key", middleware.IdempotencyRecord{Fingerprint: "a", Completed: true, Status: 201}, time.Minute))
+
+	rec, _, err = s.Create(ctx, "key", middleware.IdempotencyRecord{}, time.Minute)
+	require.NoError(t, err)
+	assert.True(t, rec.Completed)
+	assert.Equal(t, 201, rec.Status)
+
+	require.NoError(t, s.Delete(ctx, "key"))
+	assert.Equal(t, 0, s.Len())
+}
+
+func TestMemoryIdempotencyStoreExpiry(t *testing.T) {
+	t.Parallel()
+
+	s := middleware.NewMemoryIdempotencyStore()
+	ctx := context.Background()
+
+	_, _, err := s.Create(ctx, "key", middleware.IdempotencyRecord{Fingerprint: "a"}, time.Millisecond)
+	require.NoError(t, err)
+
+	time.Sleep(5 * time.Millisecond)
+
+	rec, created, err := s.Create(ctx, "key", middleware.IdempotencyRecord{Fingerprint: "b"}, time.Minute)
+	require.NoError(t, err)
+	assert.True(t, created, "expired keys should be created again")
+	assert.Equal(t, "b", rec.Fingerprint)
+}
@@ -0,0 +1,322 @@
+package middleware
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// maxJWKSSize bounds the size of fetched JWKS documents.
+const maxJWKSSize = 1 << 20
+
+// JWKSOptions holds configuration options for a JWKS.
+type JWKSOptions struct {
+	TTL             time.Duration
+	RefreshInterval time.Duration
+	Client          *http.Client
+	SymmetricKeys   bool
+}
+
+// JWKSOption represents a functional option for configuring a JWKS.
+type JWKSOption func(*JWKSOptions)
+
+// WithJWKSTTL sets how long loaded keys are used before being reloaded.
+// The default is one hour.
+func WithJWKSTTL(d time.Duration) JWKSOption {
+	return func(opt *JWKSOptions) {
+		opt.TTL = d
+	}
+}
+
+// WithJWKSRefreshInterval sets the minimum interval between reloads, including
+// those triggered by unknown key IDs, which happen when keys are rotated, and
+// retries of failed reloads. The default is one minute.
+func WithJWKSRefreshInterval(d time.Duration) JWKSOption {
+	return func(opt *JWKSOptions) {
+		opt.RefreshInterval = d
+	}
+}
+
+// WithJWKSClient sets the HTTP client fetching JWKS URLs.
+// The default is a client with a 10 seconds timeout.
+func WithJWKSClient(c *http.Client) JWKSOption {
+	return func(opt *JWKSOptions) {
+		opt.Client = c
+	}
+}
+
+// WithJWKSSymmetricKeys accepts the symmetric ("oct") keys of the key set, which are
+// skipped by default: whoever can read them can sign tokens, so they should
+// never be published, and accepting them lets a compromised or spoofed key set
+// mint valid tokens with a shared secret.
+func WithJWKSSymmetricKeys() JWKSOption {
+	return func(opt *JWKSOptions) {
+		opt.SymmetricKeys = true
+	}
+}
+
+// JWKS is a JWTKeySet loading a JSON Web Key Set (RFC 7517) from a URL or a file.
+// Keys are cached and reloaded when their TTL expires or when a token refers to
+// an unknown key ID, at most once per refresh interval. If reloading fails, the
+// previous keys are kept. Symmetric keys are skipped unless WithJWKSSymmetricKeys is used.
+// It is safe for concurrent use.
+type JWKS struct {
+	options *JWKSOptions
+	load    func(ctx context.Context) ([]byte, error)
+
+	mu        sync.Mutex
+	keys      []JWK
+	err       error
+	loaded    time.Time
+	attempted time.Time
+	loading   chan struct{}
+}
+
+// NewJWKS creates a JWKS fetched from url.
+func NewJWKS(url string, opts ...JWKSOption) *JWKS {
+	s := newJWKS(opts)
+	s.load = func(ctx context.Context) ([]byte, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := s.options.Client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		defer func() { _ = resp.Body.Close() }()
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("unexpected status %s", resp.Status)
+		}
+
+		return io.ReadAll(io.LimitReader(resp.Body, maxJWKSSize))
+	}
+
+	return s
+}
+
+// NewJWKSFile creates a JWKS read from the file at path.
+func NewJWKSFile(path string, opts ...JWKSOption) *JWKS {
+	s := newJWKS(opts)
+	s.load = func(context.Context) ([]byte, error) {
+		return os.ReadFile(path)
+	}
+
+	return s
+}
+
+func newJWKS(opts []JWKSOption) *JWKS {
+	options := &JWKSOptions{
+		TTL:             time.Hour,
+		RefreshInterval: time.Minute,
+		Client:          &http.Client{Timeout: 10 * time.Second},
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	return &JWKS{options: options}
+}
+
+// Keys implements JWTKeySet. A single request reloads the keys, outside of the
+// lock, while concurrent requests keep using the current keys, or wait for the
+// reload when they need new ones.
+func (s *JWKS) Keys(ctx context.Context, kid string) ([]JWK, error) {
+	s.mu.Lock()
+
+	now := time.Now()
+	stale := now.Sub(s.loaded) >= s.options.TTL
+	unknown := kid != "" && !slices.ContainsFunc(s.keys, func(k JWK) bool { return k.KeyID == kid })
+	due := now.Sub(s.attempted) >= s.options.RefreshInterval
+	loading := s.loading
+
+	// Failed reloads of stale keys are retried once per refresh interval.
+	switch {
+	case loading == nil && ((stale && (s.err == nil || due)) || (unknown && due)):
+		s.attempted = now
+		loading = make(chan struct{})
+		s.loading = loading
+		s.mu.Unlock()
+
+		// The reload is shared with the waiting requests, so it does not
+		// depend on the cancellation of the request triggering it.
+		s.reload(context.WithoutCancel(ctx), loading)
+		s.mu.Lock()
+	case loading != nil && (s.keys == nil || unknown):
+		s.mu.Unlock()
+
+		select {
+		case <-loading:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		s.mu.Lock()
+	}
+
+	defer s.mu.Unlock()
+
+	if s.keys == nil && s.err != nil {
+		return nil, s.err
+	}
+
+	return filterKeys(s.keys, kid), nil
+}
+
+// reload loads the keys, then closes done. Failures keep the previous keys.
+func (s *JWKS) reload(ctx context.Context, done chan struct{}) {
+	keys, err := s.fetch(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err == nil {
+		s.keys, s.loaded = keys, time.Now()
+	}
+
+	s.err = err
+	s.loading = nil
+	close(done)
+}
+
+func (s *JWKS) fetch(ctx context.Context) ([]JWK, error) {
+	data, err := s.load(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("middleware: load jwks: %w", err)
+	}
+
+	keys, err := ParseJWKS(data)
+	if err != nil || s.options.SymmetricKeys {
+		return keys, err
+	}
+
+	return slices.DeleteFunc(keys, func(k JWK) bool {
+		_, ok := k.Key.([]byte)
+		return ok
+	}), nil
+}
+
+// jsonWebKey is the JSON representation of a JWK.
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+// ParseJWKS parses a JSON Web Key Set. RSA, P-256 EC, Ed25519 OKP and symmetric
+// keys are returned; encryption keys and other key types are skipped.
+func ParseJWKS(data []byte) ([]JWK, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("middleware: parse jwks: %w", err)
+	}
+
+	var keys []JWK
+
+	for _, jwk := range set.Keys {
+		if jwk.Use == "enc" {
+			continue
+		}
+
+		key, err := jwk.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("middleware: parse jwk %q: %w", jwk.Kid, err)
+		}
+
+		if key != nil {
+			keys = append(keys, JWK{KeyID: jwk.Kid, Algorithm: jwk.Alg, Key: key})
+		}
+	}
+
+	return keys, nil
+}
+
+// publicKey returns the key of k, or nil for unsupported key types.
+func (k jsonWebKey) publicKey() (any, error) {
+	switch {
+	case k.Kty == "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := decodeBigInt(k.E)
+		if err != nil || !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("invalid exponent %q", k.E)
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case k.Kty == "EC" && k.Crv == "P-256":
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+		if _, err := key.ECDH(); err != nil {
+			return nil, err
+		}
+
+		return key, nil
+	case k.Kty == "OKP" && k.Crv == "Ed25519":
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key size %d", len(x))
+		}
+
+		return ed25519.PublicKey(x), nil
+	case k.Kty == "oct":
+		secret, err := base64.RawURLEncoding.DecodeString(k.K)
+		if err != nil || len(secret) == 0 {
+			return nil, fmt.Errorf("invalid symmetric key")
+		}
+
+		return secret, nil
+	default:
+		return nil, nil
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,302 @@
+package middleware_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/paccolamano/goshare/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func rsaJWK(kid string, key *rsa.PrivateKey) map[string]any {
+	return map[string]any{
+		"kty": "RSA", "kid": kid, "alg": "RS256", "use": "sig",
+		"n": b64(key.N.Bytes()), "e": b64(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func jwksDocument(t *testing.T, keys ...map[string]any) []byte {
+	t.Helper()
+
+	data, err := json.Marshal(map[string]any{"keys": keys})
+	require.NoError(t, err)
+
+	return data
+}
+
+func TestParseJWKS(t *testing.T) {
+	t.Parallel()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	edPub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	keys, err := middleware.ParseJWKS(jwksDocument(t,
+		rsaJWK("rsa", rsaKey),
+		map[string]any{
+			"kty": "EC", "kid": "ec", "crv": "P-256",
+			"x": b64(ecKey.X.FillBytes(make([]byte, 32))), "y": b64(ecKey.Y.FillBytes(make([]byte, 32))),
+		},
+		map[string]any{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": b64(edPub)},
+		map[string]any{"kty": "oct", "kid": "hmac", "k": b64([]byte("secret"))},
+		map[string]any{"kty": "RSA", "kid": "enc", "use": "enc", "n": "AQAB", "e": "AQAB"},
+		map[string]any{"kty": "EC", "kid": "p384", "crv": "P-384"},
+	))
+	require.NoError(t, err)
+	require.Len(t, keys, 4)
+
+	assert.Equal(t, middleware.JWK{KeyID: "rsa", Algorithm: "RS256", Key: &rsaKey.PublicKey}, keys[0])
+	assert.True(t, ecKey.PublicKey.Equal(keys[1].Key))
+	assert.Equal(t, edPub, keys[2].Key)
+	assert.Equal(t, []byte("secret"), keys[3].Key)
+
+	_, err = middleware.ParseJWKS(jwksDocument(t, map[string]any{"kty": "EC", "crv": "P-256", "x": "AQ", "y": "AQ"}))
+	require.Error(t, err, "points off the curve should be rejected")
+
+	_, err = middleware.ParseJWKS([]byte("{"))
+	require.Error(t, err)
+}
+
+func TestJWKSFile(t *testing.T) {
+	t.Parallel()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, jwksDocument(t, rsaJWK("k1", key)), 0o600))
+
+	a := middleware.NewJWTAuthenticator(middleware.WithJWTKeySet(middleware.NewJWKSFile(path)))
+
+	p, err := a.Authenticate(bearerRequest(signToken(t, middleware.AlgRS256, "k1", key, validClaims())))
+	require.NoError(t, err)
+	assert.Equal(t, "user-42", p.Subject)
+
+	_, err = middleware.NewJWKSFile(filepath.Join(t.TempDir(), "missing.json")).Keys(t.Context(), "")
+	require.Error(t, err)
+}
+
+func TestJWKSUnavailable(t *testing.T) {
+	t.Parallel()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	a := middleware.NewJWTAuthenticator(middleware.WithJWTKeySet(
+		middleware.NewJWKSFile(filepath.Join(t.TempDir(), "missing.json"))))
+
+	req := bearerRequest(signToken(t, middleware.AlgRS256, "k1", key, validClaims()))
+
+	_, err = a.Authenticate(req)
+	require.ErrorIs(t, err, middleware.ErrKeySetUnavailable)
+	require.NotErrorIs(t, err, middleware.ErrInvalidToken)
+
+	w := httptest.NewRecorder()
+	middleware.Auth(
+		middleware.WithAuthenticators(a),
+		middleware.WithAuthLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)(http.NotFoundHandler()).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, middleware.ProblemContentType, w.Header().Get("Content-Type"))
+	assert.Empty(t, w.Header().Get("WWW-Authenticate"))
+}
+
+func TestJWKSSymmetricKeys(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write(jwksDocument(t, map[string]any{"kty": "oct", "kid": "hmac", "k": b64([]byte("secret"))}))
+	}))
+	defer srv.Close()
+
+	keys, err := middleware.NewJWKS(srv.URL, middleware.WithJWKSClient(srv.Client())).Keys(t.Context(), "")
+	require.NoError(t, err)
+	assert.Empty(t, keys, "symmetric keys should be skipped by default")
+
+	keys, err = middleware.NewJWKS(srv.URL,
+		middleware.WithJWKSClient(srv.Client()),
+		middleware.WithJWKSSymmetricKeys(),
+	).Keys(t.Context(), "")
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.Equal(t, []byte("secret"), keys[0].Key)
+}
+
+func TestJWKSURL(t *testing.T) {
+	t.Parallel()
+
+	k1, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	k2, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	var (
+		fetches atomic.Int32
+		doc     atomic.Value
+		fail    atomic.Bool
+	)
+
+	doc.Store(jwksDocument(t, rsaJWK("k1", k1)))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fetches.Add(1)
+
+		if fail.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		_, _ = w.Write(doc.Load().([]byte))
+	}))
+	defer srv.Close()
+
+	jwks := middleware.NewJWKS(srv.URL, middleware.WithJWKSClient(srv.Client()), middleware.WithJWKSRefreshInterval(0))
+	a := middleware.NewJWTAuthenticator(middleware.WithJWTKeySet(jwks))
+
+	for range 3 {
+		_, err := a.Authenticate(bearerRequest(signToken(t, middleware.AlgRS256, "k1", k1, validClaims())))
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, int32(1), fetches.Load(), "keys should be cached")
+
+	// Rotation: the unknown kid triggers a reload.
+	doc.Store(jwksDocument(t, rsaJWK("k1", k1), rsaJWK("k2", k2)))
+
+	_, err = a.Authenticate(bearerRequest(signToken(t, middleware.AlgRS256, "k2", k2, validClaims())))
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), fetches.Load())
+
+	// Failed reloads keep the previous keys.
+	fail.Store(true)
+
+	_, err = a.Authenticate(bearerRequest(signToken(t, middleware.AlgRS256, "k3", k1, validClaims())))
+	require.ErrorIs(t, err, middleware.ErrInvalidToken)
+
+	_, err = a.Authenticate(bearerRequest(signToken(t, middleware.AlgRS256, "k1", k1, validClaims())))
+	require.NoError(t, err)
+}
+
+func TestJWKSRefreshInterval(t *testing.T) {
+	t.Parallel()
+
+	var fetches atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fetches.Add(1)
+		_, _ = w.Write([]byte(`{"keys":[]}`))
+	}))
+	defer srv.Close()
+
+	jwks := middleware.NewJWKS(srv.URL, middleware.WithJWKSRefreshInterval(time.Hour))
+
+	for range 3 {
+		keys, err := jwks.Keys(t.Context(), "unknown")
+		require.NoError(t, err)
+		assert.Empty(t, keys)
+	}
+
+	assert.Equal(t, int32(1), fetches.Load(), "unknown kids should not reload more than once per interval")
+
+	failing := middleware.NewJWKS(srv.URL + "/missing\x7f")
+	_, err := failing.Keys(t.Context(), "")
+	require.Error(t, err)
+}
+
+func TestJWKSStaleReloadFailure(t *testing.T) {
+	t.Parallel()
+
+	var (
+		fetches atomic.Int32
+		fail    atomic.Bool
+	)
+
+	release := make(chan struct{})
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fetches.Add(1)
+
+		if fail.Load() {
+			<-release
+			w.WriteHeader(http.StatusServiceUnavailable)
+
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"keys":[{"kty":"oct","kid":"k1","k":"c2VjcmV0"}]}`))
+	}))
+	defer srv.Close()
+
+	jwks := middleware.NewJWKS(srv.URL,
+		middleware.WithJWKSClient(srv.Client()),
+		middleware.WithJWKSTTL(time.Millisecond),
+		middleware.WithJWKSRefreshInterval(time.Hour),
+		middleware.WithJWKSSymmetricKeys(),
+	)
+
+	keys, err := jwks.Keys(t.Context(), "k1")
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+
+	fail.Store(true)
+	time.Sleep(5 * time.Millisecond)
+
+	// The stale keys trigger a single reload, hanging until released.
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		keys, err := jwks.Keys(t.Context(), "k1")
+		assert.NoError(t, err)
+		assert.Len(t, keys, 1)
+	}()
+
+	require.Eventually(t, func() bool { return fetches.Load() == 2 }, time.Second, time.Millisecond)
+
+	// Meanwhile, other requests are served the last good keys without waiting.
+	for range 10 {
+		keys, err := jwks.Keys(t.Context(), "k1")
+		require.NoError(t, err)
+		assert.Len(t, keys, 1)
+	}
+
+	close(release)
+	<-done
+
+	// The failed reload is not retried before the refresh interval.
+	for range 10 {
+		keys, err := jwks.Keys(t.Context(), "k1")
+		require.NoError(t, err)
+		assert.Len(t, keys, 1)
+	}
+
+	assert.Equal(t, int32(2), fetches.Load())
+}
@@ -0,0 +1,392 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// JWT signature algorithms supported by the JWTAuthenticator.
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+	AlgEdDSA = "EdDSA"
+)
+
+// MinHMACKeySize is the minimum size, in bytes, of HS256 secrets: shorter
+// secrets, which can be guessed or brute forced, never verify signatures.
+const MinHMACKeySize = 32
+
+var (
+	// ErrInvalidToken is returned when a JWT is malformed, wrongly signed or
+	// its claims are not valid.
+	ErrInvalidToken = errors.New("middleware: invalid token")
+	// ErrKeySetUnavailable is returned when the keys verifying a JWT cannot be
+	// loaded, for instance when a JWKS cannot be fetched. The token is then
+	// neither valid nor invalid: Auth answers with a 503 problem response.
+	ErrKeySetUnavailable = errors.New("middleware: jwt key set unavailable")
+)
+
+// JWK is a key verifying JWT signatures. Key is a []byte HMAC secret,
+// an *rsa.PublicKey, an *ecdsa.PublicKey or an ed25519.PublicKey.
+// An empty Algorithm allows any algorithm suited to the key type.
+type JWK struct {
+	KeyID     string
+	Algorithm string
+	Key       any
+}
+
+// JWTKeySet provides the keys verifying JWT signatures.
+type JWTKeySet interface {
+	// Keys returns the keys with the given key ID, or all keys if kid is empty.
+	Keys(ctx context.Context, kid string) ([]JWK, error)
+}
+
+// StaticKeySet is a JWTKeySet of fixed keys.
+type StaticKeySet []JWK
+
+// Keys implements JWTKeySet.
+func (s StaticKeySet) Keys(_ context.Context, kid string) ([]JWK, error) {
+	return filterKeys(s, kid), nil
+}
+
+// filterKeys returns the keys with the given key ID, or all keys if kid is empty.
+// Keys without ID match any kid.
+func filterKeys(keys []JWK, kid string) []JWK {
+	if kid == "" {
+		return keys
+	}
+
+	return slices.DeleteFunc(slices.Clone(keys), func(k JWK) bool {
+		return k.KeyID != "" && k.KeyID != kid
+	})
+}
+
+// JWTOptions holds configuration options for the JWTAuthenticator.
+type JWTOptions struct {
+	Keys       []JWK
+	KeySet     JWTKeySet
+	Algorithms []string
+	Issuer     string
+	Audience   []string
+	ClockSkew  time.Duration
+	RequireExp bool
+}
+
+// JWTOption represents a functional option for configuring a JWTAuthenticator.
+type JWTOption func(*JWTOptions)
+
+// WithJWTKeys adds static keys verifying token signatures. It can be used multiple times.
+func WithJWTKeys(keys ...JWK) JWTOption {
+	return func(opt *JWTOptions) {
+		opt.Keys = append(opt.Keys, keys...)
+	}
+}
+
+// WithHMACSecret adds a secret verifying HS256 token signatures.
+// The secret must be at least MinHMACKeySize bytes long.
+func WithHMACSecret(secret []byte) JWTOption {
+	return WithJWTKeys(JWK{Algorithm: AlgHS256, Key: secret})
+}
+
+// WithJWTKeySet sets the key set verifying token signatures, such as a JWKS.
+// It takes precedence over static keys.
+func WithJWTKeySet(ks JWTKeySet) JWTOption {
+	return func(opt *JWTOptions) {
+		opt.KeySet = ks
+	}
+}
+
+// WithJWTAlgorithms restricts the accepted signature algorithms.
+// By default HS256, RS256, ES256 and EdDSA are accepted.
+func WithJWTAlgorithms(algs ...string) JWTOption {
+	return func(opt *JWTOptions) {
+		opt.Algorithms = algs
+	}
+}
+
+// WithIssuer requires the iss claim to be issuer.
+func WithIssuer(issuer string) JWTOption {
+	return func(opt *JWTOptions) {
+		opt.Issuer = issuer
+	}
+}
+
+// WithAudience requires the aud claim to contain one of audience.
+func WithAudience(audience ...string) JWTOption {
+	return func(opt *JWTOptions) {
+		opt.Audience = audience
+	}
+}
+
+// WithClockSkew sets the tolerance applied to the exp and nbf claims.
+// The default is 30 seconds.
+func WithClockSkew(d time.Duration) JWTOption {
+	return func(opt *JWTOptions) {
+		opt.ClockSkew = d
+	}
+}
+
+// WithOptionalExp accepts tokens without exp claim, which are otherwise rejected.
+func WithOptionalExp() JWTOption {
+	return func(opt *JWTOptions) {
+		opt.RequireExp = false
+	}
+}
+
+// JWTAuthenticator is an Authenticator verifying JWTs sent as bearer tokens
+// in the Authorization header.
+type JWTAuthenticator struct {
+	options *JWTOptions
+	keys    JWTKeySet
+}
+
+// NewJWTAuthenticator creates a JWTAuthenticator.
+//
+// Example usage:
+//
+//	a := NewJWTAuthenticator(WithJWTKeySet(NewJWKS("https://idp.example.com/jwks.json")),
+//		WithIssuer("https://idp.example.com"), WithAudience("orders-api"))
+//
+// It panics if a static HMAC secret is shorter than MinHMACKeySize.
+func NewJWTAuthenticator(opts ...JWTOption) *JWTAuthenticator {
+	options := &JWTOptions{
+		Algorithms: []string{AlgHS256, AlgRS256, AlgES256, AlgEdDSA},
+		ClockSkew:  30 * time.Second,
+		RequireExp: true,
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	for _, k := range options.Keys {
+		if secret, ok := k.Key.([]byte); ok && len(secret) < MinHMACKeySize {
+			panic("middleware: HMAC secrets must be at least 32 bytes long")
+		}
+	}
+
+	keys := options.KeySet
+	if keys == nil {
+		keys = StaticKeySet(options.Keys)
+	}
+
+	return &JWTAuthenticator{options: options, keys: keys}
+}
+
+// Authenticate implements Authenticator.
+func (a *JWTAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, SchemeBearer) {
+		return nil, ErrNoCredentials
+	}
+
+	claims, err := a.Verify(r.Context(), strings.TrimSpace(token))
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Principal{Scheme: SchemeBearer, Claims: claims}
+	p.Subject, _ = claims["sub"].(string)
+	p.Roles = stringsClaim(claims["roles"])
+
+	if scope, ok := claims["scope"].(string); ok {
+		p.Scopes = strings.Fields(scope)
+	} else {
+		p.Scopes = stringsClaim(claims["scp"])
+	}
+
+	return p, nil
+}
+
+// Challenge implements Authenticator.
+func (a *JWTAuthenticator) Challenge() string {
+	return SchemeBearer
+}
+
+// jwtHeader is the JOSE header of a JWT.
+type jwtHeader struct {
+	Alg  string   `json:"alg"`
+	Kid  string   `json:"kid"`
+	Crit []string `json:"crit"`
+}
+
+// Verify verifies the signature and the claims of token and returns its claims.
+func (a *JWTAuthenticator) Verify(ctx context.Context, token string) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidToken)
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: header: %w", ErrInvalidToken, err)
+	}
+
+	if !slices.Contains(a.options.Algorithms, header.Alg) {
+		return nil, fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, header.Alg)
+	}
+
+	if len(header.Crit) > 0 {
+		return nil, fmt.Errorf("%w: unsupported critical headers %q", ErrInvalidToken, header.Crit)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature: %w", ErrInvalidToken, err)
+	}
+
+	keys, err := a.keys.Keys(ctx, header.Kid)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrKeySetUnavailable, err)
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+	if !slices.ContainsFunc(keys, func(k JWK) bool {
+		return (k.Algorithm == "" || k.Algorithm == header.Alg) && verifySignature(header.Alg, k.Key, signed, sig)
+	}) {
+		return nil, fmt.Errorf("%w: signature verification failed", ErrInvalidToken)
+	}
+
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: claims: %w", ErrInvalidToken, err)
+	}
+
+	if err := a.validate(claims, time.Now()); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	return claims, nil
+}
+
+// validate validates the registered claims at now.
+func (a *JWTAuthenticator) validate(claims map[string]any, now time.Time) error {
+	skew := a.options.ClockSkew
+
+	exp, ok, err := numericDate(claims, "exp")
+	switch {
+	case err != nil:
+		return err
+	case !ok && a.options.RequireExp:
+		return errors.New("missing exp claim")
+	case ok && now.After(exp.Add(skew)):
+		return errors.New("token expired")
+	}
+
+	nbf, ok, err := numericDate(claims, "nbf")
+	switch {
+	case err != nil:
+		return err
+	case ok && now.Add(skew).Before(nbf):
+		return errors.New("token not valid yet")
+	}
+
+	if a.options.Issuer != "" && claims["iss"] != a.options.Issuer {
+		return fmt.Errorf("unexpected issuer %v", claims["iss"])
+	}
+
+	if len(a.options.Audience) > 0 {
+		aud := stringsClaim(claims["aud"])
+		if s, ok := claims["aud"].(string); ok {
+			aud = []string{s}
+		}
+
+		if !slices.ContainsFunc(aud, func(s string) bool { return slices.Contains(a.options.Audience, s) }) {
+			return fmt.Errorf("unexpected audience %v", claims["aud"])
+		}
+	}
+
+	return nil
+}
+
+// numericDate returns the NumericDate claim name, if present.
+func numericDate(claims map[string]any, name string) (time.Time, bool, error) {
+	v, ok := claims[name]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+
+	n, ok := v.(float64)
+	if !ok || math.IsNaN(n) || math.IsInf(n, 0) {
+		return time.Time{}, false, fmt.Errorf("malformed %s claim", name)
+	}
+
+	sec, frac := math.Modf(n)
+
+	return time.Unix(int64(sec), int64(frac*1e9)), true, nil
+}
+
+// stringsClaim returns the strings of an array claim.
+func stringsClaim(v any) []string {
+	values, _ := v.([]any)
+
+	var out []string
+
+	for _, v := range values {
+		if s, ok := v.(string); ok {
+			out = append(out, s)
+		}
+	}
+
+	return out
+}
+
+// decodeSegment decodes a base64url JSON segment of a JWT into v.
+func decodeSegment(seg string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+
+	return json.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// verifySignature reports whether sig is a valid alg signature of signed for key.
+// Keys of a type not suited to alg never verify, preventing algorithm confusion.
+func verifySignature(alg string, key any, signed, sig []byte) bool {
+	digest := sha256.Sum256(signed)
+
+	switch k := key.(type) {
+	case []byte:
+		if alg != AlgHS256 || len(k) < MinHMACKeySize {
+			return false
+		}
+
+		mac := hmac.New(sha256.New, k)
+		mac.Write(signed)
+
+		return hmac.Equal(mac.Sum(nil), sig)
+	case *rsa.PublicKey:
+		return alg == AlgRS256 && rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], sig) == nil
+	case *ecdsa.PublicKey:
+		if alg != AlgES256 || k.Curve != elliptic.P256() || len(sig) != 64 {
+			return false
+		}
+
+		r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+
+		return ecdsa.Verify(k, digest[:], r, s)
+	case ed25519.PublicKey:
+		return alg == AlgEdDSA && ed25519.Verify(k, signed, sig)
+	default:
+		return false
+	}
+}
@@ -0,0 +1,233 @@
+package middleware_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/paccolamano/goshare/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// signToken returns a JWT of claims signed with key using alg.
+func signToken(t *testing.T, alg, kid string, key any, claims map[string]any) string {
+	t.Helper()
+
+	header := map[string]any{"alg": alg, "typ": "JWT"}
+	if kid != "" {
+		header["kid"] = kid
+	}
+
+	encode := func(v any) string {
+		data, err := json.Marshal(v)
+		require.NoError(t, err)
+
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+
+	signed := encode(header) + "." + encode(claims)
+	digest := sha256.Sum256([]byte(signed))
+
+	var (
+		sig []byte
+		err error
+	)
+
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+	case *ecdsa.PrivateKey:
+		r, s, signErr := ecdsa.Sign(rand.Reader, k, digest[:])
+		err = signErr
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(k, []byte(signed))
+	}
+
+	require.NoError(t, err)
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func validClaims() map[string]any {
+	return map[string]any{
+		"sub":   "user-42",
+		"iss":   "https://idp.example.com",
+		"aud":   []string{"orders", "billing"},
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"scope": "orders:read orders:write",
+		"roles": []string{"admin"},
+	}
+}
+
+func bearerRequest(token string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	return req
+}
+
+func TestJWTAuthenticatorAlgorithms(t *testing.T) {
+	t.Parallel()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	secret := []byte("0123456789abcdef0123456789abcdef")
+
+	a := middleware.NewJWTAuthenticator(
+		middleware.WithHMACSecret(secret),
+		middleware.WithJWTKeys(
+			middleware.JWK{KeyID: "rsa", Key: &rsaKey.PublicKey},
+			middleware.JWK{KeyID: "ec", Key: &ecKey.PublicKey},
+			middleware.JWK{KeyID: "ed", Key: edPub},
+		),
+		middleware.WithIssuer("https://idp.example.com"),
+		middleware.WithAudience("orders"),
+	)
+
+	tests := []struct {
+		alg string
+		kid string
+		key any
+	}{
+		{alg: middleware.AlgHS256, key: secret},
+		{alg: middleware.AlgRS256, kid: "rsa", key: rsaKey},
+		{alg: middleware.AlgES256, kid: "ec", key: ecKey},
+		{alg: middleware.AlgEdDSA, kid: "ed", key: edKey},
+		{alg: middleware.AlgRS256, key: rsaKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.alg+"/"+tt.kid, func(t *testing.T) {
+			t.Parallel()
+
+			p, err := a.Authenticate(bearerRequest(signToken(t, tt.alg, tt.kid, tt.key, validClaims())))
+			require.NoError(t, err)
+
+			assert.Equal(t, "user-42", p.Subject)
+			assert.Equal(t, middleware.SchemeBearer, p.Scheme)
+			assert.Equal(t, []string{"orders:read", "orders:write"}, p.Scopes)
+			assert.True(t, p.HasRole("admin"))
+			assert.Equal(t, "https://idp.example.com", p.Claims["iss"])
+		})
+	}
+}
+
+func TestJWTAuthenticatorRejects(t *testing.T) {
+	t.Parallel()
+
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	a := middleware.NewJWTAuthenticator(
+		middleware.WithHMACSecret(secret),
+		middleware.WithJWTKeys(middleware.JWK{KeyID: "rsa", Algorithm: middleware.AlgRS256, Key: &rsaKey.PublicKey}),
+		middleware.WithIssuer("https://idp.example.com"),
+		middleware.WithAudience("orders"),
+		middleware.WithClockSkew(time.Minute),
+	)
+
+	with := func(name string, value any) map[string]any {
+		claims := validClaims()
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+
+		return claims
+	}
+
+	now := time.Now()
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{name: "malformed", token: "not.a.jwt.token"},
+		{name: "wrong secret", token: signToken(t, middleware.AlgHS256, "", []byte("other"), validClaims())},
+		{name: "unsupported algorithm", token: signToken(t, "HS512", "", secret, validClaims())},
+		{name: "expired", token: signToken(t, middleware.AlgHS256, "", secret, with("exp", now.Add(-2*time.Minute).Unix()))},
+		{name: "missing exp", token: signToken(t, middleware.AlgHS256, "", secret, with("exp", nil))},
+		{name: "not yet valid", token: signToken(t, middleware.AlgHS256, "", secret, with("nbf", now.Add(2*time.Minute).Unix()))},
+		{name: "issuer", token: signToken(t, middleware.AlgHS256, "", secret, with("iss", "https://evil.com"))},
+		{name: "audience", token: signToken(t, middleware.AlgHS256, "", secret, with("aud", "inventory"))},
+		// An HS256 token signed with the RSA public key must not verify.
+		{name: "algorithm confusion", token: signToken(t, middleware.AlgHS256, "rsa", rsaKey.N.Bytes(), validClaims())},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := a.Authenticate(bearerRequest(tt.token))
+			require.ErrorIs(t, err, middleware.ErrInvalidToken)
+		})
+	}
+
+	for name, claims := range map[string]map[string]any{
+		"within skew": with("exp", now.Add(-30*time.Second).Unix()),
+		"audience":    with("aud", "orders"),
+	} {
+		_, err := a.Authenticate(bearerRequest(signToken(t, middleware.AlgHS256, "", secret, claims)))
+		require.NoError(t, err, name)
+	}
+
+	_, err = a.Authenticate(httptest.NewRequest(http.MethodGet, "/", nil))
+	require.ErrorIs(t, err, middleware.ErrNoCredentials)
+}
+
+func TestJWTAuthenticatorOptionalExp(t *testing.T) {
+	t.Parallel()
+
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	a := middleware.NewJWTAuthenticator(middleware.WithHMACSecret(secret), middleware.WithOptionalExp(),
+		middleware.WithJWTAlgorithms(middleware.AlgHS256))
+
+	claims := validClaims()
+	delete(claims, "exp")
+	delete(claims, "scope")
+	claims["scp"] = []string{"a", "b"}
+
+	p, err := a.Authenticate(bearerRequest(signToken(t, middleware.AlgHS256, "", secret, claims)))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, p.Scopes)
+}
+
+func TestJWTAuthenticatorShortSecret(t *testing.T) {
+	t.Parallel()
+
+	for _, secret := range [][]byte{nil, {}, []byte("secret")} {
+		assert.Panics(t, func() { middleware.NewJWTAuthenticator(middleware.WithHMACSecret(secret)) })
+	}
+
+	// Short secrets of key sets never verify, so that empty keys cannot be used to forge tokens.
+	a := middleware.NewJWTAuthenticator(middleware.WithJWTKeySet(middleware.StaticKeySet{{Algorithm: middleware.AlgHS256, Key: []byte{}}}))
+
+	_, err := a.Authenticate(bearerRequest(signToken(t, middleware.AlgHS256, "", []byte{}, validClaims())))
+	require.ErrorIs(t, err, middleware.ErrInvalidToken)
+}
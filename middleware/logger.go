@@ -2,10 +2,13 @@ package middleware
 
 import (
 	"context"
+	"io"
 	"log/slog"
-	"net"
 	"net/http"
+	"slices"
 	"time"
+
+	"github.com/paccolamano/goshare/logger"
 )
 
 //go:generate mockgen -source=logger.go -destination=logger_mock_test.go -package=middleware_test
@@ -18,79 +21,430 @@ type InfoLogger interface {
 	InfoContext(ctx context.Context, msg string, args ...any)
 }
 
-// RecoverOptions holds configuration options for the Recover middleware,
-// including the logger and the panic callback handler.
+// LevelLogger defines the interface of loggers able to log at any level,
+// such as slog.Logger. When the logger given to the Logger middleware implements it,
+// records can be emitted at warn or error level.
+type LevelLogger interface {
+	// Log logs a message at the given level with context and key-value pairs.
+	Log(ctx context.Context, level slog.Level, msg string, args ...any)
+}
+
+// LogField identifies a field logged by the Logger middleware.
+// The field value is also used as the attribute key.
+type LogField string
+
+// Fields available to the Logger middleware.
+const (
+	FieldMethod        LogField = "method"
+	FieldPath          LogField = "path"
+	FieldQuery         LogField = "query"
+	FieldIP            LogField = "ip"
+	FieldUserAgent     LogField = "userAgent"
+	FieldContentLength LogField = "contentLength"
+	FieldProto         LogField = "proto"
+	FieldReferer       LogField = "referer"
+	FieldTraceID       LogField = "traceUUID"
+	FieldRoute         LogField = "route"
+	FieldStatus        LogField = "status"
+	FieldDuration      LogField = "duration"
+	FieldRequestBytes  LogField = "requestBytes"
+	FieldResponseBytes LogField = "responseBytes"
+	FieldTTFB          LogField = "ttfb"
+	FieldCache         LogField = "cache" // CacheStatusHeader set by the Cache middleware; not a default field.
+)
+
+// requestFields lists the fields known before the request is served,
+// which can be logged in the "incoming request" record.
+var requestFields = []LogField{
+	FieldMethod, FieldPath, FieldQuery, FieldIP, FieldUserAgent,
+	FieldContentLength, FieldProto, FieldReferer, FieldTraceID,
+}
+
+var (
+	defaultRequestFields  = []LogField{FieldMethod, FieldPath, FieldQuery, FieldIP, FieldUserAgent, FieldContentLength}
+	defaultResponseFields = []LogField{FieldMethod, FieldPath, FieldStatus, FieldDuration}
+)
+
+// LoggerOptions holds configuration options for the Logger middleware.
 type LoggerOptions struct {
-	Logger InfoLogger
+	Logger        InfoLogger
+	ContextLogger bool
+	SingleRecord  bool
+	Fields        []LogField
+	Skip          []func(r *http.Request) bool
+	StatusLevels  bool
+	SlowThreshold time.Duration
+	TraceKey      any
+	AccessLog     *AccessLog
+	BodyLog       *BodyLogOptions
 }
 
-// RecoverOption represents a functional option for configuring Recover middleware.
+// LoggerOption represents a functional option for configuring Logger middleware.
 type LoggerOption func(*LoggerOptions)
 
 // WithLogger sets a custom InfoLogger for the Logger middleware.
 // It allows integration with custom or structured loggers.
+// A nil logger disables slog records, for instance when only WithAccessLog is wanted.
 func WithLogger(l InfoLogger) LoggerOption {
 	return func(opt *LoggerOptions) {
 		opt.Logger = l
 	}
 }
 
-type responseWriter struct {
-	http.ResponseWriter
-	statusCode int
+// WithContextLogger makes the Logger middleware store a request-scoped logger
+// carrying the request method, path and route pattern in the request context.
+// The logger is derived from logger.FromContext, so it also carries the trace ID
+// when Tracer runs first with WithTracerContextLogger.
+func WithContextLogger() LoggerOption {
+	return func(opt *LoggerOptions) {
+		opt.ContextLogger = true
+	}
+}
+
+// WithSingleRecord makes the Logger middleware emit a single "request completed"
+// record instead of one record when the request arrives and one when it completes.
+func WithSingleRecord() LoggerOption {
+	return func(opt *LoggerOptions) {
+		opt.SingleRecord = true
+	}
+}
+
+// WithFields selects the fields logged by the Logger middleware. The completion
+// record contains every selected field, the incoming record only those known
+// before the request is served.
+func WithFields(fields ...LogField) LoggerOption {
+	return func(opt *LoggerOptions) {
+		opt.Fields = fields
+	}
+}
+
+// WithSkipPaths disables logging for requests whose path exactly matches
+// one of paths, such as health checks.
+func WithSkipPaths(paths ...string) LoggerOption {
+	return WithSkip(func(r *http.Request) bool {
+		return slices.Contains(paths, r.URL.Path)
+	})
+}
+
+// WithSkip disables logging for requests matching the predicate f.
+// It can be used multiple times; a request is skipped if any predicate matches.
+func WithSkip(f func(r *http.Request) bool) LoggerOption {
+	return func(opt *LoggerOptions) {
+		opt.Skip = append(opt.Skip, f)
+	}
+}
+
+// WithStatusLevels logs completed requests with a 5xx status at error level
+// and with a 4xx status at warn level. It requires a logger implementing LevelLogger.
+func WithStatusLevels() LoggerOption {
+	return func(opt *LoggerOptions) {
+		opt.StatusLevels = true
+	}
+}
+
+// WithSlowThreshold logs completed requests lasting at least d at warn level
+// (or above) with a "slow" attribute. It requires a logger implementing LevelLogger.
+func WithSlowThreshold(d time.Duration) LoggerOption {
+	return func(opt *LoggerOptions) {
+		opt.SlowThreshold = d
+	}
 }
 
-func (rw *responseWriter) WriteHeader(code int) {
-	rw.statusCode = code
-	rw.ResponseWriter.WriteHeader(code)
+// WithLoggerTraceKey sets the context key from which the Logger middleware reads
+// the trace ID logged by FieldTraceID. It should match the Tracer key.
+func WithLoggerTraceKey(key any) LoggerOption {
+	return func(opt *LoggerOptions) {
+		opt.TraceKey = key
+	}
+}
+
+// WithAccessLog makes the Logger middleware write a line per completed request
+// to al, independently of the InfoLogger records.
+func WithAccessLog(al *AccessLog) LoggerOption {
+	return func(opt *LoggerOptions) {
+		opt.AccessLog = al
+	}
 }
 
 // Logger returns an HTTP middleware that logs each incoming request
-// and its corresponding response. It logs request method, path, query,
+// and its corresponding response. By default it logs request method, path, query,
 // client IP, user agent, content length, response status, and duration.
+// The client IP is the one resolved by the RealIP middleware, if it runs first,
+// or the connection remote address.
 //
 // Example usage:
 //
-//	http.Handle("/path", Logger(logger)(yourHandler))
+//	http.Handle("/path", Logger(WithLogger(logger))(yourHandler))
 //
 // The logger must implement the InfoLogger interface, typically wrapping
-// a structured logger such as slog.Logger.
+// a structured logger such as slog.Logger. Fields, skipped requests and levels
+// can be customized with options such as WithFields, WithSkipPaths and WithStatusLevels.
 func Logger(opts ...LoggerOption) func(http.Handler) http.Handler {
 	options := &LoggerOptions{
-		Logger: slog.Default(),
+		Logger:   slog.Default(),
+		TraceKey: "traceUUID",
 	}
 
 	for _, opt := range opts {
 		opt(options)
 	}
 
+	requestLogFields, responseLogFields := options.fields()
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			start := time.Now()
-			rw := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+			if options.skip(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// The body wrappers are set on a shallow copy, passed down the chain,
+			// leaving the request of the previous middlewares untouched.
+			r = r.WithContext(r.Context())
+			e := &accessEntry{start: time.Now()}
+
+			var respBody io.Writer
 
-			ip := r.Header.Get("X-Real-IP")
-			if ip == "" {
-				ip, _, _ = net.SplitHostPort(r.RemoteAddr)
+			if options.Logger != nil && options.BodyLog != nil && options.BodyLog.sample() {
+				if options.BodyLog.Request && r.Body != nil {
+					e.reqBody = &limitedBuffer{max: options.BodyLog.MaxSize}
+					r.Body = &teeReadCloser{ReadCloser: r.Body, w: e.reqBody}
+				}
+
+				if options.BodyLog.Response {
+					e.respBody = &limitedBuffer{max: options.BodyLog.MaxSize}
+					respBody = e.respBody
+				}
+			}
+
+			e.rec = newResponseRecorder(w, respBody)
+
+			e.ip = ClientIP(r)
+
+			if id, ok := r.Context().Value(options.TraceKey).(string); ok {
+				e.traceID = id
+			}
+
+			if r.Body != nil && (options.AccessLog != nil || slices.Contains(responseLogFields, FieldRequestBytes)) {
+				e.body = &countingReader{ReadCloser: r.Body}
+				r.Body = e.body
 			}
 
-			options.Logger.InfoContext(r.Context(), "incoming request",
-				slog.String("method", r.Method),
-				slog.String("path", r.URL.Path),
-				slog.String("query", r.URL.RawQuery),
-				slog.String("ip", ip),
-				slog.String("userAgent", r.UserAgent()),
-				slog.Int64("contentLength", r.ContentLength),
-			)
-
-			next.ServeHTTP(rw, r)
-
-			options.Logger.InfoContext(r.Context(), "request completed",
-				slog.String("method", r.Method),
-				slog.String("path", r.URL.Path),
-				slog.Int("status", rw.statusCode),
-				slog.Duration("duration", time.Since(start)),
-			)
+			if options.ContextLogger {
+				r = r.WithContext(logger.IntoContext(r.Context(), requestLogger(r)))
+			}
+
+			e.r = r
+
+			if options.Logger != nil && !options.SingleRecord {
+				options.log(r.Context(), slog.LevelInfo, "incoming request", e.attrs(requestLogFields)...)
+			}
+
+			next.ServeHTTP(e.rec, r)
+
+			e.duration = time.Since(e.start)
+
+			if options.Logger != nil {
+				level, attrs := options.level(e), e.attrs(responseLogFields)
+				if options.SlowThreshold > 0 && e.duration >= options.SlowThreshold {
+					attrs = append(attrs, slog.Bool("slow", true))
+				}
+
+				if options.BodyLog != nil {
+					attrs = append(attrs, options.BodyLog.attrs("requestBody", e.reqBody, r.Header.Get("Content-Type"))...)
+					attrs = append(attrs, options.BodyLog.attrs("responseBody", e.respBody, e.rec.Header().Get("Content-Type"))...)
+				}
+
+				options.log(r.Context(), level, "request completed", attrs...)
+			}
+
+			if options.AccessLog != nil {
+				options.AccessLog.log(e)
+			}
 		})
 	}
 }
+
+// fields returns the fields of the incoming and completion records.
+func (o *LoggerOptions) fields() ([]LogField, []LogField) {
+	switch {
+	case o.Fields != nil:
+		var req []LogField
+
+		for _, f := range o.Fields {
+			if slices.Contains(requestFields, f) {
+				req = append(req, f)
+			}
+		}
+
+		return req, o.Fields
+	case o.SingleRecord:
+		return defaultRequestFields, append(slices.Clip(defaultRequestFields), FieldStatus, FieldDuration)
+	default:
+		return defaultRequestFields, defaultResponseFields
+	}
+}
+
+func (o *LoggerOptions) skip(r *http.Request) bool {
+	for _, f := range o.Skip {
+		if f(r) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// level returns the level of the completion record of e.
+func (o *LoggerOptions) level(e *accessEntry) slog.Level {
+	level := slog.LevelInfo
+
+	if o.StatusLevels {
+		switch status := e.rec.Status(); {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+	}
+
+	if o.SlowThreshold > 0 && e.duration >= o.SlowThreshold {
+		level = max(level, slog.LevelWarn)
+	}
+
+	return level
+}
+
+// log emits a record at level if the logger supports it, at info level otherwise.
+func (o *LoggerOptions) log(ctx context.Context, level slog.Level, msg string, args ...any) {
+	if ll, ok := o.Logger.(LevelLogger); ok && level != slog.LevelInfo {
+		ll.Log(ctx, level, msg, args...)
+		return
+	}
+
+	o.Logger.InfoContext(ctx, msg, args...)
+}
+
+// accessEntry collects what is known about a request served by the Logger middleware.
+type accessEntry struct {
+	r        *http.Request
+	rec      ResponseRecorder
+	body     *countingReader
+	reqBody  *limitedBuffer
+	respBody *limitedBuffer
+	ip       string
+	traceID  string
+	start    time.Time
+	duration time.Duration
+}
+
+// attrs returns the slog attributes of the given fields, as a slice of any
+// ready to be passed to InfoContext.
+func (e *accessEntry) attrs(fields []LogField) []any {
+	attrs := make([]any, 0, len(fields))
+	for _, f := range fields {
+		attrs = append(attrs, e.attr(f))
+	}
+
+	return attrs
+}
+
+func (e *accessEntry) attr(f LogField) slog.Attr {
+	key := string(f)
+
+	switch f {
+	case FieldMethod:
+		return slog.String(key, e.r.Method)
+	case FieldPath:
+		return slog.String(key, e.r.URL.Path)
+	case FieldQuery:
+		return slog.String(key, e.r.URL.RawQuery)
+	case FieldIP:
+		return slog.String(key, e.ip)
+	case FieldUserAgent:
+		return slog.String(key, e.r.UserAgent())
+	case FieldContentLength:
+		return slog.Int64(key, e.r.ContentLength)
+	case FieldProto:
+		return slog.String(key, e.r.Proto)
+	case FieldReferer:
+		return slog.String(key, e.r.Referer())
+	case FieldTraceID:
+		return slog.String(key, e.traceID)
+	case FieldRoute:
+		return slog.String(key, e.r.Pattern)
+	case FieldStatus:
+		return slog.Int(key, e.rec.Status())
+	case FieldDuration:
+		return slog.Duration(key, e.duration)
+	case FieldRequestBytes:
+		return slog.Int64(key, e.requestBytes())
+	case FieldResponseBytes:
+		return slog.Int64(key, e.rec.BytesWritten())
+	case FieldTTFB:
+		var ttfb time.Duration
+		if t := e.rec.FirstByteTime(); !t.IsZero() {
+			ttfb = t.Sub(e.start)
+		}
+
+		return slog.Duration(key, ttfb)
+	case FieldCache:
+		return slog.String(key, e.rec.Header().Get(CacheStatusHeader))
+	default:
+		return slog.Any(key, nil)
+	}
+}
+
+// requestBytes returns the number of request body bytes read by the handler.
+func (e *accessEntry) requestBytes() int64 {
+	if e.body == nil {
+		return 0
+	}
+
+	return e.body.n
+}
+
+// countingReader counts the bytes read from the wrapped body.
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+
+	return n, err
+}
+
+// requestLogger derives a logger from the request context enriched with
+// the request method, path and, when already matched, route pattern.
+func requestLogger(r *http.Request) *slog.Logger {
+	attrs := []any{
+		slog.String("method", r.Method),
+		slog.String("path", r.URL.Path),
+	}
+
+	if r.Pattern != "" {
+		attrs = append(attrs, slog.String("route", r.Pattern))
+	}
+
+	return logger.FromContext(r.Context()).With(attrs...)
+}
+
+// traceAttrs returns the trace ID attribute to log with l, as key-value pairs
+// ready to be passed to InfoContext and the like. It returns nothing when l is
+// backed by a logger.TraceHandler and ctx carries a trace ID under
+// logger.TraceIDKey: the handler already injects it, and the attribute would
+// be duplicated.
+func traceAttrs(ctx context.Context, l any, traceID string) []any {
+	if hl, ok := l.(interface{ Handler() slog.Handler }); ok {
+		if _, ok := hl.Handler().(*logger.TraceHandler); ok {
+			if _, ok := ctx.Value(logger.TraceIDKey).(string); ok {
+				return nil
+			}
+		}
+	}
+
+	return []any{"traceUUID", traceID}
+}
@@ -11,6 +11,7 @@ package middleware_test
 
 import (
 	context "context"
+	slog "log/slog"
 	reflect "reflect"
 
 	gomock "go.uber.org/mock/gomock"
@@ -56,3 +57,44 @@ func (mr *MockInfoLoggerMockRecorder) InfoContext(ctx, msg any, args ...any) *go
 	varargs := append([]any{ctx, msg}, args...)
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InfoContext", reflect.TypeOf((*MockInfoLogger)(nil).InfoContext), varargs...)
 }
+
+// MockLevelLogger is a mock of LevelLogger interface.
+type MockLevelLogger struct {
+	ctrl     *gomock.Controller
+	recorder *MockLevelLoggerMockRecorder
+	isgomock struct{}
+}
+
+// MockLevelLoggerMockRecorder is the mock recorder for MockLevelLogger.
+type MockLevelLoggerMockRecorder struct {
+	mock *MockLevelLogger
+}
+
+// NewMockLevelLogger creates a new mock instance.
+func NewMockLevelLogger(ctrl *gomock.Controller) *MockLevelLogger {
+	mock := &MockLevelLogger{ctrl: ctrl}
+	mock.recorder = &MockLevelLoggerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockLevelLogger) EXPECT() *MockLevelLoggerMockRecorder {
+	return m.recorder
+}
+
+// Log mocks base method.
+func (m *MockLevelLogger) Log(ctx context.Context, level slog.Level, msg string, args ...any) {
+	m.ctrl.T.Helper()
+	varargs := []any{ctx, level, msg}
+	for _, a := range args {
+		varargs = append(varargs, a)
+	}
+	m.ctrl.Call(m, "Log", varargs...)
+}
+
+// Log indicates an expected call of Log.
+func (mr *MockLevelLoggerMockRecorder) Log(ctx, level, msg any, args ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{ctx, level, msg}, args...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Log", reflect.TypeOf((*MockLevelLogger)(nil).Log), varargs...)
+}
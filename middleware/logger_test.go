@@ -1,13 +1,21 @@
 package middleware_test
 
 import (
+	"bytes"
+	"context"
+	"io"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/paccolamano/goshare/logger"
 	"github.com/paccolamano/goshare/middleware"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/mock/gomock"
 )
 
@@ -59,7 +67,8 @@ func TestLoggerMiddleware(t *testing.T) {
 
 	w := httptest.NewRecorder()
 
-	middleware.Logger(middleware.WithLogger(l))(handler).ServeHTTP(w, req)
+	trusted := middleware.WithTrustedProxies(netip.MustParsePrefix("192.0.2.0/24"))
+	middleware.RealIP(trusted)(middleware.Logger(middleware.WithLogger(l))(handler)).ServeHTTP(w, req)
 
 	resp := w.Result()
 	body := w.Body.String()
@@ -68,3 +77,178 @@ func TestLoggerMiddleware(t *testing.T) {
 	assert.Equal(t, "I'm a teapot", body)
 	assert.True(t, called)
 }
+
+func TestLoggerContextLogger(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	l := NewMockInfoLogger(ctrl)
+	l.EXPECT().InfoContext(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+
+	buf := &bytes.Buffer{}
+	base := slog.New(slog.NewTextHandler(buf, nil))
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger.FromContext(r.Context()).Info("handled")
+
+		w.WriteHeader(http.StatusOK)
+	})
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /items/{id}", middleware.Logger(
+		middleware.WithLogger(l),
+		middleware.WithContextLogger(),
+	)(handler))
+
+	req := httptest.NewRequest(http.MethodGet, "/items/42", nil)
+	req = req.WithContext(logger.IntoContext(req.Context(), base))
+	w := httptest.NewRecorder()
+
+	mux.ServeHTTP(w, req)
+
+	out := buf.String()
+	require.Contains(t, out, "method=GET")
+	require.Contains(t, out, "path=/items/42")
+	require.Contains(t, out, `route="GET /items/{id}"`)
+}
+
+type traceKey struct{}
+
+func TestLoggerSingleRecordWithFields(t *testing.T) {
+	t.Parallel()
+
+	buf := &bytes.Buffer{}
+	l := slog.New(slog.NewJSONHandler(buf, nil))
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.ReadAll(r.Body)
+
+		_, err := w.Write([]byte("created"))
+		require.NoError(t, err)
+	})
+
+	mux := http.NewServeMux()
+	mux.Handle("POST /items", handler)
+
+	req := httptest.NewRequest(http.MethodPost, "/items", strings.NewReader("payload"))
+	req.Header.Set("Referer", "https://example.com")
+	req = req.WithContext(context.WithValue(req.Context(), traceKey{}, "abc123"))
+
+	middleware.Logger(
+		middleware.WithLogger(l),
+		middleware.WithSingleRecord(),
+		middleware.WithLoggerTraceKey(traceKey{}),
+		middleware.WithFields(
+			middleware.FieldRoute,
+			middleware.FieldProto,
+			middleware.FieldReferer,
+			middleware.FieldRequestBytes,
+			middleware.FieldResponseBytes,
+			middleware.FieldTraceID,
+			middleware.FieldTTFB,
+		),
+	)(mux).ServeHTTP(httptest.NewRecorder(), req)
+
+	out := buf.String()
+	require.Equal(t, 1, strings.Count(out, "\n"))
+	require.Contains(t, out, `"msg":"request completed"`)
+	require.Contains(t, out, `"route":"POST /items"`)
+	require.Contains(t, out, `"proto":"HTTP/1.1"`)
+	require.Contains(t, out, `"referer":"https://example.com"`)
+	require.Contains(t, out, `"requestBytes":7`)
+	require.Contains(t, out, `"responseBytes":7`)
+	require.Contains(t, out, `"traceUUID":"abc123"`)
+	require.Contains(t, out, `"ttfb":`)
+}
+
+func TestLoggerSkip(t *testing.T) {
+	t.Parallel()
+
+	buf := &bytes.Buffer{}
+	l := slog.New(slog.NewJSONHandler(buf, nil))
+
+	mw := middleware.Logger(
+		middleware.WithLogger(l),
+		middleware.WithSkipPaths("/healthz"),
+		middleware.WithSkip(func(r *http.Request) bool {
+			return strings.HasPrefix(r.URL.Path, "/static/")
+		}),
+	)
+	handler := mw(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	for _, path := range []string{"/healthz", "/static/app.js"} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		require.Equal(t, http.StatusNoContent, w.Code)
+	}
+
+	require.Empty(t, buf.String())
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api", nil))
+	require.NotEmpty(t, buf.String())
+}
+
+func TestLoggerLevels(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name     string
+		status   int
+		sleep    time.Duration
+		expected string
+	}{
+		{"success", http.StatusOK, 0, `"level":"INFO"`},
+		{"client error", http.StatusNotFound, 0, `"level":"WARN"`},
+		{"server error", http.StatusBadGateway, 0, `"level":"ERROR"`},
+		{"slow", http.StatusOK, 20 * time.Millisecond, `"level":"WARN"`},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			buf := &bytes.Buffer{}
+			l := slog.New(slog.NewJSONHandler(buf, nil))
+
+			handler := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				time.Sleep(tc.sleep)
+				w.WriteHeader(tc.status)
+			})
+
+			middleware.Logger(
+				middleware.WithLogger(l),
+				middleware.WithSingleRecord(),
+				middleware.WithStatusLevels(),
+				middleware.WithSlowThreshold(10*time.Millisecond),
+			)(handler).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+			out := buf.String()
+			require.Contains(t, out, tc.expected)
+			require.Equal(t, tc.sleep > 0, strings.Contains(out, `"slow":true`))
+		})
+	}
+}
+
+func TestLoggerKeepsCallerRequest(t *testing.T) {
+	t.Parallel()
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("payload"))
+	body := req.Body
+
+	var seen io.ReadCloser
+
+	middleware.Logger(
+		middleware.WithLogger(slog.New(slog.DiscardHandler)),
+		middleware.WithFields(middleware.FieldRequestBytes),
+		middleware.WithBodyLogging(),
+	)(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		seen = r.Body
+	})).ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.True(t, seen != body, "the handler should read a wrapped body")
+	assert.True(t, req.Body == body, "the caller request should keep its body")
+}
@@ -0,0 +1,314 @@
+package middleware
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MetricsContentType is the media type of the Prometheus text exposition format.
+const MetricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+var (
+	// DefaultDurationBuckets are the default request duration histogram buckets, in seconds.
+	DefaultDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+	// DefaultSizeBuckets are the default response size histogram buckets, in bytes.
+	DefaultSizeBuckets = []float64{100, 1000, 10_000, 100_000, 1_000_000, 10_000_000}
+)
+
+// knownMethods are the methods used as label values; others are labeled "OTHER"
+// to bound the number of series.
+var knownMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+	http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace,
+}
+
+// MetricsOptions holds configuration options for Metrics.
+type MetricsOptions struct {
+	Namespace       string
+	DurationBuckets []float64
+	SizeBuckets     []float64
+}
+
+// MetricsOption represents a functional option for configuring Metrics.
+type MetricsOption func(*MetricsOptions)
+
+// WithMetricsNamespace prefixes metric names with namespace and an underscore.
+func WithMetricsNamespace(namespace string) MetricsOption {
+	return func(opt *MetricsOptions) {
+		opt.Namespace = namespace
+	}
+}
+
+// WithDurationBuckets sets the upper bounds, in seconds, of the request duration histogram.
+func WithDurationBuckets(buckets ...float64) MetricsOption {
+	return func(opt *MetricsOptions) {
+		opt.DurationBuckets = buckets
+	}
+}
+
+// WithSizeBuckets sets the upper bounds, in bytes, of the response size histogram.
+func WithSizeBuckets(buckets ...float64) MetricsOption {
+	return func(opt *MetricsOptions) {
+		opt.SizeBuckets = buckets
+	}
+}
+
+// Metrics records HTTP request metrics and serves them in the Prometheus
+// text exposition format. It is safe for concurrent use.
+//
+// The following metrics are recorded, labeled by method, route pattern and status class:
+//   - http_requests_total: counter of completed requests.
+//   - http_request_duration_seconds: histogram of request durations.
+//   - http_response_size_bytes: histogram of response body sizes.
+//
+// Besides, http_requests_in_flight is a gauge of the requests being served.
+type Metrics struct {
+	options  *MetricsOptions
+	inFlight atomic.Int64
+
+	mu     sync.Mutex
+	series map[metricsKey]*metricsSeries
+}
+
+type metricsKey struct {
+	method      string
+	route       string
+	statusClass string
+}
+
+type metricsSeries struct {
+	count    uint64
+	duration *histogram
+	size     *histogram
+}
+
+// NewMetrics creates a Metrics collector.
+//
+// Example usage:
+//
+//	m := NewMetrics()
+//	mux.Handle("GET /metrics", m)
+//	http.ListenAndServe(":8080", m.Middleware(mux))
+func NewMetrics(opts ...MetricsOption) *Metrics {
+	options := &MetricsOptions{
+		DurationBuckets: DefaultDurationBuckets,
+		SizeBuckets:     DefaultSizeBuckets,
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	options.DurationBuckets = sortedBuckets(options.DurationBuckets)
+	options.SizeBuckets = sortedBuckets(options.SizeBuckets)
+
+	return &Metrics{options: options, series: make(map[metricsKey]*metricsSeries)}
+}
+
+// metricsRouteKey is the context key of the route pattern reported by Metrics.Routes.
+type metricsRouteKey struct{}
+
+// Middleware records the metrics of the requests served by next.
+//
+// The route label is the pattern matched by http.ServeMux, read from the request
+// once served. Middlewares replacing the request with r.WithContext between this
+// one and the ServeMux, such as those of Default, hide the pattern from it: wrap
+// the ServeMux with Routes to report the pattern through the request context.
+// Unmatched requests are labeled with an empty route.
+//
+// Example usage:
+//
+//	http.ListenAndServe(":8080", m.Middleware(Default().Then(m.Routes(mux))))
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := NewResponseRecorder(w)
+		route := new(atomic.Pointer[string])
+		r = r.WithContext(context.WithValue(r.Context(), metricsRouteKey{}, route))
+
+		m.inFlight.Add(1)
+		defer m.inFlight.Add(-1)
+
+		next.ServeHTTP(rec, r)
+
+		pattern := r.Pattern
+		if p := route.Load(); pattern == "" && p != nil {
+			pattern = *p
+		}
+
+		m.observe(metricsKey{
+			method:      metricsMethod(r.Method),
+			route:       pattern,
+			statusClass: strconv.Itoa(rec.Status()/100) + "xx",
+		}, time.Since(start), rec.BytesWritten())
+	})
+}
+
+// Routes wraps mux, the http.ServeMux routing the requests measured by Middleware,
+// reporting the pattern it matches to Middleware through the request context.
+// It is needed when middlewares between them replace the request with r.WithContext.
+func (m *Metrics) Routes(mux http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// http.ServeMux sets the pattern on the request it is given.
+		defer func() {
+			if route, ok := r.Context().Value(metricsRouteKey{}).(*atomic.Pointer[string]); ok && r.Pattern != "" {
+				pattern := r.Pattern
+				route.Store(&pattern)
+			}
+		}()
+
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// ServeHTTP writes the recorded metrics in the Prometheus text exposition format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", MetricsContentType)
+	_, _ = w.Write(m.expose())
+}
+
+func (m *Metrics) observe(key metricsKey, duration time.Duration, size int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.series[key]
+	if !ok {
+		s = &metricsSeries{
+			duration: newHistogram(m.options.DurationBuckets),
+			size:     newHistogram(m.options.SizeBuckets),
+		}
+		m.series[key] = s
+	}
+
+	s.count++
+	s.duration.observe(duration.Seconds())
+	s.size.observe(float64(size))
+}
+
+func (m *Metrics) expose() []byte {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := make([]metricsKey, 0, len(m.series))
+	for k := range m.series {
+		keys = append(keys, k)
+	}
+
+	slices.SortFunc(keys, func(a, b metricsKey) int {
+		return cmp.Or(cmp.Compare(a.method, b.method), cmp.Compare(a.route, b.route), cmp.Compare(a.statusClass, b.statusClass))
+	})
+
+	var buf bytes.Buffer
+
+	name := m.name("http_requests_total")
+	writeMetricHeader(&buf, name, "Total number of HTTP requests.", "counter")
+
+	for _, k := range keys {
+		fmt.Fprintf(&buf, "%s{%s} %d\n", name, k.labels(), m.series[k].count)
+	}
+
+	name = m.name("http_requests_in_flight")
+	writeMetricHeader(&buf, name, "Number of HTTP requests being served.", "gauge")
+	fmt.Fprintf(&buf, "%s %d\n", name, m.inFlight.Load())
+
+	name = m.name("http_request_duration_seconds")
+	writeMetricHeader(&buf, name, "Duration of HTTP requests in seconds.", "histogram")
+
+	for _, k := range keys {
+		m.series[k].duration.write(&buf, name, k.labels())
+	}
+
+	name = m.name("http_response_size_bytes")
+	writeMetricHeader(&buf, name, "Size of HTTP response bodies in bytes.", "histogram")
+
+	for _, k := range keys {
+		m.series[k].size.write(&buf, name, k.labels())
+	}
+
+	return buf.Bytes()
+}
+
+func (m *Metrics) name(name string) string {
+	if m.options.Namespace == "" {
+		return name
+	}
+
+	return m.options.Namespace + "_" + name
+}
+
+func (k metricsKey) labels() string {
+	return fmt.Sprintf(`method="%s",route="%s",status_class="%s"`,
+		escapeLabel(k.method), escapeLabel(k.route), escapeLabel(k.statusClass))
+}
+
+// histogram is a Prometheus style histogram with cumulative buckets.
+type histogram struct {
+	bounds []float64
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds))}
+}
+
+func (h *histogram) observe(v float64) {
+	if i, _ := slices.BinarySearch(h.bounds, v); i < len(h.counts) {
+		h.counts[i]++
+	}
+
+	h.sum += v
+	h.count++
+}
+
+func (h *histogram) write(buf *bytes.Buffer, name, labels string) {
+	var cumulative uint64
+
+	for i, bound := range h.bounds {
+		cumulative += h.counts[i]
+		fmt.Fprintf(buf, "%s_bucket{%s,le=\"%s\"} %d\n", name, labels, formatFloat(bound), cumulative)
+	}
+
+	fmt.Fprintf(buf, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, h.count)
+	fmt.Fprintf(buf, "%s_sum{%s} %s\n", name, labels, formatFloat(h.sum))
+	fmt.Fprintf(buf, "%s_count{%s} %d\n", name, labels, h.count)
+}
+
+func writeMetricHeader(buf *bytes.Buffer, name, help, kind string) {
+	fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func metricsMethod(method string) string {
+	if slices.Contains(knownMethods, method) {
+		return method
+	}
+
+	return "OTHER"
+}
+
+func sortedBuckets(buckets []float64) []float64 {
+	sorted := slices.Clone(buckets)
+	slices.Sort(sorted)
+
+	return slices.Compact(sorted)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var labelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelReplacer.Replace(v)
+}
@@ -0,0 +1,144 @@
+package middleware_test
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/paccolamano/goshare/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func scrape(t *testing.T, m *middleware.Metrics) string {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, middleware.MetricsContentType, w.Header().Get("Content-Type"))
+
+	return w.Body.String()
+}
+
+func TestMetrics(t *testing.T) {
+	t.Parallel()
+
+	m := middleware.NewMetrics(middleware.WithSizeBuckets(10, 1), middleware.WithDurationBuckets(60))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /items/{id}", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, "hello")
+	})
+	mux.HandleFunc("POST /items", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = io.WriteString(w, "bad request body")
+	})
+
+	handler := m.Middleware(mux)
+
+	for _, path := range []string{"/items/1", "/items/2"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/items", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("PURGE", "/missing", nil))
+
+	out := scrape(t, m)
+
+	get := `method="GET",route="GET /items/{id}",status_class="2xx"`
+	post := `method="POST",route="POST /items",status_class="4xx"`
+
+	assert.Contains(t, out, "# TYPE http_requests_total counter\n")
+	assert.Contains(t, out, "http_requests_total{"+get+"} 2\n")
+	assert.Contains(t, out, "http_requests_total{"+post+"} 1\n")
+	assert.Contains(t, out, `http_requests_total{method="OTHER",route="",status_class="4xx"} 1`+"\n")
+	assert.Contains(t, out, "http_requests_in_flight 0\n")
+
+	assert.Contains(t, out, "http_request_duration_seconds_bucket{"+get+",le=\"60\"} 2\n")
+	assert.Contains(t, out, "http_request_duration_seconds_count{"+get+"} 2\n")
+
+	assert.Contains(t, out, "http_response_size_bytes_bucket{"+get+",le=\"1\"} 0\n")
+	assert.Contains(t, out, "http_response_size_bytes_bucket{"+get+",le=\"10\"} 2\n")
+	assert.Contains(t, out, "http_response_size_bytes_bucket{"+get+",le=\"+Inf\"} 2\n")
+	assert.Contains(t, out, "http_response_size_bytes_sum{"+get+"} 10\n")
+	assert.Contains(t, out, "http_response_size_bytes_bucket{"+post+",le=\"10\"} 0\n")
+	assert.Contains(t, out, "http_response_size_bytes_bucket{"+post+",le=\"+Inf\"} 1\n")
+
+	assert.Equal(t, out, scrape(t, m), "exposition should be deterministic")
+	assert.Less(t, strings.Index(out, `method="GET"`), strings.Index(out, `method="OTHER"`))
+}
+
+func TestMetricsOutsideDefault(t *testing.T) {
+	t.Parallel()
+
+	m := middleware.NewMetrics()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /items/{id}", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, "hello")
+	})
+
+	chain := middleware.Default(middleware.WithDefaultLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+
+	m.Middleware(chain.Then(m.Routes(mux))).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/items/1", nil))
+	m.Middleware(chain.Then(mux)).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/items/2", nil))
+
+	out := scrape(t, m)
+	assert.Contains(t, out, `http_requests_total{method="GET",route="GET /items/{id}",status_class="2xx"} 1`+"\n")
+	assert.Contains(t, out, `http_requests_total{method="GET",route="",status_class="2xx"} 1`+"\n",
+		"without Routes, the pattern is hidden by Default")
+}
+
+func TestMetricsInFlight(t *testing.T) {
+	t.Parallel()
+
+	m := middleware.NewMetrics(middleware.WithMetricsNamespace("app"))
+
+	var wg sync.WaitGroup
+
+	entered := make(chan struct{})
+	release := make(chan struct{})
+
+	handler := m.Middleware(http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+		entered <- struct{}{}
+		<-release
+	}))
+
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}()
+
+	<-entered
+	assert.Contains(t, scrape(t, m), "app_http_requests_in_flight 1\n")
+
+	close(release)
+	wg.Wait()
+
+	out := scrape(t, m)
+	assert.Contains(t, out, "app_http_requests_in_flight 0\n")
+	assert.Contains(t, out, `app_http_requests_total{method="GET",route="",status_class="2xx"} 1`+"\n")
+}
+
+func TestMetricsLabelEscaping(t *testing.T) {
+	t.Parallel()
+
+	m := middleware.NewMetrics()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(`/say/"hi"\`, func(http.ResponseWriter, *http.Request) {})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.URL.Path = `/say/"hi"\`
+	m.Middleware(mux).ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Contains(t, scrape(t, m), `route="/say/\"hi\"\\"`)
+}
@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+)
+
+// ProblemContentType is the media type of RFC 9457 problem details responses.
+const ProblemContentType = "application/problem+json"
+
+// Problem is an RFC 9457 problem details object.
+// Extensions are serialized as additional top-level members.
+type Problem struct {
+	Type       string
+	Title      string
+	Status     int
+	Detail     string
+	Instance   string
+	TraceID    string
+	Extensions map[string]any
+}
+
+// NewProblem returns a Problem for the given status, with type "about:blank"
+// and the standard status text as title.
+func NewProblem(status int) *Problem {
+	return &Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+	}
+}
+
+// MarshalJSON encodes p as a problem details JSON object.
+func (p *Problem) MarshalJSON() ([]byte, error) {
+	m := make(map[string]any, len(p.Extensions)+6)
+	maps.Copy(m, p.Extensions)
+
+	for k, v := range map[string]string{
+		"type":     p.Type,
+		"title":    p.Title,
+		"detail":   p.Detail,
+		"instance": p.Instance,
+		"traceId":  p.TraceID,
+	} {
+		if v != "" {
+			m[k] = v
+		}
+	}
+
+	if p.Status != 0 {
+		m["status"] = p.Status
+	}
+
+	return json.Marshal(m)
+}
+
+// WriteProblem writes p as an application/problem+json response
+// with p.Status as status code.
+func WriteProblem(w http.ResponseWriter, p *Problem) {
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(p.Status)
+	_ = json.NewEncoder(w).Encode(p)
+}
+
+// requestTraceID returns the trace ID stored in the request context under key,
+// falling back to the X-Request-ID response header set by the Tracer middleware.
+func requestTraceID(w http.ResponseWriter, r *http.Request, key any) string {
+	if key != nil {
+		if id, ok := r.Context().Value(key).(string); ok {
+			return id
+		}
+	}
+
+	return w.Header().Get("X-Request-ID")
+}
@@ -0,0 +1,378 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Limit is a rate limit of Requests per Period. Burst is the number of requests
+// allowed at once by the token bucket and GCRA algorithms; it defaults to Requests.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+	Burst    int
+}
+
+// burst returns the burst of l, defaulting to l.Requests.
+func (l Limit) burst() int {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+
+	return l.Requests
+}
+
+// interval returns the time between two requests at the sustained rate.
+func (l Limit) interval() time.Duration {
+	return l.Period / time.Duration(l.Requests)
+}
+
+// ttl returns how long the state of a key is relevant: the time needed
+// to fully recover the burst, and at least two periods for the sliding window.
+func (l Limit) ttl() time.Duration {
+	return max(2*l.Period, time.Duration(l.burst())*l.interval())
+}
+
+// RateLimitState is the state of a key, stored in a RateLimitStore.
+// Its meaning depends on the algorithm:
+//   - TokenBucket: Value is the number of tokens, refilled at Time.
+//   - SlidingWindow: Value and Prev are the counts of the window starting at Time and of the previous one.
+//   - GCRA: Time is the theoretical arrival time of the next request.
+type RateLimitState struct {
+	Time  time.Time
+	Value float64
+	Prev  float64
+}
+
+// RateLimitResult is the outcome of a rate limiting decision.
+type RateLimitResult struct {
+	// Allowed reports whether the request is allowed.
+	Allowed bool
+	// Remaining is the number of requests currently allowed.
+	Remaining int
+	// Reset is the time until the limit is fully available again.
+	Reset time.Duration
+	// RetryAfter is the time until the next request is allowed, when not Allowed.
+	RetryAfter time.Duration
+}
+
+// RateLimitAlgorithm decides whether a request at now is allowed under limit,
+// given the state of its key. It returns the updated state, found is false
+// for keys without stored state.
+type RateLimitAlgorithm func(state RateLimitState, found bool, limit Limit, now time.Time) (RateLimitState, RateLimitResult)
+
+// TokenBucket is a RateLimitAlgorithm holding up to Burst tokens per key,
+// refilled at Requests per Period. Each request consumes a token.
+func TokenBucket(state RateLimitState, found bool, limit Limit, now time.Time) (RateLimitState, RateLimitResult) {
+	capacity := float64(limit.burst())
+	rate := float64(limit.Requests) / limit.Period.Seconds()
+
+	tokens := capacity
+	if found {
+		tokens = min(capacity, state.Value+now.Sub(state.Time).Seconds()*rate)
+	}
+
+	var res RateLimitResult
+
+	if tokens >= 1 {
+		tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((1 - tokens) / rate)
+	}
+
+	res.Remaining = int(tokens)
+	res.Reset = seconds((capacity - tokens) / rate)
+
+	return RateLimitState{Time: now, Value: tokens}, res
+}
+
+// SlidingWindow is a RateLimitAlgorithm allowing Requests per Period, counted over
+// a window sliding over the current and previous fixed windows. The count of the
+// previous window is weighted by its overlap with the sliding window. Burst is ignored.
+func SlidingWindow(state RateLimitState, found bool, limit Limit, now time.Time) (RateLimitState, RateLimitResult) {
+	start := now.Truncate(limit.Period)
+
+	switch {
+	case !found || state.Time.Before(start.Add(-limit.Period)):
+		state = RateLimitState{Time: start}
+	case state.Time.Before(start):
+		state = RateLimitState{Time: start, Prev: state.Value}
+	}
+
+	elapsed := now.Sub(start)
+	requests := float64(limit.Requests)
+	weight := 1 - elapsed.Seconds()/limit.Period.Seconds()
+	count := state.Prev*weight + state.Value
+
+	var res RateLimitResult
+
+	if count+1 <= requests {
+		state.Value++
+		count++
+		res.Allowed = true
+	} else {
+		res.RetryAfter = slidingRetryAfter(state, limit, elapsed)
+	}
+
+	res.Remaining = max(0, int(requests-count))
+	switch {
+	case state.Value > 0:
+		res.Reset = 2*limit.Period - elapsed
+	case state.Prev > 0:
+		res.Reset = limit.Period - elapsed
+	}
+
+	return state, res
+}
+
+// slidingRetryAfter returns when the weighted count of the sliding window,
+// elapsed into the current window, allows one more request.
+func slidingRetryAfter(state RateLimitState, limit Limit, elapsed time.Duration) time.Duration {
+	allowed := float64(limit.Requests) - 1
+	period := limit.Period.Seconds()
+
+	if state.Value <= allowed {
+		// The previous window weight must drop to (allowed-current)/previous.
+		at := period * (1 - (allowed-state.Value)/state.Prev)
+		return seconds(at) - elapsed
+	}
+
+	// The current window becomes the previous one.
+	at := period * (2 - allowed/state.Value)
+
+	return seconds(at) - elapsed
+}
+
+// GCRA is a RateLimitAlgorithm implementing the generic cell rate algorithm:
+// requests are spaced by Period/Requests, tolerating bursts of Burst requests.
+func GCRA(state RateLimitState, found bool, limit Limit, now time.Time) (RateLimitState, RateLimitResult) {
+	interval := limit.interval()
+	tolerance := time.Duration(limit.burst()) * interval
+
+	tat := now
+	if found && state.Time.After(now) {
+		tat = state.Time
+	}
+
+	var res RateLimitResult
+
+	if next := tat.Add(interval); now.Before(next.Add(-tolerance)) {
+		res.RetryAfter = next.Add(-tolerance).Sub(now)
+	} else {
+		tat = next
+		res.Allowed = true
+	}
+
+	res.Remaining = int((tolerance - tat.Sub(now)) / interval)
+	res.Reset = tat.Sub(now)
+
+	return RateLimitState{Time: tat}, res
+}
+
+// seconds converts a number of seconds to a time.Duration.
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// RateLimitKeyFunc returns the key a request is limited by.
+type RateLimitKeyFunc func(r *http.Request) string
+
+// KeyByClientIP limits requests by client IP, as returned by ClientIP.
+func KeyByClientIP(r *http.Request) string {
+	return ClientIP(r)
+}
+
+// KeyByHeader limits requests by the value of the header name.
+func KeyByHeader(name string) RateLimitKeyFunc {
+	return func(r *http.Request) string {
+		return r.Header.Get(name)
+	}
+}
+
+// KeyByAPIKey limits requests by the API key held in the header name.
+// Keys are hashed, so that API keys are neither stored nor logged.
+func KeyByAPIKey(name string) RateLimitKeyFunc {
+	return func(r *http.Request) string {
+		key := r.Header.Get(name)
+		if key == "" {
+			return ""
+		}
+
+		sum := sha256.Sum256([]byte(key))
+
+		return "apikey:" + hex.EncodeToString(sum[:16])
+	}
+}
+
+// RateLimitOptions holds configuration options for the RateLimit middleware.
+type RateLimitOptions struct {
+	Limit     Limit
+	Algorithm RateLimitAlgorithm
+	Key       RateLimitKeyFunc
+	Store     RateLimitStore
+	Logger    InfoLogger
+	TraceKey  any
+}
+
+// RateLimitOption represents a functional option for configuring RateLimit middleware.
+type RateLimitOption func(*RateLimitOptions)
+
+// WithRateLimit allows requests per period for each key. Both must be positive.
+// The default is 100 per minute.
+func WithRateLimit(requests int, period time.Duration) RateLimitOption {
+	return func(opt *RateLimitOptions) {
+		opt.Limit.Requests = requests
+		opt.Limit.Period = period
+	}
+}
+
+// WithBurst sets the number of requests allowed at once by the TokenBucket
+// and GCRA algorithms. It defaults to the number of requests per period.
+func WithBurst(burst int) RateLimitOption {
+	return func(opt *RateLimitOptions) {
+		opt.Limit.Burst = burst
+	}
+}
+
+// WithRateLimitAlgorithm sets the algorithm, such as TokenBucket (the default),
+// SlidingWindow or GCRA.
+func WithRateLimitAlgorithm(a RateLimitAlgorithm) RateLimitOption {
+	return func(opt *RateLimitOptions) {
+		opt.Algorithm = a
+	}
+}
+
+// WithRateLimitKey sets the function returning the key requests are limited by,
+// such as KeyByClientIP (the default), KeyByHeader or KeyByAPIKey.
+// Requests with an empty key are limited by client IP.
+func WithRateLimitKey(f RateLimitKeyFunc) RateLimitOption {
+	return func(opt *RateLimitOptions) {
+		opt.Key = f
+	}
+}
+
+// WithRateLimitStore sets the store of the key states. The default is a
+// MemoryRateLimitStore, local to the middleware.
+func WithRateLimitStore(s RateLimitStore) RateLimitOption {
+	return func(opt *RateLimitOptions) {
+		opt.Store = s
+	}
+}
+
+// WithRateLimitLogger sets a custom InfoLogger logging rejected requests and store failures.
+func WithRateLimitLogger(l InfoLogger) RateLimitOption {
+	return func(opt *RateLimitOptions) {
+		opt.Logger = l
+	}
+}
+
+// WithRateLimitTraceKey sets the context key from which the RateLimit middleware
+// reads the trace ID. It should match the Tracer key.
+func WithRateLimitTraceKey(key any) RateLimitOption {
+	return func(opt *RateLimitOptions) {
+		opt.TraceKey = key
+	}
+}
+
+// RateLimit returns a middleware throttling requests per key.
+//
+// Responses carry the RateLimit-Policy, RateLimit-Limit, RateLimit-Remaining and
+// RateLimit-Reset headers. Rejected requests are logged and answered with a 429 Too
+// Many Requests problem response and a Retry-After header, in seconds.
+// If the store fails, the failure is logged and the request is allowed.
+//
+// Example usage:
+//
+//	http.Handle("/api/", RateLimit(WithRateLimit(10, time.Second),
+//		WithRateLimitAlgorithm(GCRA), WithRateLimitKey(KeyByAPIKey("X-Api-Key")))(apiHandler))
+//
+// Place RealIP before RateLimit when the server is behind proxies,
+// so that clients are not limited by proxy address. RateLimit panics if the
+// number of requests or the period is not positive, or the burst is negative.
+func RateLimit(opts ...RateLimitOption) func(http.Handler) http.Handler {
+	options := &RateLimitOptions{
+		Limit:     Limit{Requests: 100, Period: time.Minute},
+		Algorithm: TokenBucket,
+		Key:       KeyByClientIP,
+		Logger:    slog.Default(),
+		TraceKey:  "traceUUID",
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	if options.Limit.Requests <= 0 || options.Limit.Period <= 0 || options.Limit.Burst < 0 {
+		panic("middleware: RateLimit requires a positive number of requests and period")
+	}
+
+	if options.Store == nil {
+		options.Store = NewMemoryRateLimitStore()
+	}
+
+	limit := options.Limit
+	policy := strconv.Itoa(limit.Requests) + ";w=" + strconv.Itoa(int(math.Ceil(limit.Period.Seconds())))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			key := options.Key(r)
+			if key == "" {
+				key = ClientIP(r)
+			}
+
+			var res RateLimitResult
+
+			err := options.Store.Update(ctx, key, limit.ttl(), func(state RateLimitState, found bool) RateLimitState {
+				state, res = options.Algorithm(state, found, limit, time.Now())
+				return state
+			})
+			if err != nil {
+				options.Logger.InfoContext(ctx, "rate limit store failed", "error", err, "key", key)
+				next.ServeHTTP(w, r)
+
+				return
+			}
+
+			h := w.Header()
+			h.Set("RateLimit-Policy", policy)
+			h.Set("RateLimit-Limit", strconv.Itoa(limit.Requests))
+			h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			h.Set("RateLimit-Reset", ceilSeconds(res.Reset))
+
+			if res.Allowed {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			traceID := requestTraceID(w, r, options.TraceKey)
+			args := []any{
+				"key", key,
+				"method", r.Method,
+				"path", r.URL.Path,
+				"retryAfter", res.RetryAfter,
+			}
+			options.Logger.InfoContext(ctx, "request rate limited", append(args, traceAttrs(ctx, options.Logger, traceID)...)...)
+
+			h.Set("Retry-After", ceilSeconds(res.RetryAfter))
+
+			p := NewProblem(http.StatusTooManyRequests)
+			p.Instance = r.URL.Path
+			p.TraceID = traceID
+
+			WriteProblem(w, p)
+		})
+	}
+}
+
+// ceilSeconds formats d as a number of seconds, rounded up.
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(max(0, d.Seconds()))))
+}
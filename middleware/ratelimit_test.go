@@ -0,0 +1,236 @@
+package middleware_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/paccolamano/goshare/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+// runAlgorithm applies a to requests at the given offsets from a window start
+// and returns the results.
+func runAlgorithm(a middleware.RateLimitAlgorithm, limit middleware.Limit, offsets ...time.Duration) []middleware.RateLimitResult {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var (
+		state   middleware.RateLimitState
+		found   bool
+		results []middleware.RateLimitResult
+	)
+
+	for _, off := range offsets {
+		var res middleware.RateLimitResult
+
+		state, res = a(state, found, limit, start.Add(off))
+		found = true
+
+		results = append(results, res)
+	}
+
+	return results
+}
+
+func allowed(results []middleware.RateLimitResult) []bool {
+	out := make([]bool, len(results))
+	for i, r := range results {
+		out[i] = r.Allowed
+	}
+
+	return out
+}
+
+func TestTokenBucket(t *testing.T) {
+	t.Parallel()
+
+	limit := middleware.Limit{Requests: 2, Period: time.Second, Burst: 3}
+	res := runAlgorithm(middleware.TokenBucket, limit, 0, 0, 0, 0, 500*time.Millisecond, 500*time.Millisecond)
+
+	assert.Equal(t, []bool{true, true, true, false, true, false}, allowed(res))
+	assert.Equal(t, 2, res[0].Remaining)
+	assert.Equal(t, 500*time.Millisecond, res[0].Reset)
+	assert.Equal(t, 500*time.Millisecond, res[3].RetryAfter)
+	assert.Equal(t, 0, res[4].Remaining)
+	assert.Equal(t, 1500*time.Millisecond, res[4].Reset)
+}
+
+func TestSlidingWindow(t *testing.T) {
+	t.Parallel()
+
+	limit := middleware.Limit{Requests: 4, Period: time.Minute}
+	res := runAlgorithm(middleware.SlidingWindow, limit,
+		0, 10*time.Second, 20*time.Second, 30*time.Second, 40*time.Second,
+		75*time.Second, 80*time.Second, 90*time.Second)
+
+	assert.Equal(t, []bool{true, true, true, true, false, true, false, true}, allowed(res))
+	assert.Equal(t, 3, res[0].Remaining)
+	assert.Equal(t, 0, res[3].Remaining)
+	// The rejected request waits for the next window, where 4 previous requests
+	// must weigh 3: 15 seconds into it.
+	assert.Equal(t, 35*time.Second, res[4].RetryAfter)
+	// At 80s the previous window weighs 4*2/3, plus 1 current request: it must
+	// weigh 2, 30 seconds into the window.
+	assert.Equal(t, 10*time.Second, res[6].RetryAfter)
+	assert.Equal(t, 90*time.Second, res[7].Reset)
+}
+
+func TestGCRA(t *testing.T) {
+	t.Parallel()
+
+	limit := middleware.Limit{Requests: 10, Period: time.Second, Burst: 2}
+	res := runAlgorithm(middleware.GCRA, limit, 0, 0, 0, 100*time.Millisecond, 150*time.Millisecond, 400*time.Millisecond)
+
+	assert.Equal(t, []bool{true, true, false, true, false, true}, allowed(res))
+	assert.Equal(t, 1, res[0].Remaining)
+	assert.Equal(t, 0, res[1].Remaining)
+	assert.Equal(t, 200*time.Millisecond, res[1].Reset)
+	assert.Equal(t, 100*time.Millisecond, res[2].RetryAfter)
+	assert.Equal(t, 50*time.Millisecond, res[4].RetryAfter)
+	assert.Equal(t, 1, res[5].Remaining)
+}
+
+func TestRateLimitKeys(t *testing.T) {
+	t.Parallel()
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.Header.Set("X-Tenant", "acme")
+	req.Header.Set("X-Api-Key", "secret")
+
+	assert.Equal(t, "192.0.2.1", middleware.KeyByClientIP(req))
+	assert.Equal(t, "acme", middleware.KeyByHeader("X-Tenant")(req))
+
+	key := middleware.KeyByAPIKey("X-Api-Key")(req)
+	assert.True(t, strings.HasPrefix(key, "apikey:"))
+	assert.NotContains(t, key, "secret")
+	assert.Empty(t, middleware.KeyByAPIKey("X-Other")(req))
+}
+
+func TestRateLimit(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	l := NewMockInfoLogger(ctrl)
+	l.EXPECT().
+		InfoContext(gomock.Any(), "request rate limited",
+			"key", "acme",
+			"method", http.MethodGet,
+			"path", "/api",
+			"retryAfter", gomock.Any(),
+			"traceUUID", "trace-1",
+		).
+		Times(1)
+
+	mw := middleware.RateLimit(
+		middleware.WithRateLimit(2, time.Minute),
+		middleware.WithRateLimitKey(middleware.KeyByHeader("X-Tenant")),
+		middleware.WithRateLimitLogger(l),
+	)
+	handler := mw(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	serve := func(tenant string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api", nil)
+		req.Header.Set("X-Tenant", tenant)
+
+		w := httptest.NewRecorder()
+		w.Header().Set("X-Request-ID", "trace-1")
+		handler.ServeHTTP(w, req)
+
+		return w
+	}
+
+	w := serve("acme")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "2;w=60", w.Header().Get("RateLimit-Policy"))
+	assert.Equal(t, "2", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "30", w.Header().Get("RateLimit-Reset"))
+	assert.Empty(t, w.Header().Get("Retry-After"))
+
+	assert.Equal(t, http.StatusNoContent, serve("acme").Code)
+
+	w = serve("acme")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, middleware.ProblemContentType, w.Header().Get("Content-Type"))
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+	assert.Contains(t, w.Body.String(), `"traceId":"trace-1"`)
+
+	assert.Equal(t, http.StatusNoContent, serve("other").Code)
+}
+
+func TestRateLimitEmptyKeyUsesClientIP(t *testing.T) {
+	t.Parallel()
+
+	store := NewMockRateLimitStore(gomock.NewController(t))
+	store.EXPECT().
+		Update(gomock.Any(), "192.0.2.1", gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ string, _ time.Duration, fn func(middleware.RateLimitState, bool) middleware.RateLimitState) error {
+			fn(middleware.RateLimitState{}, false)
+			return nil
+		})
+
+	mw := middleware.RateLimit(
+		middleware.WithRateLimitKey(middleware.KeyByHeader("X-Tenant")),
+		middleware.WithRateLimitStore(store),
+	)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+
+	w := httptest.NewRecorder()
+	mw(http.NotFoundHandler()).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestRateLimitStoreFailure(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	errStore := errors.New("store unavailable")
+
+	store := NewMockRateLimitStore(ctrl)
+	store.EXPECT().Update(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(errStore)
+
+	l := NewMockInfoLogger(ctrl)
+	l.EXPECT().InfoContext(gomock.Any(), "rate limit store failed", "error", errStore, "key", gomock.Any()).Times(1)
+
+	mw := middleware.RateLimit(middleware.WithRateLimitStore(store), middleware.WithRateLimitLogger(l))
+
+	called := false
+	w := httptest.NewRecorder()
+	mw(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		called = true
+	})).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	require.True(t, called)
+	assert.Empty(t, w.Header().Get("RateLimit-Limit"))
+}
+
+func TestRateLimitInvalidLimit(t *testing.T) {
+	t.Parallel()
+
+	for _, opt := range []middleware.RateLimitOption{
+		middleware.WithRateLimit(0, time.Minute),
+		middleware.WithRateLimit(-1, time.Minute),
+		middleware.WithRateLimit(10, 0),
+		middleware.WithRateLimit(10, -time.Second),
+		middleware.WithBurst(-1),
+	} {
+		assert.Panics(t, func() { middleware.RateLimit(opt) })
+	}
+}
@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"context"
+	"hash/maphash"
+	"sync"
+	"time"
+)
+
+//go:generate mockgen -source=ratelimitstore.go -destination=ratelimitstore_mock_test.go -package=middleware_test
+
+// RateLimitStore stores the states of the keys limited by the RateLimit middleware.
+// Implementations backed by external services, such as Redis, allow sharing
+// limits between server instances.
+type RateLimitStore interface {
+	// Update atomically replaces the state of key with the result of fn, which
+	// receives the current state and whether it was found. The new state can
+	// be discarded after ttl.
+	Update(ctx context.Context, key string, ttl time.Duration, fn func(state RateLimitState, found bool) RateLimitState) error
+}
+
+// MemoryRateLimitStore is an in-memory RateLimitStore. Keys are spread over
+// shards, each with its own lock, to reduce contention. Expired states are
+// removed periodically.
+type MemoryRateLimitStore struct {
+	seed   maphash.Seed
+	sweep  time.Duration
+	shards []rateLimitShard
+}
+
+type rateLimitShard struct {
+	mu        sync.Mutex
+	entries   map[string]rateLimitEntry
+	nextSweep time.Time
+}
+
+type rateLimitEntry struct {
+	state   RateLimitState
+	expires time.Time
+}
+
+// MemoryRateLimitStoreOptions holds configuration options for the MemoryRateLimitStore.
+type MemoryRateLimitStoreOptions struct {
+	Shards        int
+	SweepInterval time.Duration
+}
+
+// MemoryRateLimitStoreOption represents a functional option for configuring a MemoryRateLimitStore.
+type MemoryRateLimitStoreOption func(*MemoryRateLimitStoreOptions)
+
+// WithShards sets the number of shards of the store. The default is 64.
+func WithShards(n int) MemoryRateLimitStoreOption {
+	return func(opt *MemoryRateLimitStoreOptions) {
+		opt.Shards = n
+	}
+}
+
+// WithSweepInterval sets how often each shard removes its expired states.
+// The default is one minute.
+func WithSweepInterval(d time.Duration) MemoryRateLimitStoreOption {
+	return func(opt *MemoryRateLimitStoreOptions) {
+		opt.SweepInterval = d
+	}
+}
+
+// NewMemoryRateLimitStore creates a MemoryRateLimitStore.
+func NewMemoryRateLimitStore(opts ...MemoryRateLimitStoreOption) *MemoryRateLimitStore {
+	options := &MemoryRateLimitStoreOptions{
+		Shards:        64,
+		SweepInterval: time.Minute,
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	s := &MemoryRateLimitStore{
+		seed:   maphash.MakeSeed(),
+		sweep:  options.SweepInterval,
+		shards: make([]rateLimitShard, max(1, options.Shards)),
+	}
+
+	now := time.Now()
+	for i := range s.shards {
+		s.shards[i].entries = make(map[string]rateLimitEntry)
+		s.shards[i].nextSweep = now.Add(s.sweep)
+	}
+
+	return s
+}
+
+// Update implements RateLimitStore.
+func (s *MemoryRateLimitStore) Update(_ context.Context, key string, ttl time.Duration, fn func(state RateLimitState, found bool) RateLimitState) error {
+	shard := &s.shards[maphash.String(s.seed, key)%uint64(len(s.shards))]
+	now := time.Now()
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	entry, found := shard.entries[key]
+	if found && !now.Before(entry.expires) {
+		entry, found = rateLimitEntry{}, false
+	}
+
+	shard.entries[key] = rateLimitEntry{state: fn(entry.state, found), expires: now.Add(ttl)}
+
+	if now.After(shard.nextSweep) {
+		for k, e := range shard.entries {
+			if !now.Before(e.expires) {
+				delete(shard.entries, k)
+			}
+		}
+
+		shard.nextSweep = now.Add(s.sweep)
+	}
+
+	return nil
+}
+
+// Len returns the number of states held by the store, expired ones included.
+func (s *MemoryRateLimitStore) Len() int {
+	var n int
+
+	for i := range s.shards {
+		s.shards[i].mu.Lock()
+		n += len(s.shards[i].entries)
+		s.shards[i].mu.Unlock()
+	}
+
+	return n
+}
@@ -0,0 +1,57 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: ratelimitstore.go
+//
+// Generated by this command:
+//
+//	mockgen -source=ratelimitstore.go -destination=ratelimitstore_mock_test.go -package=middleware_test
+//
+
+// Package middleware_test is a generated GoMock package.
+package middleware_test
+
+import (
+	context "context"
+	reflect "reflect"
+	time "time"
+
+	middleware "github.com/paccolamano/goshare/middleware"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockRateLimitStore is a mock of RateLimitStore interface.
+type MockRateLimitStore struct {
+	ctrl     *gomock.Controller
+	recorder *MockRateLimitStoreMockRecorder
+	isgomock struct{}
+}
+
+// MockRateLimitStoreMockRecorder is the mock recorder for MockRateLimitStore.
+type MockRateLimitStoreMockRecorder struct {
+	mock *MockRateLimitStore
+}
+
+// NewMockRateLimitStore creates a new mock instance.
+func NewMockRateLimitStore(ctrl *gomock.Controller) *MockRateLimitStore {
+	mock := &MockRateLimitStore{ctrl: ctrl}
+	mock.recorder = &MockRateLimitStoreMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRateLimitStore) EXPECT() *MockRateLimitStoreMockRecorder {
+	return m.recorder
+}
+
+// Update mocks base method.
+func (m *MockRateLimitStore) Update(ctx context.Context, key string, ttl time.Duration, fn func(middleware.RateLimitState, bool) middleware.RateLimitState) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Update", ctx, key, ttl, fn)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Update indicates an expected call of Update.
+func (mr *MockRateLimitStoreMockRecorder) Update(ctx, key, ttl, fn any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockRateLimitStore)(nil).Update), ctx, key, ttl, fn)
+}
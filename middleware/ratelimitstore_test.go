@@ -0,0 +1,82 @@
+package middleware_test
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/paccolamano/goshare/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryRateLimitStore(t *testing.T) {
+	t.Parallel()
+
+	s := middleware.NewMemoryRateLimitStore(middleware.WithShards(4))
+
+	incr := func(state middleware.RateLimitState, found bool) middleware.RateLimitState {
+		if !found {
+			state.Value = 0
+		}
+
+		state.Value++
+
+		return state
+	}
+
+	var wg sync.WaitGroup
+
+	for i := range 100 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, s.Update(context.Background(), "key"+strconv.Itoa(i%10), time.Minute, incr))
+		}()
+	}
+
+	wg.Wait()
+	assert.Equal(t, 10, s.Len())
+
+	var got middleware.RateLimitState
+
+	require.NoError(t, s.Update(context.Background(), "key3", time.Minute, func(state middleware.RateLimitState, found bool) middleware.RateLimitState {
+		assert.True(t, found)
+		got = state
+
+		return state
+	}))
+	assert.InDelta(t, 10, got.Value, 0)
+}
+
+func TestMemoryRateLimitStoreExpiry(t *testing.T) {
+	t.Parallel()
+
+	s := middleware.NewMemoryRateLimitStore(middleware.WithShards(1), middleware.WithSweepInterval(time.Millisecond))
+
+	keep := func(state middleware.RateLimitState, _ bool) middleware.RateLimitState {
+		return state
+	}
+
+	require.NoError(t, s.Update(context.Background(), "old", time.Millisecond, func(middleware.RateLimitState, bool) middleware.RateLimitState {
+		return middleware.RateLimitState{Value: 5}
+	}))
+
+	time.Sleep(5 * time.Millisecond)
+
+	require.NoError(t, s.Update(context.Background(), "old", time.Minute, func(state middleware.RateLimitState, found bool) middleware.RateLimitState {
+		assert.False(t, found)
+		assert.Zero(t, state)
+
+		return state
+	}))
+
+	require.NoError(t, s.Update(context.Background(), "short", time.Millisecond, keep))
+	time.Sleep(5 * time.Millisecond)
+	require.NoError(t, s.Update(context.Background(), "other", time.Minute, keep))
+
+	assert.Equal(t, 2, s.Len())
+}
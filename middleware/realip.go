@@ -0,0 +1,208 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// realIPKey is the context key under which RealIP stores the resolved client IP.
+type realIPKey struct{}
+
+// RealIPOptions holds configuration options for the RealIP middleware.
+type RealIPOptions struct {
+	TrustedProxies []netip.Prefix
+	Headers        []string
+}
+
+// RealIPOption represents a functional option for configuring RealIP middleware.
+type RealIPOption func(*RealIPOptions)
+
+// WithTrustedProxies sets the networks of the proxies allowed to report the client IP.
+// Headers are ignored for requests not coming from one of them.
+//
+// Example usage:
+//
+//	RealIP(WithTrustedProxies(netip.MustParsePrefix("10.0.0.0/8")))
+func WithTrustedProxies(prefixes ...netip.Prefix) RealIPOption {
+	return func(opt *RealIPOptions) {
+		opt.TrustedProxies = prefixes
+	}
+}
+
+// WithRealIPHeaders sets the headers inspected, in order, to resolve the client IP.
+// Supported headers are "Forwarded" (RFC 7239), "X-Forwarded-For" and "X-Real-IP".
+func WithRealIPHeaders(headers ...string) RealIPOption {
+	return func(opt *RealIPOptions) {
+		opt.Headers = headers
+	}
+}
+
+// RealIP returns a middleware resolving the client IP of each request and
+// storing it in the request context, where ClientIP retrieves it.
+//
+// Proxy headers are only honoured when the request comes from a trusted proxy.
+// The header chain is then walked from the closest hop, skipping trusted proxies,
+// and the first untrusted address is the client IP. Without trusted proxies the
+// client IP is always the connection remote address, so clients cannot spoof it.
+//
+// Example usage:
+//
+//	http.Handle("/", RealIP(WithTrustedProxies(netip.MustParsePrefix("10.0.0.0/8")))(Logger()(yourHandler)))
+func RealIP(opts ...RealIPOption) func(http.Handler) http.Handler {
+	options := &RealIPOptions{
+		Headers: []string{"Forwarded", "X-Forwarded-For", "X-Real-IP"},
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if ip, ok := options.resolve(r); ok {
+				r = r.WithContext(context.WithValue(r.Context(), realIPKey{}, ip))
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ClientIP returns the client IP resolved by the RealIP middleware or,
+// when RealIP did not run, the host of the request remote address.
+func ClientIP(r *http.Request) string {
+	if ip, ok := ClientIPFromContext(r.Context()); ok {
+		return ip.String()
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// ClientIPFromContext returns the client IP stored in ctx by the RealIP middleware.
+func ClientIPFromContext(ctx context.Context) (netip.Addr, bool) {
+	ip, ok := ctx.Value(realIPKey{}).(netip.Addr)
+	return ip, ok
+}
+
+// resolve returns the client IP of r.
+func (o *RealIPOptions) resolve(r *http.Request) (netip.Addr, bool) {
+	remote, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+
+	ip := remote.Addr().Unmap()
+	if !o.trusted(ip) {
+		return ip, true
+	}
+
+	for _, h := range o.Headers {
+		var chain []netip.Addr
+
+		switch http.CanonicalHeaderKey(h) {
+		case "Forwarded":
+			chain = parseForwarded(r.Header.Values("Forwarded"))
+		case "X-Forwarded-For":
+			chain = parseForwardedFor(r.Header.Values("X-Forwarded-For"))
+		case "X-Real-Ip":
+			chain = parseForwardedFor(r.Header.Values("X-Real-IP"))
+		}
+
+		if client, ok := o.client(chain); ok {
+			return client, true
+		}
+	}
+
+	return ip, true
+}
+
+// client walks chain from the closest hop and returns the first untrusted address.
+// If every address is trusted, the farthest one is returned. An invalid address
+// stops the walk, since hops beyond it cannot be verified.
+func (o *RealIPOptions) client(chain []netip.Addr) (netip.Addr, bool) {
+	for i := len(chain) - 1; i >= 0; i-- {
+		if !chain[i].IsValid() {
+			if i < len(chain)-1 {
+				return chain[i+1], true
+			}
+
+			return netip.Addr{}, false
+		}
+
+		if !o.trusted(chain[i]) || i == 0 {
+			return chain[i], true
+		}
+	}
+
+	return netip.Addr{}, false
+}
+
+func (o *RealIPOptions) trusted(ip netip.Addr) bool {
+	for _, p := range o.TrustedProxies {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseForwardedFor parses comma separated addresses, as found in X-Forwarded-For.
+// Invalid entries are kept as invalid addresses.
+func parseForwardedFor(values []string) []netip.Addr {
+	var chain []netip.Addr
+
+	for _, v := range values {
+		for entry := range strings.SplitSeq(v, ",") {
+			chain = append(chain, parseNode(strings.TrimSpace(entry)))
+		}
+	}
+
+	return chain
+}
+
+// parseForwarded parses the "for" parameters of RFC 7239 Forwarded headers.
+// Elements without a valid "for" parameter are kept as invalid addresses.
+func parseForwarded(values []string) []netip.Addr {
+	var chain []netip.Addr
+
+	for _, v := range values {
+		for element := range strings.SplitSeq(v, ",") {
+			ip := netip.Addr{}
+
+			for pair := range strings.SplitSeq(element, ";") {
+				key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(key, "for") {
+					ip = parseNode(strings.Trim(value, `"`))
+				}
+			}
+
+			chain = append(chain, ip)
+		}
+	}
+
+	return chain
+}
+
+// parseNode parses an address optionally followed by a port, with IPv6
+// addresses possibly enclosed in brackets. Unknown or obfuscated identifiers
+// result in an invalid address.
+func parseNode(s string) netip.Addr {
+	if ap, err := netip.ParseAddrPort(s); err == nil {
+		return ap.Addr().Unmap()
+	}
+
+	if ip, err := netip.ParseAddr(strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")); err == nil {
+		return ip.Unmap()
+	}
+
+	return netip.Addr{}
+}
@@ -0,0 +1,104 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/paccolamano/goshare/middleware"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRealIP(t *testing.T) {
+	t.Parallel()
+
+	trusted := middleware.WithTrustedProxies(
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("2001:db8::/32"),
+	)
+
+	cases := []struct {
+		name       string
+		opts       []middleware.RealIPOption
+		remoteAddr string
+		headers    map[string]string
+		expected   string
+	}{
+		{
+			name:       "untrusted remote ignores headers",
+			remoteAddr: "203.0.113.7:1234",
+			headers:    map[string]string{"X-Forwarded-For": "1.1.1.1", "X-Real-IP": "2.2.2.2"},
+			expected:   "203.0.113.7",
+		},
+		{
+			name:       "x-forwarded-for skips trusted hops",
+			opts:       []middleware.RealIPOption{trusted},
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "6.6.6.6, 198.51.100.4, 10.0.0.2"},
+			expected:   "198.51.100.4",
+		},
+		{
+			name:       "forwarded takes precedence",
+			opts:       []middleware.RealIPOption{trusted},
+			remoteAddr: "10.0.0.1:1234",
+			headers: map[string]string{
+				"Forwarded":       `for=192.0.2.60;proto=http, for="[2001:db8:cafe::17]:4711"`,
+				"X-Forwarded-For": "198.51.100.4",
+			},
+			expected: "192.0.2.60",
+		},
+		{
+			name:       "obfuscated hop stops the walk",
+			opts:       []middleware.RealIPOption{trusted},
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"Forwarded": "for=198.51.100.4, for=_hidden, for=10.0.0.3"},
+			expected:   "10.0.0.3",
+		},
+		{
+			name:       "x-real-ip",
+			opts:       []middleware.RealIPOption{trusted, middleware.WithRealIPHeaders("X-Real-IP")},
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "6.6.6.6", "X-Real-IP": "198.51.100.9"},
+			expected:   "198.51.100.9",
+		},
+		{
+			name:       "trusted remote without headers",
+			opts:       []middleware.RealIPOption{trusted},
+			remoteAddr: "[::ffff:10.0.0.1]:1234",
+			expected:   "10.0.0.1",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var got string
+
+			handler := http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				got = middleware.ClientIP(r)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tc.remoteAddr
+
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+
+			middleware.RealIP(tc.opts...)(handler).ServeHTTP(httptest.NewRecorder(), req)
+
+			require.Equal(t, tc.expected, got)
+		})
+	}
+}
+
+func TestClientIPWithoutRealIP(t *testing.T) {
+	t.Parallel()
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Real-IP", "6.6.6.6")
+
+	require.Equal(t, "192.0.2.1", middleware.ClientIP(req))
+}
@@ -2,10 +2,18 @@ package middleware
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"reflect"
+	"runtime"
 	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
 )
 
 //go:generate mockgen -source=recover.go -destination=recover_mock_test.go -package=middleware_test
@@ -16,11 +24,73 @@ type ErrorLogger interface {
 	ErrorContext(ctx context.Context, msg string, args ...any)
 }
 
+// middlewarePackage is the import path prefix of this package's functions,
+// used to trim middleware frames from panic stacks.
+var middlewarePackage = reflect.TypeFor[RecoverOptions]().PkgPath() + "."
+
+// PanicKind classifies the value of a recovered panic.
+type PanicKind string
+
+// Kinds of recovered panics.
+const (
+	// PanicKindRuntime is a runtime.Error, such as a nil pointer dereference.
+	PanicKindRuntime PanicKind = "runtime"
+	// PanicKindError is any other error value.
+	PanicKindError PanicKind = "error"
+	// PanicKindString is a string value.
+	PanicKindString PanicKind = "string"
+	// PanicKindOther is any other value.
+	PanicKindOther PanicKind = "other"
+)
+
+// StackFrame is a single frame of a panic stack.
+type StackFrame struct {
+	Function string `json:"function"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+}
+
+// String formats the frame as "function (file:line)".
+func (f StackFrame) String() string {
+	return fmt.Sprintf("%s (%s:%d)", f.Function, f.File, f.Line)
+}
+
+// PanicInfo describes a panic recovered by the Recover middleware.
+type PanicInfo struct {
+	// Value is the value passed to panic.
+	Value any
+	// Kind classifies Value.
+	Kind PanicKind
+	// Err is Value as an error. Non error values are formatted with %v.
+	Err error
+	// Chain lists the errors of the Err chain, unwrapped depth first, as "type: message".
+	Chain []string
+	// Stack is the stack trace of the panicking goroutine.
+	Stack []byte
+	// Frames is the parsed stack trace, trimmed according to the Recover options.
+	Frames []StackFrame
+	// TraceID is the trace ID of the request, if any.
+	TraceID string
+	// Fingerprint identifies the panic location, grouping repeated panics.
+	Fingerprint string
+	// Count is the number of occurrences of the fingerprint since it was last
+	// reported, this one included. It is 1 unless grouping is enabled.
+	Count int
+}
+
 // RecoverOptions holds configuration options for the Recover middleware,
-// including the logger and the panic callback handler.
+// including the logger and the panic callback handler. PanicCallback takes
+// precedence over Callback; when both are nil, a 500 problem response is written.
 type RecoverOptions struct {
-	Logger   ErrorLogger
-	Callback func(w http.ResponseWriter, r *http.Request)
+	Logger         ErrorLogger
+	Callback       func(w http.ResponseWriter, r *http.Request)
+	PanicCallback  func(w http.ResponseWriter, r *http.Request, info *PanicInfo)
+	TraceKey       any
+	TrimRuntime    bool
+	TrimMiddleware bool
+	TrimPrefixes   []string
+	Reporters      []Reporter
+	GroupWindow    time.Duration
 }
 
 // RecoverOption represents a functional option for configuring Recover middleware.
@@ -42,42 +112,300 @@ func WithCallback(f func(w http.ResponseWriter, r *http.Request)) RecoverOption
 	}
 }
 
+// WithPanicCallback sets a custom callback function that will be executed
+// when a panic is recovered in an HTTP handler, receiving the recovered value and stack.
+// It takes precedence over WithCallback.
+func WithPanicCallback(f func(w http.ResponseWriter, r *http.Request, info *PanicInfo)) RecoverOption {
+	return func(ro *RecoverOptions) {
+		ro.PanicCallback = f
+	}
+}
+
+// WithRecoverTraceKey sets the context key from which the Recover middleware reads
+// the trace ID. It should match the Tracer key.
+func WithRecoverTraceKey(key any) RecoverOption {
+	return func(ro *RecoverOptions) {
+		ro.TraceKey = key
+	}
+}
+
+// WithStackTrim selects whether frames of the Go runtime and of this middleware
+// package are trimmed from PanicInfo.Frames. Both are trimmed by default.
+func WithStackTrim(runtime, middleware bool) RecoverOption {
+	return func(ro *RecoverOptions) {
+		ro.TrimRuntime = runtime
+		ro.TrimMiddleware = middleware
+	}
+}
+
+// WithTrimFramePrefixes trims from PanicInfo.Frames the frames whose function
+// starts with one of prefixes, for instance "net/http.".
+func WithTrimFramePrefixes(prefixes ...string) RecoverOption {
+	return func(ro *RecoverOptions) {
+		ro.TrimPrefixes = prefixes
+	}
+}
+
+// WithReporter adds reporters to which recovered panics are forwarded,
+// after being logged. It can be used multiple times.
+func WithReporter(reporters ...Reporter) RecoverOption {
+	return func(ro *RecoverOptions) {
+		ro.Reporters = append(ro.Reporters, reporters...)
+	}
+}
+
+// WithPanicGrouping groups panics by fingerprint: after a panic is logged and reported,
+// further panics with the same fingerprint within window are only counted.
+// The next panic after window is logged and reported with the accumulated count.
+func WithPanicGrouping(window time.Duration) RecoverOption {
+	return func(ro *RecoverOptions) {
+		ro.GroupWindow = window
+	}
+}
+
 // Recover returns a middleware that recovers from panics during HTTP request handling.
 // It logs the panic using the provided logger (or a default one) and then calls the
 // specified callback (or a default 500 error response).
 //
 // Example usage:
 //
-//	http.Handle("/api", Recover(WithLogger(myLogger), WithCallback(myCallback))(myHandler))
+//	http.Handle("/api", Recover(WithRecoverLogger(myLogger), WithPanicCallback(myCallback))(myHandler))
 //
-// If no options are provided, it uses slog.Default() as the logger and writes a generic
-// 500 Internal Server Error response in JSON format.
+// If no options are provided, it uses slog.Default() as the logger and writes a
+// 500 Internal Server Error response in RFC 9457 application/problem+json format,
+// including the request trace ID.
+//
+// If the response headers were already sent when the panic occurred, the callback
+// is not called: the response is aborted instead, closing the connection.
+// Panics with http.ErrAbortHandler are not recovered, following net/http semantics.
+//
+// Panics are classified by kind, their error chain is unwrapped and their stack is
+// parsed into frames, available to the callback through PanicInfo and logged.
+// Panics are then forwarded to the reporters set with WithReporter.
 func Recover(opts ...RecoverOption) func(http.Handler) http.Handler {
 	options := &RecoverOptions{
-		Logger: slog.Default(),
-		Callback: func(w http.ResponseWriter, _ *http.Request) {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusInternalServerError)
-			_ = json.NewEncoder(w).Encode(map[string]string{
-				"error": http.StatusText(http.StatusInternalServerError),
-			})
-		},
+		Logger:         slog.Default(),
+		TraceKey:       "traceUUID",
+		TrimRuntime:    true,
+		TrimMiddleware: true,
 	}
 
 	for _, opt := range opts {
 		opt(options)
 	}
 
+	groups := &panicGroups{groups: make(map[string]*panicGroup)}
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rw := NewResponseRecorder(w)
+
 			defer func(ctx context.Context) {
 				if err := recover(); err != nil {
-					options.Logger.ErrorContext(ctx, "recovered from panic", "error", err, "stack", string(debug.Stack()))
-					options.Callback(w, r)
+					if err == http.ErrAbortHandler {
+						panic(err)
+					}
+
+					info := options.panicInfo(err)
+					info.TraceID = requestTraceID(w, r, options.TraceKey)
+
+					if options.GroupWindow <= 0 || groups.report(info, options.GroupWindow, time.Now()) {
+						args := []any{
+							"error", info.Err,
+							"kind", info.Kind,
+							"errorChain", info.Chain,
+							"frames", info.Frames,
+							"fingerprint", info.Fingerprint,
+							"count", info.Count,
+						}
+						args = append(args, traceAttrs(ctx, options.Logger, info.TraceID)...)
+						args = append(args, "headerWritten", rw.HeaderWritten())
+						options.Logger.ErrorContext(ctx, "recovered from panic", args...)
+
+						for _, rep := range options.Reporters {
+							if err := rep.Report(ctx, r, info); err != nil {
+								options.Logger.ErrorContext(ctx, "panic reporter failed", "error", err, "fingerprint", info.Fingerprint)
+							}
+						}
+					}
+
+					switch {
+					case rw.Hijacked():
+					case rw.HeaderWritten():
+						panic(http.ErrAbortHandler)
+					case options.PanicCallback != nil:
+						options.PanicCallback(w, r, info)
+					case options.Callback != nil:
+						options.Callback(w, r)
+					default:
+						defaultPanicCallback(w, r, info)
+					}
 				}
 			}(r.Context())
 
-			next.ServeHTTP(w, r)
+			next.ServeHTTP(rw, r)
 		})
 	}
 }
+
+// panicInfo builds the PanicInfo of the recovered value v.
+// It must be called from the deferred function recovering the panic.
+func (o *RecoverOptions) panicInfo(v any) *PanicInfo {
+	info := &PanicInfo{Value: v, Stack: debug.Stack()}
+	pcs := callers()
+
+	// Panics propagated by Timeout carry the stack of the handler goroutine.
+	if hp, ok := v.(*HandlerPanic); ok {
+		info.Value, info.Stack, pcs = hp.Value, hp.Stack, hp.pcs
+		v = hp.Value
+	}
+
+	info.Frames = o.frames(pcs)
+
+	var re runtime.Error
+
+	switch t := v.(type) {
+	case error:
+		info.Kind, info.Err = PanicKindError, t
+		if errors.As(t, &re) {
+			info.Kind = PanicKindRuntime
+		}
+	case string:
+		info.Kind, info.Err = PanicKindString, errors.New(t)
+	default:
+		info.Kind, info.Err = PanicKindOther, fmt.Errorf("%v", t)
+	}
+
+	info.Chain = errorChain(info.Err, nil)
+	info.Fingerprint = fingerprint(info)
+	info.Count = 1
+
+	return info
+}
+
+// fingerprintFrames is the number of top frames identifying a panic location.
+const fingerprintFrames = 3
+
+// fingerprint hashes the panic kind, the value type and the top stack frames,
+// so that panics raised at the same location share the same fingerprint.
+func fingerprint(info *PanicInfo) string {
+	h := sha256.New()
+	_, _ = fmt.Fprintf(h, "%s|%T", info.Kind, info.Value)
+
+	for _, f := range info.Frames[:min(len(info.Frames), fingerprintFrames)] {
+		_, _ = fmt.Fprintf(h, "|%s:%d", f.Function, f.Line)
+	}
+
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// panicGroups counts panics by fingerprint for WithPanicGrouping.
+type panicGroups struct {
+	mu     sync.Mutex
+	groups map[string]*panicGroup
+}
+
+type panicGroup struct {
+	reported   time.Time
+	suppressed int
+}
+
+// report reports whether info must be logged and reported at now, setting info.Count.
+// Groups whose window expired are dropped when a new window starts.
+func (g *panicGroups) report(info *PanicInfo, window time.Duration, now time.Time) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	group, ok := g.groups[info.Fingerprint]
+	if ok && now.Sub(group.reported) < window {
+		group.suppressed++
+		return false
+	}
+
+	if ok {
+		info.Count = group.suppressed + 1
+	}
+
+	for fp, other := range g.groups {
+		if now.Sub(other.reported) >= window && other.suppressed == 0 {
+			delete(g.groups, fp)
+		}
+	}
+
+	g.groups[info.Fingerprint] = &panicGroup{reported: now}
+
+	return true
+}
+
+// callers returns the program counters of the calling goroutine stack.
+func callers() []uintptr {
+	pcs := make([]uintptr, 64)
+	return pcs[:runtime.Callers(2, pcs)]
+}
+
+// frames returns the trimmed frames of pcs.
+func (o *RecoverOptions) frames(pcs []uintptr) []StackFrame {
+	var frames []StackFrame
+	if len(pcs) == 0 {
+		return frames
+	}
+
+	it := runtime.CallersFrames(pcs)
+	for {
+		f, more := it.Next()
+		if !o.trimmed(f.Function) {
+			frames = append(frames, StackFrame{Function: f.Function, File: f.File, Line: f.Line})
+		}
+
+		if !more {
+			return frames
+		}
+	}
+}
+
+func (o *RecoverOptions) trimmed(function string) bool {
+	if o.TrimRuntime && strings.HasPrefix(function, "runtime.") {
+		return true
+	}
+
+	if o.TrimMiddleware && strings.HasPrefix(function, middlewarePackage) {
+		return true
+	}
+
+	for _, p := range o.TrimPrefixes {
+		if strings.HasPrefix(function, p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// errorChain appends to chain the errors of err's tree, depth first.
+func errorChain(err error, chain []string) []string {
+	if err == nil {
+		return chain
+	}
+
+	chain = append(chain, fmt.Sprintf("%T: %v", err, err))
+
+	switch u := err.(type) {
+	case interface{ Unwrap() error }:
+		return errorChain(u.Unwrap(), chain)
+	case interface{ Unwrap() []error }:
+		for _, e := range u.Unwrap() {
+			chain = errorChain(e, chain)
+		}
+	}
+
+	return chain
+}
+
+// defaultPanicCallback writes a 500 Internal Server Error problem response.
+func defaultPanicCallback(w http.ResponseWriter, r *http.Request, info *PanicInfo) {
+	p := NewProblem(http.StatusInternalServerError)
+	p.Instance = r.URL.Path
+	p.TraceID = info.TraceID
+
+	WriteProblem(w, p)
+}
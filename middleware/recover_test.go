@@ -1,12 +1,19 @@
 package middleware_test
 
 import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
+	"github.com/paccolamano/goshare/logger"
 	"github.com/paccolamano/goshare/middleware"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/mock/gomock"
 )
 
@@ -36,9 +43,9 @@ func TestRecoverWithPanic(t *testing.T) {
 	resp := w.Result()
 
 	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
-	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "application/problem+json", resp.Header.Get("Content-Type"))
 
-	expectedBody := `{"error":"Internal Server Error"}` + "\n"
+	expectedBody := `{"instance":"/panic","status":500,"title":"Internal Server Error","type":"about:blank"}` + "\n"
 	body := w.Body.String()
 	assert.Equal(t, expectedBody, body)
 }
@@ -73,3 +80,264 @@ func TestRecoverNoPanic(t *testing.T) {
 	assert.Equal(t, http.StatusOK, resp.StatusCode)
 	assert.True(t, handlerCalled)
 }
+
+func TestRecoverProblemTraceID(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	l := NewMockErrorLogger(ctrl)
+	l.EXPECT().ErrorContext(gomock.Any(), "recovered from panic", gomock.Any()).Times(1)
+
+	handler := http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+		panic("something went wrong")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/panic", nil)
+	w := httptest.NewRecorder()
+
+	middleware.Tracer()(middleware.Recover(middleware.WithRecoverLogger(l))(handler)).ServeHTTP(w, req)
+
+	var problem map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, w.Header().Get("X-Request-ID"), problem["traceId"])
+}
+
+func TestRecoverTraceHandlerTraceID(t *testing.T) {
+	t.Parallel()
+
+	buf := &bytes.Buffer{}
+	l := slog.New(logger.NewTraceHandler(buf, "json", "info"))
+
+	handler := http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+		panic("something went wrong")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/panic", nil)
+	w := httptest.NewRecorder()
+
+	middleware.Tracer(middleware.WithTraceKey(logger.TraceIDKey))(
+		middleware.Recover(
+			middleware.WithRecoverLogger(l),
+			middleware.WithRecoverTraceKey(logger.TraceIDKey),
+		)(handler),
+	).ServeHTTP(w, req)
+
+	assert.Contains(t, buf.String(), `"traceUUID":"`+w.Header().Get("X-Request-ID")+`"`)
+	assert.Equal(t, 1, strings.Count(buf.String(), "traceUUID"))
+}
+
+func TestRecoverPanicCallback(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	l := NewMockErrorLogger(ctrl)
+	l.EXPECT().ErrorContext(gomock.Any(), "recovered from panic", gomock.Any()).Times(1)
+
+	var info *middleware.PanicInfo
+
+	callback := func(w http.ResponseWriter, _ *http.Request, i *middleware.PanicInfo) {
+		info = i
+
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	handler := http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+		panic("something went wrong")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/panic", nil)
+	w := httptest.NewRecorder()
+
+	middleware.Recover(middleware.WithRecoverLogger(l), middleware.WithPanicCallback(callback))(handler).ServeHTTP(w, req)
+
+	require.NotNil(t, info)
+	assert.Equal(t, "something went wrong", info.Value)
+	assert.Contains(t, string(info.Stack), "recover_test.go")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
+
+func TestRecoverCallbackPrecedence(t *testing.T) {
+	t.Parallel()
+
+	handler := http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+		panic("something went wrong")
+	})
+
+	callback := func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	panicCallback := func(w http.ResponseWriter, _ *http.Request, _ *middleware.PanicInfo) {
+		w.WriteHeader(http.StatusBadGateway)
+	}
+
+	cases := []struct {
+		name     string
+		opts     []middleware.RecoverOption
+		expected int
+	}{
+		{"default", nil, http.StatusInternalServerError},
+		{"callback", []middleware.RecoverOption{middleware.WithCallback(callback)}, http.StatusServiceUnavailable},
+		{"panic callback", []middleware.RecoverOption{
+			middleware.WithPanicCallback(panicCallback),
+			middleware.WithCallback(callback),
+		}, http.StatusBadGateway},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			opts := append([]middleware.RecoverOption{
+				middleware.WithRecoverLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+			}, tc.opts...)
+
+			req := httptest.NewRequest(http.MethodGet, "/panic", nil)
+			w := httptest.NewRecorder()
+
+			middleware.Recover(opts...)(handler).ServeHTTP(w, req)
+
+			assert.Equal(t, tc.expected, w.Code)
+		})
+	}
+}
+
+func TestRecoverHeaderWritten(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	l := NewMockErrorLogger(ctrl)
+	l.EXPECT().ErrorContext(gomock.Any(), "recovered from panic", gomock.Any()).Times(1)
+
+	callbackCalled := false
+	callback := func(_ http.ResponseWriter, _ *http.Request) {
+		callbackCalled = true
+	}
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		panic("something went wrong")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/panic", nil)
+	w := httptest.NewRecorder()
+
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		middleware.Recover(middleware.WithRecoverLogger(l), middleware.WithCallback(callback))(handler).ServeHTTP(w, req)
+	})
+
+	assert.False(t, callbackCalled)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+type wrappedError struct {
+	err error
+}
+
+func (e *wrappedError) Error() string {
+	return "wrapped: " + e.err.Error()
+}
+
+func (e *wrappedError) Unwrap() error {
+	return e.err
+}
+
+func TestRecoverPanicClassification(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name          string
+		panic         func()
+		expectedKind  middleware.PanicKind
+		expectedChain []string
+	}{
+		{
+			"string",
+			func() { panic("boom") },
+			middleware.PanicKindString,
+			[]string{"*errors.errorString: boom"},
+		},
+		{
+			"error chain",
+			func() { panic(&wrappedError{err: io.ErrUnexpectedEOF}) },
+			middleware.PanicKindError,
+			[]string{"*middleware_test.wrappedError: wrapped: unexpected EOF", "*errors.errorString: unexpected EOF"},
+		},
+		{
+			"runtime",
+			func() {
+				var m map[string]int
+				m["boom"]++
+			},
+			middleware.PanicKindRuntime,
+			[]string{"runtime.plainError: assignment to entry in nil map"},
+		},
+		{
+			"other",
+			func() { panic(42) },
+			middleware.PanicKindOther,
+			[]string{"*errors.errorString: 42"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var info *middleware.PanicInfo
+
+			callback := func(_ http.ResponseWriter, _ *http.Request, i *middleware.PanicInfo) {
+				info = i
+			}
+
+			handler := http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+				tc.panic()
+			})
+
+			l := slog.New(slog.NewTextHandler(io.Discard, nil))
+			middleware.Recover(
+				middleware.WithRecoverLogger(l),
+				middleware.WithPanicCallback(callback),
+			)(handler).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+			require.NotNil(t, info)
+			assert.Equal(t, tc.expectedKind, info.Kind)
+			assert.Equal(t, tc.expectedChain, info.Chain)
+
+			require.NotEmpty(t, info.Frames)
+			assert.Contains(t, info.Frames[0].Function, "TestRecoverPanicClassification")
+
+			for _, f := range info.Frames {
+				assert.NotContains(t, f.Function, "runtime.")
+				assert.False(t, strings.HasPrefix(f.Function, "github.com/paccolamano/goshare/middleware."), f.Function)
+			}
+		})
+	}
+}
+
+func TestRecoverErrAbortHandler(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	l := NewMockErrorLogger(ctrl)
+	l.EXPECT().ErrorContext(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+	handler := http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+		panic(http.ErrAbortHandler)
+	})
+
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		middleware.Recover(middleware.WithRecoverLogger(l))(handler).
+			ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	})
+}
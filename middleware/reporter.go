@@ -0,0 +1,207 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+//go:generate mockgen -source=reporter.go -destination=reporter_mock_test.go -package=middleware_test
+
+// Reporter receives the panics recovered by the Recover middleware,
+// for instance to forward them to an error tracking service.
+type Reporter interface {
+	// Report handles a recovered panic raised while serving r.
+	Report(ctx context.Context, r *http.Request, info *PanicInfo) error
+}
+
+// ReporterFunc is an adapter allowing the use of ordinary functions as Reporter.
+type ReporterFunc func(ctx context.Context, r *http.Request, info *PanicInfo) error
+
+// Report calls f(ctx, r, info).
+func (f ReporterFunc) Report(ctx context.Context, r *http.Request, info *PanicInfo) error {
+	return f(ctx, r, info)
+}
+
+// CrashDumpOptions holds configuration options for the CrashDumpReporter.
+type CrashDumpOptions struct {
+	RedactHeaders []string
+	Goroutines    bool
+	MaxDumpSize   int
+}
+
+// CrashDumpOption represents a functional option for configuring a CrashDumpReporter.
+type CrashDumpOption func(*CrashDumpOptions)
+
+// WithRedactedHeaders sets the request headers whose values are replaced with
+// "[REDACTED]" in crash dumps. By default Authorization, Proxy-Authorization,
+// Cookie and X-Api-Key are redacted.
+func WithRedactedHeaders(headers ...string) CrashDumpOption {
+	return func(opt *CrashDumpOptions) {
+		opt.RedactHeaders = headers
+	}
+}
+
+// WithGoroutineDump selects whether crash dumps include the stacks of all
+// goroutines (enabled by default), truncated to maxSize bytes. A non-positive
+// maxSize keeps the default of 1 MiB.
+func WithGoroutineDump(enabled bool, maxSize int) CrashDumpOption {
+	return func(opt *CrashDumpOptions) {
+		opt.Goroutines = enabled
+
+		if maxSize > 0 {
+			opt.MaxDumpSize = maxSize
+		}
+	}
+}
+
+// CrashDumpReporter is a Reporter writing each panic as a JSON crash dump
+// file to a directory.
+type CrashDumpReporter struct {
+	dir     string
+	options *CrashDumpOptions
+}
+
+// NewCrashDumpReporter creates a CrashDumpReporter writing to dir,
+// creating the directory if needed.
+//
+// Each dump contains the request metadata and headers, the panic details,
+// its stack and, unless disabled, a dump of all goroutines. The values of the
+// query parameters, which can carry tokens or personal data, are redacted.
+//
+// Example usage:
+//
+//	dumps, err := NewCrashDumpReporter("/var/crash/api")
+//	http.Handle("/", Recover(WithReporter(dumps))(yourHandler))
+func NewCrashDumpReporter(dir string, opts ...CrashDumpOption) (*CrashDumpReporter, error) {
+	options := &CrashDumpOptions{
+		RedactHeaders: []string{"Authorization", "Proxy-Authorization", "Cookie", "X-Api-Key"},
+		Goroutines:    true,
+		MaxDumpSize:   1 << 20,
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("middleware: create crash dump directory: %w", err)
+	}
+
+	return &CrashDumpReporter{dir: dir, options: options}, nil
+}
+
+// crashDump is the JSON document written by CrashDumpReporter.
+type crashDump struct {
+	Time        time.Time    `json:"time"`
+	Fingerprint string       `json:"fingerprint"`
+	Count       int          `json:"count"`
+	TraceID     string       `json:"traceId,omitempty"`
+	Kind        PanicKind    `json:"kind"`
+	Error       string       `json:"error"`
+	ErrorChain  []string     `json:"errorChain"`
+	Request     crashDumpReq `json:"request"`
+	Frames      []StackFrame `json:"frames"`
+	Stack       string       `json:"stack"`
+	Goroutines  string       `json:"goroutines,omitempty"`
+}
+
+type crashDumpReq struct {
+	Method     string      `json:"method"`
+	URL        string      `json:"url"`
+	Proto      string      `json:"proto"`
+	Host       string      `json:"host"`
+	RemoteAddr string      `json:"remoteAddr"`
+	ClientIP   string      `json:"clientIp"`
+	Headers    http.Header `json:"headers"`
+}
+
+// Report writes the crash dump of info to a file named after the time and fingerprint.
+func (c *CrashDumpReporter) Report(_ context.Context, r *http.Request, info *PanicInfo) error {
+	now := time.Now().UTC()
+
+	headers := r.Header.Clone()
+	for _, h := range c.options.RedactHeaders {
+		if _, ok := headers[http.CanonicalHeaderKey(h)]; ok {
+			headers.Set(h, redactedValue)
+		}
+	}
+
+	dump := crashDump{
+		Time:        now,
+		Fingerprint: info.Fingerprint,
+		Count:       info.Count,
+		TraceID:     info.TraceID,
+		Kind:        info.Kind,
+		Error:       info.Err.Error(),
+		ErrorChain:  info.Chain,
+		Request: crashDumpReq{
+			Method:     r.Method,
+			URL:        redactedURL(r.URL),
+			Proto:      r.Proto,
+			Host:       r.Host,
+			RemoteAddr: r.RemoteAddr,
+			ClientIP:   ClientIP(r),
+			Headers:    headers,
+		},
+		Frames: info.Frames,
+		Stack:  string(info.Stack),
+	}
+
+	if c.options.Goroutines {
+		buf := make([]byte, c.options.MaxDumpSize)
+		dump.Goroutines = string(buf[:runtime.Stack(buf, true)])
+	}
+
+	data, err := json.MarshalIndent(dump, "", "  ")
+	if err != nil {
+		return fmt.Errorf("middleware: encode crash dump: %w", err)
+	}
+
+	name := fmt.Sprintf("%s-%s.json", now.Format("20060102T150405.000000000Z"), info.Fingerprint)
+
+	tmp, err := os.CreateTemp(c.dir, ".crash-*")
+	if err != nil {
+		return fmt.Errorf("middleware: write crash dump: %w", err)
+	}
+
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(c.dir, name))
+	}
+
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("middleware: write crash dump: %w", err)
+	}
+
+	return nil
+}
+
+// redactedURL returns u with the values of its query parameters replaced
+// with "[REDACTED]", and its password, if any, masked.
+func redactedURL(u *url.URL) string {
+	c := *u
+
+	if q := c.Query(); len(q) > 0 {
+		for _, values := range q {
+			for i := range values {
+				values[i] = redactedValue
+			}
+		}
+
+		c.RawQuery = q.Encode()
+	}
+
+	return c.Redacted()
+}
@@ -0,0 +1,156 @@
+package middleware_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/paccolamano/goshare/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func panicHandler() http.Handler {
+	return http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+		panic("something went wrong")
+	})
+}
+
+func TestRecoverReporters(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	l := NewMockErrorLogger(ctrl)
+	l.EXPECT().ErrorContext(gomock.Any(), "recovered from panic", gomock.Any()).Times(1)
+	l.EXPECT().ErrorContext(gomock.Any(), "panic reporter failed", gomock.Any()).Times(1)
+
+	r1 := NewMockReporter(ctrl)
+	r1.EXPECT().Report(gomock.Any(), gomock.Any(), gomock.Any()).Return(errors.New("unavailable")).Times(1)
+
+	r2 := NewMockReporter(ctrl)
+	r2.EXPECT().Report(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).Times(1)
+
+	w := httptest.NewRecorder()
+	middleware.Recover(
+		middleware.WithRecoverLogger(l),
+		middleware.WithReporter(r1, r2),
+	)(panicHandler()).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestRecoverPanicGrouping(t *testing.T) {
+	t.Parallel()
+
+	var reports []middleware.PanicInfo
+
+	reporter := middleware.ReporterFunc(func(_ context.Context, _ *http.Request, info *middleware.PanicInfo) error {
+		reports = append(reports, *info)
+		return nil
+	})
+
+	handler := middleware.Recover(
+		middleware.WithRecoverLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		middleware.WithReporter(reporter),
+		middleware.WithPanicGrouping(50*time.Millisecond),
+	)(panicHandler())
+
+	serve := func() {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+	}
+
+	for range 3 {
+		serve()
+	}
+
+	require.Len(t, reports, 1)
+	assert.Equal(t, 1, reports[0].Count)
+	assert.Len(t, reports[0].Fingerprint, 16)
+
+	time.Sleep(60 * time.Millisecond)
+	serve()
+
+	require.Len(t, reports, 2)
+	assert.Equal(t, 3, reports[1].Count)
+	assert.Equal(t, reports[0].Fingerprint, reports[1].Fingerprint)
+}
+
+func TestCrashDumpReporter(t *testing.T) {
+	t.Parallel()
+
+	dir := filepath.Join(t.TempDir(), "crash")
+
+	dumps, err := middleware.NewCrashDumpReporter(dir, middleware.WithGoroutineDump(true, 4096))
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/orders?id=1", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("Accept", "application/json")
+
+	middleware.Recover(
+		middleware.WithRecoverLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		middleware.WithReporter(dumps),
+	)(panicHandler()).ServeHTTP(httptest.NewRecorder(), req)
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+
+	data, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+
+	var dump struct {
+		Fingerprint string `json:"fingerprint"`
+		Kind        string `json:"kind"`
+		Error       string `json:"error"`
+		Request     struct {
+			Method  string      `json:"method"`
+			URL     string      `json:"url"`
+			Headers http.Header `json:"headers"`
+		} `json:"request"`
+		Frames     []middleware.StackFrame `json:"frames"`
+		Goroutines string                  `json:"goroutines"`
+	}
+	require.NoError(t, json.Unmarshal(data, &dump))
+
+	assert.Contains(t, files[0], dump.Fingerprint)
+	assert.Equal(t, "string", dump.Kind)
+	assert.Equal(t, "something went wrong", dump.Error)
+	assert.Equal(t, http.MethodPost, dump.Request.Method)
+	assert.Equal(t, "/orders?id=%5BREDACTED%5D", dump.Request.URL)
+	assert.Equal(t, "[REDACTED]", dump.Request.Headers.Get("Authorization"))
+	assert.Equal(t, "application/json", dump.Request.Headers.Get("Accept"))
+	assert.NotEmpty(t, dump.Frames)
+	assert.Contains(t, dump.Goroutines, "goroutine")
+}
+
+func TestCrashDumpReporterInvalidDumpSize(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	dumps, err := middleware.NewCrashDumpReporter(dir, middleware.WithGoroutineDump(true, -1))
+	require.NoError(t, err)
+
+	middleware.Recover(
+		middleware.WithRecoverLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		middleware.WithReporter(dumps),
+	)(panicHandler()).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	require.NoError(t, err)
+	assert.Len(t, files, 1)
+}
@@ -0,0 +1,319 @@
+package middleware
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// ResponseRecorder is an http.ResponseWriter that records the response status,
+// the number of body bytes written, when the first byte was written and whether
+// headers were already sent.
+//
+// Recorders returned by NewResponseRecorder implement http.Flusher, http.Hijacker,
+// http.Pusher and io.ReaderFrom exactly when the wrapped writer does, and expose
+// the wrapped writer through Unwrap for http.ResponseController.
+type ResponseRecorder interface {
+	http.ResponseWriter
+
+	// Status returns the status code sent to the client, or http.StatusOK
+	// if headers were not written yet.
+	Status() int
+
+	// BytesWritten returns the number of body bytes written.
+	BytesWritten() int64
+
+	// HeaderWritten reports whether the response headers were sent.
+	HeaderWritten() bool
+
+	// FirstByteTime returns when the first body byte was written,
+	// or the zero time if no body byte was written yet.
+	FirstByteTime() time.Time
+
+	// Hijacked reports whether the connection was hijacked.
+	Hijacked() bool
+
+	// Unwrap returns the wrapped http.ResponseWriter.
+	Unwrap() http.ResponseWriter
+}
+
+// responseRecorder is the base ResponseRecorder implementation. Optional interfaces
+// are added by the wrapper types selected in NewResponseRecorder.
+type responseRecorder struct {
+	w           http.ResponseWriter
+	tee         io.Writer
+	status      int
+	bytes       int64
+	wroteHeader bool
+	firstByte   time.Time
+	hijacked    bool
+}
+
+// NewResponseRecorder wraps w in a ResponseRecorder preserving the optional
+// interfaces implemented by w.
+//
+// Example usage:
+//
+//	rec := middleware.NewResponseRecorder(w)
+//	next.ServeHTTP(rec, r)
+//	log.Println(rec.Status(), rec.BytesWritten())
+func NewResponseRecorder(w http.ResponseWriter) ResponseRecorder {
+	return newResponseRecorder(w, nil)
+}
+
+// newResponseRecorder wraps w, copying every body byte written to tee when not nil.
+func newResponseRecorder(w http.ResponseWriter, tee io.Writer) ResponseRecorder {
+	rr := &responseRecorder{w: w, tee: tee, status: http.StatusOK}
+
+	const (
+		flusher = 1 << iota
+		hijacker
+		pusher
+		readerFrom
+	)
+
+	var mask int
+
+	if _, ok := w.(http.Flusher); ok {
+		mask |= flusher
+	}
+
+	if _, ok := w.(http.Hijacker); ok {
+		mask |= hijacker
+	}
+
+	if _, ok := w.(http.Pusher); ok {
+		mask |= pusher
+	}
+
+	if _, ok := w.(io.ReaderFrom); ok {
+		mask |= readerFrom
+	}
+
+	f, h, p, rf := rrFlusher{rr}, rrHijacker{rr}, rrPusher{rr}, rrReaderFrom{rr}
+
+	switch mask {
+	case flusher:
+		return struct {
+			*responseRecorder
+			rrFlusher
+		}{rr, f}
+	case hijacker:
+		return struct {
+			*responseRecorder
+			rrHijacker
+		}{rr, h}
+	case flusher | hijacker:
+		return struct {
+			*responseRecorder
+			rrFlusher
+			rrHijacker
+		}{rr, f, h}
+	case pusher:
+		return struct {
+			*responseRecorder
+			rrPusher
+		}{rr, p}
+	case flusher | pusher:
+		return struct {
+			*responseRecorder
+			rrFlusher
+			rrPusher
+		}{rr, f, p}
+	case hijacker | pusher:
+		return struct {
+			*responseRecorder
+			rrHijacker
+			rrPusher
+		}{rr, h, p}
+	case flusher | hijacker | pusher:
+		return struct {
+			*responseRecorder
+			rrFlusher
+			rrHijacker
+			rrPusher
+		}{rr, f, h, p}
+	case readerFrom:
+		return struct {
+			*responseRecorder
+			rrReaderFrom
+		}{rr, rf}
+	case flusher | readerFrom:
+		return struct {
+			*responseRecorder
+			rrFlusher
+			rrReaderFrom
+		}{rr, f, rf}
+	case hijacker | readerFrom:
+		return struct {
+			*responseRecorder
+			rrHijacker
+			rrReaderFrom
+		}{rr, h, rf}
+	case flusher | hijacker | readerFrom:
+		return struct {
+			*responseRecorder
+			rrFlusher
+			rrHijacker
+			rrReaderFrom
+		}{rr, f, h, rf}
+	case pusher | readerFrom:
+		return struct {
+			*responseRecorder
+			rrPusher
+			rrReaderFrom
+		}{rr, p, rf}
+	case flusher | pusher | readerFrom:
+		return struct {
+			*responseRecorder
+			rrFlusher
+			rrPusher
+			rrReaderFrom
+		}{rr, f, p, rf}
+	case hijacker | pusher | readerFrom:
+		return struct {
+			*responseRecorder
+			rrHijacker
+			rrPusher
+			rrReaderFrom
+		}{rr, h, p, rf}
+	case flusher | hijacker | pusher | readerFrom:
+		return struct {
+			*responseRecorder
+			rrFlusher
+			rrHijacker
+			rrPusher
+			rrReaderFrom
+		}{rr, f, h, p, rf}
+	default:
+		return rr
+	}
+}
+
+func (rr *responseRecorder) Header() http.Header {
+	return rr.w.Header()
+}
+
+// WriteHeader records the first final status code and sends it.
+// Informational 1xx headers, except 101, are sent without being recorded.
+func (rr *responseRecorder) WriteHeader(code int) {
+	if !rr.wroteHeader && (code >= http.StatusOK || code == http.StatusSwitchingProtocols) {
+		rr.status = code
+		rr.wroteHeader = true
+	}
+
+	rr.w.WriteHeader(code)
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	rr.beforeWrite(len(b))
+
+	n, err := rr.w.Write(b)
+	rr.bytes += int64(n)
+
+	if rr.tee != nil && n > 0 {
+		_, _ = rr.tee.Write(b[:n])
+	}
+
+	return n, err
+}
+
+func (rr *responseRecorder) Status() int {
+	return rr.status
+}
+
+func (rr *responseRecorder) BytesWritten() int64 {
+	return rr.bytes
+}
+
+func (rr *responseRecorder) HeaderWritten() bool {
+	return rr.wroteHeader
+}
+
+func (rr *responseRecorder) FirstByteTime() time.Time {
+	return rr.firstByte
+}
+
+func (rr *responseRecorder) Hijacked() bool {
+	return rr.hijacked
+}
+
+func (rr *responseRecorder) Unwrap() http.ResponseWriter {
+	return rr.w
+}
+
+// beforeWrite marks headers as implicitly sent and records the first byte time.
+func (rr *responseRecorder) beforeWrite(n int) {
+	rr.wroteHeader = true
+
+	if n > 0 && rr.firstByte.IsZero() {
+		rr.firstByte = time.Now()
+	}
+}
+
+type rrFlusher struct{ *responseRecorder }
+
+func (w rrFlusher) Flush() {
+	w.wroteHeader = true
+	w.w.(http.Flusher).Flush()
+}
+
+type rrHijacker struct{ *responseRecorder }
+
+func (w rrHijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := w.w.(http.Hijacker).Hijack()
+	if err == nil {
+		w.hijacked = true
+	}
+
+	return conn, rw, err
+}
+
+type rrPusher struct{ *responseRecorder }
+
+func (w rrPusher) Push(target string, opts *http.PushOptions) error {
+	return w.w.(http.Pusher).Push(target, opts)
+}
+
+type rrReaderFrom struct{ *responseRecorder }
+
+// ReadFrom delegates to the wrapped io.ReaderFrom, falling back to Write
+// when body bytes must be copied to a tee.
+func (w rrReaderFrom) ReadFrom(src io.Reader) (int64, error) {
+	if w.tee != nil {
+		return io.Copy(writerOnly{w.responseRecorder}, src)
+	}
+
+	w.beforeWrite(0)
+
+	start := time.Now()
+	n, err := w.w.(io.ReaderFrom).ReadFrom(src)
+	w.bytes += n
+
+	if n > 0 && w.firstByte.IsZero() {
+		w.firstByte = start
+	}
+
+	return n, err
+}
+
+// writerOnly hides the optional interfaces of an io.Writer,
+// preventing io.Copy from calling ReadFrom recursively.
+type writerOnly struct{ io.Writer }
+
+// changedHeader returns a copy of the values of after that differ from before,
+// such as the headers set by a handler since before was cloned.
+func changedHeader(before, after http.Header) http.Header {
+	h := make(http.Header)
+
+	for k, v := range after {
+		if !slices.Equal(before[k], v) {
+			h[k] = slices.Clone(v)
+		}
+	}
+
+	return h
+}
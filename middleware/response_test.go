@@ -0,0 +1,129 @@
+package middleware_test
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/paccolamano/goshare/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+type hijackWriter struct {
+	http.ResponseWriter
+}
+
+func (hijackWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, nil
+}
+
+type readerFromWriter struct {
+	*httptest.ResponseRecorder
+	readFrom bool
+}
+
+func (w *readerFromWriter) ReadFrom(src io.Reader) (int64, error) {
+	w.readFrom = true
+	return io.Copy(w.ResponseRecorder.Body, src)
+}
+
+func TestResponseRecorder(t *testing.T) {
+	t.Parallel()
+
+	w := httptest.NewRecorder()
+	rec := middleware.NewResponseRecorder(w)
+
+	assert.False(t, rec.HeaderWritten())
+	assert.Equal(t, http.StatusOK, rec.Status())
+	assert.True(t, rec.FirstByteTime().IsZero())
+
+	before := time.Now()
+
+	rec.WriteHeader(http.StatusCreated)
+	_, err := rec.Write([]byte("hello"))
+	require.NoError(t, err)
+	_, err = rec.Write([]byte(" world"))
+	require.NoError(t, err)
+
+	assert.True(t, rec.HeaderWritten())
+	assert.Equal(t, http.StatusCreated, rec.Status())
+	assert.Equal(t, int64(11), rec.BytesWritten())
+	assert.False(t, rec.FirstByteTime().Before(before))
+	assert.Equal(t, "hello world", w.Body.String())
+	assert.Same(t, w, rec.Unwrap())
+}
+
+func TestResponseRecorderInterfaces(t *testing.T) {
+	t.Parallel()
+
+	plain := middleware.NewResponseRecorder(struct{ http.ResponseWriter }{httptest.NewRecorder()})
+	_, ok := plain.(http.Flusher)
+	assert.False(t, ok)
+	_, ok = plain.(http.Hijacker)
+	assert.False(t, ok)
+	assert.ErrorIs(t, http.NewResponseController(plain).Flush(), http.ErrNotSupported)
+
+	flusher := middleware.NewResponseRecorder(httptest.NewRecorder())
+	f, ok := flusher.(http.Flusher)
+	require.True(t, ok)
+	f.Flush()
+	assert.True(t, flusher.HeaderWritten())
+	_, ok = flusher.(http.Hijacker)
+	assert.False(t, ok)
+
+	hijacker := middleware.NewResponseRecorder(hijackWriter{httptest.NewRecorder()})
+	h, ok := hijacker.(http.Hijacker)
+	require.True(t, ok)
+	_, _, err := h.Hijack()
+	require.NoError(t, err)
+	assert.True(t, hijacker.Hijacked())
+	_, ok = hijacker.(http.Flusher)
+	assert.False(t, ok)
+}
+
+func TestResponseRecorderReadFrom(t *testing.T) {
+	t.Parallel()
+
+	w := &readerFromWriter{ResponseRecorder: httptest.NewRecorder()}
+	rec := middleware.NewResponseRecorder(w)
+
+	rf, ok := rec.(io.ReaderFrom)
+	require.True(t, ok)
+
+	n, err := rf.ReadFrom(strings.NewReader("streamed"))
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(8), n)
+	assert.Equal(t, int64(8), rec.BytesWritten())
+	assert.True(t, rec.HeaderWritten())
+	assert.False(t, rec.FirstByteTime().IsZero())
+	assert.True(t, w.readFrom)
+}
+
+func TestLoggerPreservesFlusher(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	l := NewMockInfoLogger(ctrl)
+	l.EXPECT().InfoContext(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, err := w.Write([]byte("data: event\n\n"))
+		require.NoError(t, err)
+		require.NoError(t, http.NewResponseController(w).Flush())
+	})
+
+	w := httptest.NewRecorder()
+	middleware.Logger(middleware.WithLogger(l))(handler).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/events", nil))
+
+	assert.True(t, w.Flushed)
+}
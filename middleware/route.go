@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// maxRouteRedirects bounds the ServeMux redirects followed when matching a request.
+const maxRouteRedirects = 2
+
+// routeTable maps http.ServeMux patterns to values, matching requests
+// with the ServeMux precedence rules.
+type routeTable[T any] struct {
+	mux    *http.ServeMux
+	values map[string]T
+}
+
+// newRouteTable creates a routeTable of routes. It panics if patterns
+// are invalid or conflict, like http.ServeMux.Handle.
+func newRouteTable[T any](routes map[string]T) *routeTable[T] {
+	t := &routeTable[T]{mux: http.NewServeMux(), values: routes}
+
+	for pattern := range routes {
+		t.mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+			if m, ok := w.(*routeMatch); ok {
+				m.r = r
+			}
+		})
+	}
+
+	return t
+}
+
+// match returns the value of the pattern matching r, and a copy of r with its
+// Pattern and path values set, as seen by handlers registered on a ServeMux.
+//
+// Requests that a ServeMux redirects, to add a trailing slash to their path or
+// to clean it from "." and ".." segments, are matched as the request they are
+// redirected to, so that "/admin" and "/public/../admin/" match "/admin/".
+func (t *routeTable[T]) match(r *http.Request) (*http.Request, T, bool) {
+	var zero T
+
+	if len(t.values) == 0 {
+		return r, zero, false
+	}
+
+	// ServeMux sets the pattern and path values of the request it serves: match
+	// a shallow copy, keeping those set on r by an outer ServeMux.
+	c := new(http.Request)
+	*c = *r
+
+	for range maxRouteRedirects + 1 {
+		m := &routeMatch{}
+		t.mux.ServeHTTP(m, c)
+
+		if m.r != nil {
+			return m.r, t.values[m.r.Pattern], true
+		}
+
+		u, ok := m.redirect(c)
+		if !ok {
+			break
+		}
+
+		c = c.Clone(c.Context())
+		c.URL = u
+	}
+
+	return r, zero, false
+}
+
+// routeMatch is the http.ResponseWriter given to the routeTable ServeMux,
+// receiving the matched request and discarding responses.
+type routeMatch struct {
+	r    *http.Request
+	h    http.Header
+	code int
+}
+
+// redirect returns the URL the ServeMux redirected r to, if any.
+func (m *routeMatch) redirect(r *http.Request) (*url.URL, bool) {
+	switch m.code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return nil, false
+	}
+
+	loc := m.Header().Get("Location")
+	if loc == "" {
+		return nil, false
+	}
+
+	u, err := r.URL.Parse(loc)
+	if err != nil {
+		return nil, false
+	}
+
+	return u, true
+}
+
+func (m *routeMatch) Header() http.Header {
+	if m.h == nil {
+		m.h = make(http.Header)
+	}
+
+	return m.h
+}
+
+func (m *routeMatch) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (m *routeMatch) WriteHeader(code int) {
+	if m.code == 0 {
+		m.code = code
+	}
+}
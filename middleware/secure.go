@@ -0,0 +1,401 @@
+package middleware
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CSPNoncePlaceholder is replaced in Content-Security-Policy directives with
+// the per-request nonce source, such as 'nonce-r4nd0m'.
+const CSPNoncePlaceholder = "{nonce}"
+
+// cspReportEndpoint is the Reporting-Endpoints name of the CSP report URI.
+const cspReportEndpoint = "csp-endpoint"
+
+// SecureHeadersOptions holds configuration options for the SecureHeaders middleware.
+type SecureHeadersOptions struct {
+	HSTSMaxAge            time.Duration
+	HSTSIncludeSubdomains bool
+	HSTSPreload           bool
+	CSP                   string
+	CSPReportOnly         bool
+	CSPReportURI          string
+	NoSniff               bool
+	FrameOptions          string
+	ReferrerPolicy        string
+	PermissionsPolicy     string
+	COOP                  string
+	COEP                  string
+	CORP                  string
+}
+
+// SecureHeadersOption represents a functional option for configuring SecureHeaders middleware.
+type SecureHeadersOption func(*SecureHeadersOptions)
+
+// WithAPIPreset configures headers suited to APIs, which serve no active content:
+// a CSP denying everything, no framing, no referrer and same-origin isolation.
+// It is the default preset.
+func WithAPIPreset() SecureHeadersOption {
+	return func(opt *SecureHeadersOptions) {
+		*opt = SecureHeadersOptions{
+			HSTSMaxAge:            2 * 365 * 24 * time.Hour,
+			HSTSIncludeSubdomains: true,
+			CSP:                   "default-src 'none'; frame-ancestors 'none'",
+			NoSniff:               true,
+			FrameOptions:          "DENY",
+			ReferrerPolicy:        "no-referrer",
+			COOP:                  "same-origin",
+			CORP:                  "same-origin",
+		}
+	}
+}
+
+// WithWebAppPreset configures headers suited to web applications: a nonce based
+// CSP for scripts and styles, same-origin framing and a restrictive Permissions-Policy.
+// Templates must set the nonce returned by CSPNonce on their script and style tags.
+func WithWebAppPreset() SecureHeadersOption {
+	return func(opt *SecureHeadersOptions) {
+		*opt = SecureHeadersOptions{
+			HSTSMaxAge:            2 * 365 * 24 * time.Hour,
+			HSTSIncludeSubdomains: true,
+			CSP: "default-src 'self'; script-src 'self' " + CSPNoncePlaceholder + " 'strict-dynamic'; " +
+				"style-src 'self' " + CSPNoncePlaceholder + "; img-src 'self' data:; object-src 'none'; " +
+				"base-uri 'self'; form-action 'self'; frame-ancestors 'self'",
+			NoSniff:           true,
+			FrameOptions:      "SAMEORIGIN",
+			ReferrerPolicy:    "strict-origin-when-cross-origin",
+			PermissionsPolicy: "camera=(), microphone=(), geolocation=(), payment=()",
+			COOP:              "same-origin",
+			CORP:              "same-site",
+		}
+	}
+}
+
+// WithHSTS sets the Strict-Transport-Security max age and flags.
+// A zero maxAge disables the header.
+func WithHSTS(maxAge time.Duration, includeSubdomains, preload bool) SecureHeadersOption {
+	return func(opt *SecureHeadersOptions) {
+		opt.HSTSMaxAge = maxAge
+		opt.HSTSIncludeSubdomains = includeSubdomains
+		opt.HSTSPreload = preload
+	}
+}
+
+// WithCSP sets the Content-Security-Policy directives. Occurrences of
+// CSPNoncePlaceholder are replaced with the per-request nonce source.
+// An empty policy disables the header.
+func WithCSP(policy string) SecureHeadersOption {
+	return func(opt *SecureHeadersOptions) {
+		opt.CSP = policy
+	}
+}
+
+// WithCSPReportOnly sends the policy as Content-Security-Policy-Report-Only:
+// violations are reported but not blocked, allowing to test a policy.
+func WithCSPReportOnly() SecureHeadersOption {
+	return func(opt *SecureHeadersOptions) {
+		opt.CSPReportOnly = true
+	}
+}
+
+// WithCSPReportURI sets the URI to which browsers report CSP violations,
+// typically served by CSPReportHandler.
+func WithCSPReportURI(uri string) SecureHeadersOption {
+	return func(opt *SecureHeadersOptions) {
+		opt.CSPReportURI = uri
+	}
+}
+
+// WithFrameOptions sets the X-Frame-Options header, DENY or SAMEORIGIN.
+// An empty value disables the header.
+func WithFrameOptions(v string) SecureHeadersOption {
+	return func(opt *SecureHeadersOptions) {
+		opt.FrameOptions = v
+	}
+}
+
+// WithReferrerPolicy sets the Referrer-Policy header.
+func WithReferrerPolicy(v string) SecureHeadersOption {
+	return func(opt *SecureHeadersOptions) {
+		opt.ReferrerPolicy = v
+	}
+}
+
+// WithPermissionsPolicy sets the Permissions-Policy header, such as "camera=()".
+func WithPermissionsPolicy(v string) SecureHeadersOption {
+	return func(opt *SecureHeadersOptions) {
+		opt.PermissionsPolicy = v
+	}
+}
+
+// WithCrossOriginPolicies sets the Cross-Origin-Opener-Policy, Cross-Origin-Embedder-Policy
+// and Cross-Origin-Resource-Policy headers. Empty values disable the headers.
+func WithCrossOriginPolicies(coop, coep, corp string) SecureHeadersOption {
+	return func(opt *SecureHeadersOptions) {
+		opt.COOP = coop
+		opt.COEP = coep
+		opt.CORP = corp
+	}
+}
+
+// cspNonceKey is the context key under which the CSP nonce is stored.
+type cspNonceKey struct{}
+
+// CSPNonce returns the CSP nonce of the request, set by the SecureHeaders
+// middleware when its policy contains CSPNoncePlaceholder.
+//
+// Example usage:
+//
+//	tmpl.Execute(w, map[string]any{"Nonce": middleware.CSPNonce(r.Context())})
+//
+// with <script nonce="{{.Nonce}}"> in the template.
+func CSPNonce(ctx context.Context) string {
+	nonce, _ := ctx.Value(cspNonceKey{}).(string)
+	return nonce
+}
+
+// SecureHeaders returns a middleware setting security response headers.
+//
+// Presets are selected with WithAPIPreset (the default) or WithWebAppPreset, and
+// refined with the other options, which must follow the preset. When the CSP
+// contains CSPNoncePlaceholder, a random nonce is generated for each request and
+// stored in the request context, available through CSPNonce.
+//
+// Example usage:
+//
+//	http.Handle("/", SecureHeaders(WithWebAppPreset(), WithCSPReportURI("/csp-report"))(site))
+//	http.Handle("POST /csp-report", CSPReportHandler())
+func SecureHeaders(opts ...SecureHeadersOption) func(http.Handler) http.Handler {
+	options := &SecureHeadersOptions{}
+	WithAPIPreset()(options)
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	static := options.staticHeaders()
+
+	csp := options.CSP
+	if csp != "" && options.CSPReportURI != "" {
+		csp += "; report-uri " + options.CSPReportURI + "; report-to " + cspReportEndpoint
+	}
+
+	cspHeader := "Content-Security-Policy"
+	if options.CSPReportOnly {
+		cspHeader = "Content-Security-Policy-Report-Only"
+	}
+
+	withNonce := strings.Contains(csp, CSPNoncePlaceholder)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			for k, v := range static {
+				h.Set(k, v[0])
+			}
+
+			if csp != "" {
+				policy := csp
+
+				if withNonce {
+					nonce := newCSPNonce()
+					policy = strings.ReplaceAll(csp, CSPNoncePlaceholder, "'nonce-"+nonce+"'")
+					r = r.WithContext(context.WithValue(r.Context(), cspNonceKey{}, nonce))
+				}
+
+				h.Set(cspHeader, policy)
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// staticHeaders returns the headers which do not change between requests.
+func (o *SecureHeadersOptions) staticHeaders() http.Header {
+	h := make(http.Header)
+
+	if o.HSTSMaxAge > 0 {
+		hsts := "max-age=" + strconv.FormatInt(int64(o.HSTSMaxAge.Seconds()), 10)
+		if o.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+
+		if o.HSTSPreload {
+			hsts += "; preload"
+		}
+
+		h.Set("Strict-Transport-Security", hsts)
+	}
+
+	if o.NoSniff {
+		h.Set("X-Content-Type-Options", "nosniff")
+	}
+
+	if o.CSP != "" && o.CSPReportURI != "" {
+		h.Set("Reporting-Endpoints", cspReportEndpoint+`="`+o.CSPReportURI+`"`)
+	}
+
+	for name, v := range map[string]string{
+		"X-Frame-Options":              o.FrameOptions,
+		"Referrer-Policy":              o.ReferrerPolicy,
+		"Permissions-Policy":           o.PermissionsPolicy,
+		"Cross-Origin-Opener-Policy":   o.COOP,
+		"Cross-Origin-Embedder-Policy": o.COEP,
+		"Cross-Origin-Resource-Policy": o.CORP,
+	} {
+		if v != "" {
+			h.Set(name, v)
+		}
+	}
+
+	return h
+}
+
+// newCSPNonce returns a random base64 nonce of 128 bits.
+func newCSPNonce() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+// CSPReportOptions holds configuration options for the CSPReportHandler.
+type CSPReportOptions struct {
+	Logger  WarnLogger
+	MaxSize int64
+}
+
+// CSPReportOption represents a functional option for configuring the CSPReportHandler.
+type CSPReportOption func(*CSPReportOptions)
+
+// WithCSPReportLogger sets a custom WarnLogger logging CSP violations.
+func WithCSPReportLogger(l WarnLogger) CSPReportOption {
+	return func(opt *CSPReportOptions) {
+		opt.Logger = l
+	}
+}
+
+// WithCSPReportMaxSize sets the maximum size of report bodies. The default is 64 KiB.
+func WithCSPReportMaxSize(n int64) CSPReportOption {
+	return func(opt *CSPReportOptions) {
+		opt.MaxSize = n
+	}
+}
+
+// cspViolation holds the fields of a CSP violation report, in both the legacy
+// report-uri format and the Reporting API format.
+type cspViolation struct {
+	DocumentURI        string `json:"document-uri"`
+	DocumentURL        string `json:"documentURL"`
+	ViolatedDirective  string `json:"violated-directive"`
+	EffectiveDirective string `json:"effective-directive"`
+	EffectiveDir       string `json:"effectiveDirective"`
+	BlockedURI         string `json:"blocked-uri"`
+	BlockedURL         string `json:"blockedURL"`
+	Disposition        string `json:"disposition"`
+	SourceFile         string `json:"source-file"`
+	SourceFileURL      string `json:"sourceFile"`
+	LineNumber         int    `json:"line-number"`
+	LineNum            int    `json:"lineNumber"`
+}
+
+// CSPReportHandler returns an http.Handler collecting the CSP violations reported
+// by browsers, in the application/csp-report format of report-uri and the
+// application/reports+json format of the Reporting API. Violations are logged
+// as warnings and answered with 204 No Content.
+func CSPReportHandler(opts ...CSPReportOption) http.Handler {
+	options := &CSPReportOptions{
+		Logger:  slog.Default(),
+		MaxSize: 64 << 10,
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			WriteProblem(w, NewProblem(http.StatusMethodNotAllowed))
+
+			return
+		}
+
+		data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, options.MaxSize))
+		if err != nil {
+			WriteProblem(w, NewProblem(http.StatusRequestEntityTooLarge))
+			return
+		}
+
+		violations, err := parseCSPReports(r.Header.Get("Content-Type"), data)
+		if err != nil {
+			p := NewProblem(http.StatusBadRequest)
+			p.Detail = "malformed csp report"
+
+			WriteProblem(w, p)
+
+			return
+		}
+
+		for _, v := range violations {
+			options.Logger.WarnContext(r.Context(), "csp violation",
+				"documentURI", cmp.Or(v.DocumentURI, v.DocumentURL),
+				"directive", cmp.Or(v.EffectiveDirective, v.EffectiveDir, v.ViolatedDirective),
+				"blockedURI", cmp.Or(v.BlockedURI, v.BlockedURL),
+				"disposition", v.Disposition,
+				"sourceFile", cmp.Or(v.SourceFile, v.SourceFileURL),
+				"lineNumber", max(v.LineNumber, v.LineNum),
+				"userAgent", r.UserAgent(),
+			)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// parseCSPReports parses the violations of a report body.
+func parseCSPReports(contentType string, data []byte) ([]cspViolation, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	if mediaType == "application/reports+json" {
+		var reports []struct {
+			Type string       `json:"type"`
+			Body cspViolation `json:"body"`
+		}
+
+		if err := json.Unmarshal(data, &reports); err != nil {
+			return nil, err
+		}
+
+		var violations []cspViolation
+
+		for _, r := range reports {
+			if r.Type == "csp-violation" {
+				violations = append(violations, r.Body)
+			}
+		}
+
+		return violations, nil
+	}
+
+	var report struct {
+		Report cspViolation `json:"csp-report"`
+	}
+
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, err
+	}
+
+	return []cspViolation{report.Report}, nil
+}
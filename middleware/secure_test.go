@@ -0,0 +1,161 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/paccolamano/goshare/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestSecureHeadersAPIPreset(t *testing.T) {
+	t.Parallel()
+
+	w := httptest.NewRecorder()
+	middleware.SecureHeaders()(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, middleware.CSPNonce(r.Context()))
+	})).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	expected := map[string]string{
+		"Strict-Transport-Security":    "max-age=63072000; includeSubDomains",
+		"Content-Security-Policy":      "default-src 'none'; frame-ancestors 'none'",
+		"X-Content-Type-Options":       "nosniff",
+		"X-Frame-Options":              "DENY",
+		"Referrer-Policy":              "no-referrer",
+		"Cross-Origin-Opener-Policy":   "same-origin",
+		"Cross-Origin-Resource-Policy": "same-origin",
+		"Cross-Origin-Embedder-Policy": "",
+		"Permissions-Policy":           "",
+	}
+
+	for name, v := range expected {
+		assert.Equal(t, v, w.Header().Get(name), name)
+	}
+}
+
+func TestSecureHeadersWebAppNonce(t *testing.T) {
+	t.Parallel()
+
+	var nonces []string
+
+	handler := middleware.SecureHeaders(
+		middleware.WithWebAppPreset(),
+		middleware.WithHSTS(time.Hour, false, true),
+		middleware.WithCrossOriginPolicies("same-origin", "require-corp", ""),
+	)(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		nonces = append(nonces, middleware.CSPNonce(r.Context()))
+	}))
+
+	for range 2 {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		nonce := nonces[len(nonces)-1]
+		require.Regexp(t, regexp.MustCompile(`^[A-Za-z0-9+/]{22}==$`), nonce)
+
+		csp := w.Header().Get("Content-Security-Policy")
+		assert.Contains(t, csp, "script-src 'self' 'nonce-"+nonce+"' 'strict-dynamic'")
+		assert.Contains(t, csp, "style-src 'self' 'nonce-"+nonce+"'")
+		assert.NotContains(t, csp, middleware.CSPNoncePlaceholder)
+
+		assert.Equal(t, "max-age=3600; preload", w.Header().Get("Strict-Transport-Security"))
+		assert.Equal(t, "SAMEORIGIN", w.Header().Get("X-Frame-Options"))
+		assert.Equal(t, "require-corp", w.Header().Get("Cross-Origin-Embedder-Policy"))
+		assert.Empty(t, w.Header().Get("Cross-Origin-Resource-Policy"))
+		assert.Contains(t, w.Header().Get("Permissions-Policy"), "camera=()")
+	}
+
+	assert.NotEqual(t, nonces[0], nonces[1])
+}
+
+func TestSecureHeadersReportOnly(t *testing.T) {
+	t.Parallel()
+
+	w := httptest.NewRecorder()
+	middleware.SecureHeaders(
+		middleware.WithCSP("default-src 'self'"),
+		middleware.WithCSPReportOnly(),
+		middleware.WithCSPReportURI("/csp-report"),
+		middleware.WithFrameOptions(""),
+		middleware.WithReferrerPolicy("same-origin"),
+		middleware.WithPermissionsPolicy("usb=()"),
+	)(http.NotFoundHandler()).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Empty(t, w.Header().Get("Content-Security-Policy"))
+	assert.Equal(t, "default-src 'self'; report-uri /csp-report; report-to csp-endpoint",
+		w.Header().Get("Content-Security-Policy-Report-Only"))
+	assert.Equal(t, `csp-endpoint="/csp-report"`, w.Header().Get("Reporting-Endpoints"))
+	assert.Empty(t, w.Header().Get("X-Frame-Options"))
+	assert.Equal(t, "same-origin", w.Header().Get("Referrer-Policy"))
+	assert.Equal(t, "usb=()", w.Header().Get("Permissions-Policy"))
+}
+
+func TestCSPReportHandler(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	l := NewMockWarnLogger(ctrl)
+	l.EXPECT().
+		WarnContext(gomock.Any(), "csp violation",
+			"documentURI", "https://example.com/page",
+			"directive", "script-src-elem",
+			"blockedURI", "https://evil.com/x.js",
+			"disposition", "enforce",
+			"sourceFile", "https://example.com/page",
+			"lineNumber", 12,
+			"userAgent", gomock.Any(),
+		).
+		Times(2)
+
+	handler := middleware.CSPReportHandler(middleware.WithCSPReportLogger(l), middleware.WithCSPReportMaxSize(1024))
+
+	tests := []struct {
+		name        string
+		method      string
+		contentType string
+		body        string
+		status      int
+	}{
+		{
+			name:        "legacy",
+			method:      http.MethodPost,
+			contentType: "application/csp-report",
+			body: `{"csp-report":{"document-uri":"https://example.com/page","violated-directive":"script-src-elem",` +
+				`"effective-directive":"script-src-elem","blocked-uri":"https://evil.com/x.js","disposition":"enforce",` +
+				`"source-file":"https://example.com/page","line-number":12}}`,
+			status: http.StatusNoContent,
+		},
+		{
+			name:        "reporting api",
+			method:      http.MethodPost,
+			contentType: "application/reports+json",
+			body: `[{"type":"csp-violation","body":{"documentURL":"https://example.com/page","effectiveDirective":"script-src-elem",` +
+				`"blockedURL":"https://evil.com/x.js","disposition":"enforce","sourceFile":"https://example.com/page","lineNumber":12}},` +
+				`{"type":"deprecation","body":{}}]`,
+			status: http.StatusNoContent,
+		},
+		{name: "malformed", method: http.MethodPost, contentType: "application/csp-report", body: "{", status: http.StatusBadRequest},
+		{name: "too large", method: http.MethodPost, contentType: "application/csp-report", body: strings.Repeat("x", 2048), status: http.StatusRequestEntityTooLarge},
+		{name: "method", method: http.MethodGet, status: http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/csp-report", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.status, w.Code)
+		})
+	}
+}
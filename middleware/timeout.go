@@ -0,0 +1,319 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"time"
+)
+
+//go:generate mockgen -source=timeout.go -destination=timeout_mock_test.go -package=middleware_test
+
+// WarnLogger defines an interface for logging warnings with contextual information.
+// This is typically implemented by structured logging libraries.
+type WarnLogger interface {
+	WarnContext(ctx context.Context, msg string, args ...any)
+}
+
+// HandlerPanic is the value with which Timeout propagates the panic of a handler
+// to the serving goroutine. It carries the stack of the handler goroutine, which
+// is lost once the panic is raised again. Recover unwraps it, reporting Value and Stack.
+type HandlerPanic struct {
+	// Value is the value passed to panic by the handler.
+	Value any
+	// Stack is the stack trace of the handler goroutine.
+	Stack []byte
+
+	pcs []uintptr
+}
+
+// String formats the panic value followed by the handler stack.
+func (p *HandlerPanic) String() string {
+	return fmt.Sprintf("%v\n\n%s", p.Value, p.Stack)
+}
+
+// TimeoutOptions holds configuration options for the Timeout middleware.
+type TimeoutOptions struct {
+	Timeout    time.Duration
+	Routes     map[string]time.Duration
+	Status     int
+	Header     string
+	MaxTimeout time.Duration
+	Logger     WarnLogger
+	TraceKey   any
+}
+
+// TimeoutOption represents a functional option for configuring Timeout middleware.
+type TimeoutOption func(*TimeoutOptions)
+
+// WithTimeout sets the timeout of requests not matching any route set with
+// WithRouteTimeout. The default is 30 seconds.
+func WithTimeout(d time.Duration) TimeoutOption {
+	return func(opt *TimeoutOptions) {
+		opt.Timeout = d
+	}
+}
+
+// WithRouteTimeout sets the timeout of requests matching pattern, using the
+// http.ServeMux pattern syntax, such as "GET /reports/{id}". A non-positive
+// timeout disables the timeout for the route, for instance for streaming responses.
+// It can be used multiple times.
+func WithRouteTimeout(pattern string, d time.Duration) TimeoutOption {
+	return func(opt *TimeoutOptions) {
+		if opt.Routes == nil {
+			opt.Routes = make(map[string]time.Duration)
+		}
+
+		opt.Routes[pattern] = d
+	}
+}
+
+// WithTimeoutStatus sets the status of the problem response written when
+// a request times out, typically 503 or 504. The default is 503.
+func WithTimeoutStatus(status int) TimeoutOption {
+	return func(opt *TimeoutOptions) {
+		opt.Status = status
+	}
+}
+
+// WithTimeoutHeader lets clients override the timeout of a request through the
+// header name, holding either a Go duration such as "1.5s" or a number of seconds.
+// Overrides are capped at maxTimeout; invalid or non-positive values are ignored.
+// The header is ignored when maxTimeout is not positive and on routes whose
+// timeout is disabled, so that clients cannot disable the timeout nor impose one.
+func WithTimeoutHeader(name string, maxTimeout time.Duration) TimeoutOption {
+	return func(opt *TimeoutOptions) {
+		opt.Header = name
+		opt.MaxTimeout = maxTimeout
+	}
+}
+
+// WithTimeoutLogger sets a custom WarnLogger for the Timeout middleware.
+func WithTimeoutLogger(l WarnLogger) TimeoutOption {
+	return func(opt *TimeoutOptions) {
+		opt.Logger = l
+	}
+}
+
+// WithTimeoutTraceKey sets the context key from which the Timeout middleware reads
+// the trace ID. It should match the Tracer key.
+func WithTimeoutTraceKey(key any) TimeoutOption {
+	return func(opt *TimeoutOptions) {
+		opt.TraceKey = key
+	}
+}
+
+// Timeout returns a middleware bounding the time spent serving a request.
+//
+// The request context is given a deadline and the handler runs in its own goroutine,
+// writing to a buffer. If it completes in time, the buffered response is sent.
+// Otherwise a problem response including the trace ID is written, the timeout is
+// logged and later writes of the handler fail with http.ErrHandlerTimeout.
+// Handlers should stop their work once the request context is done.
+//
+// Example usage:
+//
+//	http.ListenAndServe(":8080", Timeout(WithTimeout(5*time.Second),
+//		WithRouteTimeout("POST /reports", time.Minute))(mux))
+//
+// Because the response is buffered, the writer given to the handler does not
+// implement http.Flusher nor http.Hijacker: disable the timeout of streaming and
+// websocket routes with a non-positive WithRouteTimeout. Panics of the handler
+// are propagated to the serving goroutine as a *HandlerPanic, where Recover can
+// handle them. Panics raised after the timeout are logged, since the request is
+// already answered.
+func Timeout(opts ...TimeoutOption) func(http.Handler) http.Handler {
+	options := &TimeoutOptions{
+		Timeout:  30 * time.Second,
+		Status:   http.StatusServiceUnavailable,
+		Logger:   slog.Default(),
+		TraceKey: "traceUUID",
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	routes := newRouteTable(options.Routes)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			timeout := options.timeout(routes, r)
+			if timeout <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+
+			r = r.WithContext(ctx)
+			tw := &timeoutWriter{ctx: ctx, h: make(http.Header), code: http.StatusOK}
+			done := make(chan struct{})
+			panicked := make(chan any)
+			returned := make(chan struct{})
+			defer close(returned)
+
+			go func() {
+				defer func() {
+					p := recover()
+					if p == nil {
+						return
+					}
+
+					if p != http.ErrAbortHandler {
+						p = &HandlerPanic{Value: p, Stack: debug.Stack(), pcs: callers()}
+					}
+
+					select {
+					case panicked <- p:
+					case <-returned:
+						options.logLatePanic(r, p)
+					}
+				}()
+
+				next.ServeHTTP(tw, r)
+				close(done)
+			}()
+
+			select {
+			case p := <-panicked:
+				panic(p)
+			case <-done:
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+
+				maps.Copy(w.Header(), tw.h)
+				w.WriteHeader(tw.code)
+				_, _ = w.Write(tw.buf.Bytes())
+			case <-ctx.Done():
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+
+				tw.timedOut = true
+				traceID := requestTraceID(w, r, options.TraceKey)
+
+				if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+					args := []any{
+						"method", r.Method,
+						"path", r.URL.Path,
+						"timeout", timeout,
+					}
+					options.Logger.WarnContext(ctx, "request timed out", append(args, traceAttrs(ctx, options.Logger, traceID)...)...)
+				}
+
+				p := NewProblem(options.Status)
+				p.Detail = "request did not complete within " + timeout.String()
+				p.Instance = r.URL.Path
+				p.TraceID = traceID
+
+				WriteProblem(w, p)
+			}
+		})
+	}
+}
+
+// logLatePanic logs a panic raised by the handler of r after the request timed out.
+func (o *TimeoutOptions) logLatePanic(r *http.Request, p any) {
+	ctx := r.Context()
+	args := []any{"method", r.Method, "path", r.URL.Path}
+
+	if hp, ok := p.(*HandlerPanic); ok {
+		args = append(args, "error", hp.Value, "stack", string(hp.Stack))
+	} else {
+		args = append(args, "error", p)
+	}
+
+	if id, ok := ctx.Value(o.TraceKey).(string); ok {
+		args = append(args, traceAttrs(ctx, o.Logger, id)...)
+	}
+
+	o.Logger.WarnContext(ctx, "handler panicked after timeout", args...)
+}
+
+// timeout returns the timeout of r: the route timeout or the default one,
+// overridden by the request header when enabled.
+func (o *TimeoutOptions) timeout(routes *routeTable[time.Duration], r *http.Request) time.Duration {
+	timeout := o.Timeout
+	if _, d, ok := routes.match(r); ok {
+		timeout = d
+	}
+
+	// Clients can neither disable the timeout nor set one on routes without timeout.
+	if o.Header == "" || o.MaxTimeout <= 0 || timeout <= 0 {
+		return timeout
+	}
+
+	if d, ok := parseTimeout(r.Header.Get(o.Header)); ok {
+		return min(d, o.MaxTimeout)
+	}
+
+	return timeout
+}
+
+// parseTimeout parses a Go duration or a number of seconds.
+func parseTimeout(v string) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		secs, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return 0, false
+		}
+
+		d = time.Duration(secs * float64(time.Second))
+	}
+
+	return d, d > 0
+}
+
+// timeoutWriter buffers the response of a handler run by Timeout.
+// Writes fail once the request context is done.
+type timeoutWriter struct {
+	ctx         context.Context
+	mu          sync.Mutex
+	h           http.Header
+	buf         bytes.Buffer
+	code        int
+	wroteHeader bool
+	timedOut    bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.h
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut || tw.ctx.Err() != nil {
+		return 0, http.ErrHandlerTimeout
+	}
+
+	tw.wroteHeader = true
+
+	return tw.buf.Write(b)
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut || tw.ctx.Err() != nil || tw.wroteHeader || code < http.StatusOK {
+		return
+	}
+
+	tw.wroteHeader = true
+	tw.code = code
+}
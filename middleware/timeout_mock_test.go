@@ -0,0 +1,58 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: timeout.go
+//
+// Generated by this command:
+//
+//	mockgen -source=timeout.go -destination=timeout_mock_test.go -package=middleware_test
+//
+
+// Package middleware_test is a generated GoMock package.
+package middleware_test
+
+import (
+	context "context"
+	reflect "reflect"
+
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockWarnLogger is a mock of WarnLogger interface.
+type MockWarnLogger struct {
+	ctrl     *gomock.Controller
+	recorder *MockWarnLoggerMockRecorder
+	isgomock struct{}
+}
+
+// MockWarnLoggerMockRecorder is the mock recorder for MockWarnLogger.
+type MockWarnLoggerMockRecorder struct {
+	mock *MockWarnLogger
+}
+
+// NewMockWarnLogger creates a new mock instance.
+func NewMockWarnLogger(ctrl *gomock.Controller) *MockWarnLogger {
+	mock := &MockWarnLogger{ctrl: ctrl}
+	mock.recorder = &MockWarnLoggerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockWarnLogger) EXPECT() *MockWarnLoggerMockRecorder {
+	return m.recorder
+}
+
+// WarnContext mocks base method.
+func (m *MockWarnLogger) WarnContext(ctx context.Context, msg string, args ...any) {
+	m.ctrl.T.Helper()
+	varargs := []any{ctx, msg}
+	for _, a := range args {
+		varargs = append(varargs, a)
+	}
+	m.ctrl.Call(m, "WarnContext", varargs...)
+}
+
+// WarnContext indicates an expected call of WarnContext.
+func (mr *MockWarnLoggerMockRecorder) WarnContext(ctx, msg any, args ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{ctx, msg}, args...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WarnContext", reflect.TypeOf((*MockWarnLogger)(nil).WarnContext), varargs...)
+}
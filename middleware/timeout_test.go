@@ -0,0 +1,331 @@
+package middleware_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/paccolamano/goshare/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+// slowHandler writes "done" after d, or reports the write error on errs
+// once the request context is done.
+func slowHandler(d time.Duration, errs chan<- error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(d):
+		case <-r.Context().Done():
+		}
+
+		w.Header().Set("X-Handler", "slow")
+		_, err := io.WriteString(w, "done")
+
+		if errs != nil {
+			errs <- err
+		}
+	})
+}
+
+func TestTimeoutCompletes(t *testing.T) {
+	t.Parallel()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, ok := r.Context().Deadline()
+		assert.True(t, ok)
+
+		w.Header().Set("X-Handler", "fast")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = io.WriteString(w, "created")
+	})
+
+	w := httptest.NewRecorder()
+	middleware.Timeout()(handler).ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", nil))
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "fast", w.Header().Get("X-Handler"))
+	assert.Equal(t, "created", w.Body.String())
+}
+
+func TestTimeoutExpires(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	l := NewMockWarnLogger(ctrl)
+	l.EXPECT().
+		WarnContext(gomock.Any(), "request timed out",
+			"method", http.MethodGet,
+			"path", "/slow",
+			"timeout", 10*time.Millisecond,
+			"traceUUID", "trace-1",
+		).
+		Times(1)
+
+	errs := make(chan error, 1)
+	mw := middleware.Timeout(
+		middleware.WithTimeout(10*time.Millisecond),
+		middleware.WithTimeoutStatus(http.StatusGatewayTimeout),
+		middleware.WithTimeoutLogger(l),
+	)
+
+	w := httptest.NewRecorder()
+	w.Header().Set("X-Request-ID", "trace-1")
+	mw(slowHandler(time.Minute, errs)).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow", nil))
+
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+	assert.Equal(t, middleware.ProblemContentType, w.Header().Get("Content-Type"))
+	assert.Empty(t, w.Header().Get("X-Handler"))
+
+	var body map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, "trace-1", body["traceId"])
+	assert.Equal(t, "request did not complete within 10ms", body["detail"])
+
+	require.ErrorIs(t, <-errs, http.ErrHandlerTimeout)
+}
+
+func TestTimeoutRoutes(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	l := NewMockWarnLogger(ctrl)
+	l.EXPECT().WarnContext(gomock.Any(), "request timed out", gomock.Any()).AnyTimes()
+
+	mw := middleware.Timeout(
+		middleware.WithTimeout(time.Minute),
+		middleware.WithRouteTimeout("GET /reports/{id}", 10*time.Millisecond),
+		middleware.WithRouteTimeout("/stream", 0),
+		middleware.WithTimeoutLogger(l),
+	)
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		deadline bool
+		status   int
+	}{
+		{name: "route timeout", method: http.MethodGet, path: "/reports/1", deadline: true, status: http.StatusServiceUnavailable},
+		{name: "other method", method: http.MethodPost, path: "/reports/1", deadline: true, status: http.StatusOK},
+		{name: "disabled", method: http.MethodGet, path: "/stream", deadline: false, status: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, ok := r.Context().Deadline()
+				assert.Equal(t, tt.deadline, ok)
+
+				if _, isFlusher := w.(http.Flusher); !tt.deadline {
+					assert.True(t, isFlusher)
+				}
+
+				select {
+				case <-time.After(200 * time.Millisecond):
+				case <-r.Context().Done():
+				}
+			})
+
+			w := httptest.NewRecorder()
+			mw(handler).ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+
+			assert.Equal(t, tt.status, w.Code)
+		})
+	}
+}
+
+func TestTimeoutHeaderOverride(t *testing.T) {
+	t.Parallel()
+
+	mw := middleware.Timeout(
+		middleware.WithTimeout(time.Minute),
+		middleware.WithTimeoutHeader("Request-Timeout", 2*time.Second),
+	)
+
+	tests := []struct {
+		name   string
+		value  string
+		expect time.Duration
+	}{
+		{name: "duration", value: "500ms", expect: 500 * time.Millisecond},
+		{name: "seconds", value: "1.5", expect: 1500 * time.Millisecond},
+		{name: "capped", value: "1h", expect: 2 * time.Second},
+		{name: "invalid", value: "soon", expect: time.Minute},
+		{name: "negative", value: "-1s", expect: time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			start := time.Now()
+			handler := http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				deadline, ok := r.Context().Deadline()
+				require.True(t, ok)
+				assert.WithinDuration(t, start.Add(tt.expect), deadline, 100*time.Millisecond)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Request-Timeout", tt.value)
+
+			mw(handler).ServeHTTP(httptest.NewRecorder(), req)
+		})
+	}
+}
+
+func TestTimeoutHeaderIgnored(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		opts     []middleware.TimeoutOption
+		deadline bool
+	}{
+		{
+			name:     "no max timeout",
+			opts:     []middleware.TimeoutOption{middleware.WithTimeoutHeader("Request-Timeout", 0)},
+			deadline: true,
+		},
+		{
+			name: "disabled route",
+			opts: []middleware.TimeoutOption{
+				middleware.WithRouteTimeout("/", 0),
+				middleware.WithTimeoutHeader("Request-Timeout", time.Minute),
+			},
+			deadline: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			start := time.Now()
+			handler := http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				deadline, ok := r.Context().Deadline()
+				require.Equal(t, tt.deadline, ok)
+
+				if ok {
+					assert.WithinDuration(t, start.Add(30*time.Second), deadline, 100*time.Millisecond)
+				}
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Request-Timeout", "1s")
+
+			middleware.Timeout(tt.opts...)(handler).ServeHTTP(httptest.NewRecorder(), req)
+		})
+	}
+}
+
+// timeoutPanicHandler panics with "boom" after d.
+func timeoutPanicHandler(w http.ResponseWriter, r *http.Request, d time.Duration) {
+	time.Sleep(d)
+	panic("boom")
+}
+
+func TestTimeoutPropagatesPanic(t *testing.T) {
+	t.Parallel()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timeoutPanicHandler(w, r, 0)
+	})
+
+	defer func() {
+		p, ok := recover().(*middleware.HandlerPanic)
+		require.True(t, ok)
+		assert.Equal(t, "boom", p.Value)
+		assert.Contains(t, string(p.Stack), "timeoutPanicHandler")
+	}()
+
+	middleware.Timeout()(handler).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+}
+
+func TestTimeoutPanicRecovered(t *testing.T) {
+	t.Parallel()
+
+	var info *middleware.PanicInfo
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timeoutPanicHandler(w, r, 0)
+	})
+
+	mw := middleware.Recover(
+		middleware.WithRecoverLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		middleware.WithPanicCallback(func(w http.ResponseWriter, _ *http.Request, i *middleware.PanicInfo) {
+			info = i
+
+			w.WriteHeader(http.StatusInternalServerError)
+		}),
+	)
+
+	w := httptest.NewRecorder()
+	mw(middleware.Timeout()(handler)).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	require.NotNil(t, info)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "boom", info.Value)
+	assert.Equal(t, middleware.PanicKindString, info.Kind)
+	assert.Contains(t, string(info.Stack), "timeoutPanicHandler")
+	require.NotEmpty(t, info.Frames)
+	assert.Equal(t, "github.com/paccolamano/goshare/middleware_test.timeoutPanicHandler", info.Frames[0].Function)
+}
+
+func TestTimeoutLogsLatePanic(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	logged := make(chan struct{})
+
+	l := NewMockWarnLogger(ctrl)
+	l.EXPECT().WarnContext(gomock.Any(), "request timed out", gomock.Any()).Times(1)
+	l.EXPECT().
+		WarnContext(gomock.Any(), "handler panicked after timeout",
+			"method", http.MethodGet,
+			"path", "/late",
+			"error", "boom",
+			"stack", gomock.Cond(func(s string) bool { return strings.Contains(s, "timeoutPanicHandler") }),
+		).
+		Do(func(context.Context, string, ...any) { close(logged) }).
+		Times(1)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		timeoutPanicHandler(w, r, 10*time.Millisecond)
+	})
+
+	mw := middleware.Timeout(middleware.WithTimeout(10*time.Millisecond), middleware.WithTimeoutLogger(l))
+
+	w := httptest.NewRecorder()
+	mw(handler).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/late", nil))
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	select {
+	case <-logged:
+	case <-time.After(time.Second):
+		t.Fatal("late panic not logged")
+	}
+}
+
+func TestTimeoutKeepsPathValues(t *testing.T) {
+	t.Parallel()
+
+	assertPathValuesKept(t, middleware.Timeout(middleware.WithRouteTimeout("/other/", time.Second)))
+}
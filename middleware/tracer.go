@@ -5,11 +5,13 @@ import (
 	"net/http"
 
 	"github.com/google/uuid"
+	"github.com/paccolamano/goshare/logger"
 )
 
 // TracerOptions holds configuration options for the Tracer middleware.
 type TracerOptions struct {
-	TraceKey any
+	TraceKey      any
+	ContextLogger bool
 }
 
 // TracerOption represents a functional option for configuring Tracer middleware.
@@ -22,6 +24,18 @@ func WithTraceKey(key any) TracerOption {
 	}
 }
 
+// WithTracerContextLogger makes the Tracer middleware store a request-scoped logger
+// carrying the trace ID in the request context. The logger is derived from
+// logger.FromContext and can be retrieved by handlers the same way. When the trace
+// key is logger.TraceIDKey and the logger is backed by a logger.TraceHandler, the
+// trace ID is left to the handler, which injects it when logging with the request
+// context (InfoContext and the like).
+func WithTracerContextLogger() TracerOption {
+	return func(opt *TracerOptions) {
+		opt.ContextLogger = true
+	}
+}
+
 // Tracer returns a middleware that generates a unique request ID (UUID) for each incoming HTTP request,
 // attaches it to the response header as "X-Request-ID", and stores it in the request context using the provided key.
 //
@@ -52,6 +66,11 @@ func Tracer(opts ...TracerOption) func(http.Handler) http.Handler {
 			w.Header().Set("X-Request-ID", uuid)
 			ctx := context.WithValue(r.Context(), options.TraceKey, uuid)
 
+			if options.ContextLogger {
+				l := logger.FromContext(ctx)
+				ctx = logger.IntoContext(ctx, l.With(traceAttrs(ctx, l, uuid)...))
+			}
+
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
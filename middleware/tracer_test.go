@@ -1,11 +1,15 @@
 package middleware_test
 
 import (
+	"bytes"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/google/uuid"
+	"github.com/paccolamano/goshare/logger"
 	"github.com/paccolamano/goshare/middleware"
 	"github.com/stretchr/testify/require"
 )
@@ -36,3 +40,51 @@ func TestTracerMiddleware(t *testing.T) {
 
 	require.Equal(t, requestID, traceIDInContext, "Trace ID in context should match X-Request-ID header")
 }
+
+func TestTracerContextLogger(t *testing.T) {
+	t.Parallel()
+
+	buf := &bytes.Buffer{}
+	base := slog.New(slog.NewTextHandler(buf, nil))
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger.FromContext(r.Context()).Info("handled")
+
+		w.WriteHeader(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/tracer", nil)
+	req = req.WithContext(logger.IntoContext(req.Context(), base))
+	w := httptest.NewRecorder()
+
+	middleware.Tracer(middleware.WithTracerContextLogger())(handler).ServeHTTP(w, req)
+
+	requestID := w.Result().Header.Get("X-Request-ID")
+	require.Contains(t, buf.String(), "traceUUID="+requestID)
+}
+
+func TestTracerContextLoggerTraceHandler(t *testing.T) {
+	t.Parallel()
+
+	buf := &bytes.Buffer{}
+	base := slog.New(logger.NewTraceHandler(buf, "json", "info"))
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger.FromContext(r.Context()).InfoContext(r.Context(), "handled")
+
+		w.WriteHeader(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/tracer", nil)
+	req = req.WithContext(logger.IntoContext(req.Context(), base))
+	w := httptest.NewRecorder()
+
+	middleware.Tracer(
+		middleware.WithTraceKey(logger.TraceIDKey),
+		middleware.WithTracerContextLogger(),
+	)(handler).ServeHTTP(w, req)
+
+	requestID := w.Result().Header.Get("X-Request-ID")
+	require.Contains(t, buf.String(), `"traceUUID":"`+requestID+`"`)
+	require.Equal(t, 1, strings.Count(buf.String(), "traceUUID"))
+}